@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// adaptiveOrder reorders the rules of edges with the AnyPasses strategy by their observed pass rates
+type adaptiveOrder struct {
+	mu     sync.Mutex
+	period int
+	edges  map[edge]*passRates
+}
+
+// passRates counts the evaluations and passes of the rules of an edge since the last decays
+type passRates struct {
+	rules       *ruleSet
+	evaluations int
+	evaluated   []float64
+	passed      []float64
+	order       []int
+}
+
+// SetAdaptiveOrdering makes edges with the AnyPasses strategy evaluate the rules most likely to pass first,
+// so the remaining guards are skipped more often
+// Every period evaluations of an edge, its order is recomputed from the pass rates and the counts are halved,
+// so the order follows changes of the traffic, a period of 0 turns adaptive ordering off
+// The outcome of a transition does not depend on the order, but guards with side effects may be called less often
+func (sm *StateMachine) SetAdaptiveOrdering(period int) {
+	if period <= 0 {
+		sm.adaptive = nil
+
+		return
+	}
+
+	sm.adaptive = &adaptiveOrder{
+		period: period,
+		edges:  map[edge]*passRates{},
+	}
+}
+
+// EvaluationOrder returns the rules of an edge in the order they are currently evaluated
+func (sm *StateMachine) EvaluationOrder(from, to State) []TransitionRule {
+	rs := sm.loadRules()
+	rules := rs.byEdge[edge{from: from, to: to}]
+	if sm.adaptive == nil || sm.matchStrategy(from, to) != AnyPasses {
+		return append([]TransitionRule(nil), rules...)
+	}
+
+	ordered := make([]TransitionRule, 0, len(rules))
+	for _, i := range sm.adaptive.order(rs, edge{from: from, to: to}) {
+		ordered = append(ordered, rules[i])
+	}
+
+	return ordered
+}
+
+// anyPasses is true if at least one of the rules of an edge is valid, evaluating them in adaptive order
+func (a *adaptiveOrder) anyPasses(ctx context.Context, sm *StateMachine, from, to State, trace *DebugTrace, params ...interface{}) bool {
+	e := edge{from: from, to: to}
+	rs := sm.loadRules()
+	rules := rs.byEdge[e]
+
+	for _, i := range a.order(rs, e) {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		valid := sm.valid(rules[i], from, to, params...)
+		sm.coverage.evaluated(from, to, i, valid)
+		trace.evaluated(i, rules[i], valid)
+		a.record(rs, e, i, valid)
+
+		if valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// order returns a copy of the current evaluation order of an edge as indexes into its rules
+func (a *adaptiveOrder) order(rs *ruleSet, e edge) []int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]int(nil), a.rates(rs, e).order...)
+}
+
+// record counts the evaluation of the i-th rule of an edge, reordering and decaying once a period is over
+func (a *adaptiveOrder) record(rs *ruleSet, e edge, i int, valid bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r := a.rates(rs, e)
+	if r.rules != rs {
+		return
+	}
+
+	r.evaluated[i]++
+	if valid {
+		r.passed[i]++
+	}
+
+	r.evaluations++
+	if r.evaluations < a.period {
+		return
+	}
+
+	sort.SliceStable(r.order, func(x, y int) bool {
+		return r.rate(r.order[x]) > r.rate(r.order[y])
+	})
+
+	for i := range r.evaluated {
+		r.evaluated[i] /= 2
+		r.passed[i] /= 2
+	}
+	r.evaluations = 0
+}
+
+// rates returns the pass rates of an edge, starting over if its rules changed, a.mu must be held
+func (a *adaptiveOrder) rates(rs *ruleSet, e edge) *passRates {
+	r, ok := a.edges[e]
+	if ok && r.rules == rs {
+		return r
+	}
+
+	n := len(rs.byEdge[e])
+	r = &passRates{
+		rules:     rs,
+		evaluated: make([]float64, n),
+		passed:    make([]float64, n),
+		order:     make([]int, n),
+	}
+	for i := range r.order {
+		r.order[i] = i
+	}
+
+	a.edges[e] = r
+
+	return r
+}
+
+// rate estimates the pass rate of the i-th rule, rules without evaluations are assumed to pass half the time
+func (r *passRates) rate(i int) float64 {
+	return (r.passed[i] + 1) / (r.evaluated[i] + 2)
+}
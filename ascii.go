@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RenderASCII draws the states of the StateMachine as boxes with arrows to their targets, for quick inspection of
+// small machines in logs and terminals, the current state is drawn with a double border
+// Targets only reachable through guarded rules are marked with "?"
+//
+//	+---------+
+//	| Initial |-----> Backlog
+//	+---------+
+//	#=========#
+//	# Backlog #--+--> Canceled
+//	#=========#  +--> Progress ?
+func (sm *StateMachine) RenderASCII(w io.Writer) error {
+	for _, state := range sm.States() {
+		for _, line := range sm.asciiBox(state) {
+			_, err := fmt.Fprintln(w, strings.TrimRight(line, " "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// asciiBox returns the lines of the box of a state and its arrows
+func (sm *StateMachine) asciiBox(state State) []string {
+	corner, horizontal, vertical := "+", "-", "|"
+	if state == sm.state {
+		corner, horizontal, vertical = "#", "=", "#"
+	}
+
+	border := corner + strings.Repeat(horizontal, len(state)+2) + corner
+	lines := []string{
+		border,
+		vertical + " " + string(state) + " " + vertical,
+		border,
+	}
+
+	targets := sm.Targets(state)
+	for i, to := range targets {
+		arrow := "--+--> "
+		switch {
+		case len(targets) == 1:
+			arrow = "-----> "
+		case i > 0:
+			arrow = "  +--> "
+		}
+
+		target := string(to)
+		if guarded(sm.edgeRules(state, to)) {
+			target += " ?"
+		}
+
+		if i+1 >= len(lines) {
+			lines = append(lines, strings.Repeat(" ", len(border)))
+		}
+		lines[i+1] += arrow + target
+	}
+
+	return lines
+}
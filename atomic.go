@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var NotSimple = fmt.Errorf("error: state machine is not simple")
+
+// AtomicStateMachine is a lock-free StateMachine for definitions with SimpleTransitionRules only
+// The state is an atomic index into the states, and a transition is a compare-and-swap against the precompiled
+// table of allowed transitions, so it is safe for concurrent use without any locks
+// It does not record a history, run actions or collect coverage
+type AtomicStateMachine struct {
+	states  []State
+	indexes map[State]int32
+	allowed []bool
+	state   atomic.Int32
+}
+
+// NewAtomicStateMachine compiles a StateMachine into an AtomicStateMachine in the current state of sm
+// It fails with NotSimple if sm has rules other than SimpleTransitionRules, actions, a journal, coverage,
+// a shadow, entry limits, throttling, calendars, or records rejected transitions, as those can not be honored without locking
+func NewAtomicStateMachine(sm *StateMachine) (*AtomicStateMachine, error) {
+	for _, rule := range sm.loadRules().rules {
+		_, ok := rule.(*SimpleTransitionRule)
+		if !ok {
+			return nil, fmt.Errorf("rule: %v -> %v is %T, %w", rule.From(), rule.To(), rule, NotSimple)
+		}
+	}
+
+	for e, actions := range sm.actions {
+		if len(actions) > 0 {
+			return nil, fmt.Errorf("transition: %v -> %v has actions, %w", e.from, e.to, NotSimple)
+		}
+	}
+
+	for state, actions := range sm.entries {
+		if len(actions) > 0 {
+			return nil, fmt.Errorf("state: %v has entry actions, %w", state, NotSimple)
+		}
+	}
+
+	if len(sm.hooks.exit)+len(sm.hooks.transition)+len(sm.hooks.enter) > 0 {
+		return nil, fmt.Errorf("wildcard hooks are set, %w", NotSimple)
+	}
+
+	if sm.journal != nil || sm.coverage != nil || sm.shadow != nil || sm.recordRejected || len(sm.limits) > 0 || len(sm.throttles) > 0 || len(sm.calendars) > 0 {
+		return nil, fmt.Errorf("hooks are set, %w", NotSimple)
+	}
+
+	states := sm.States()
+	asm := &AtomicStateMachine{
+		states:  states,
+		indexes: make(map[State]int32, len(states)),
+		allowed: make([]bool, len(states)*len(states)),
+	}
+
+	for i, state := range states {
+		asm.indexes[state] = int32(i)
+	}
+
+	for _, rule := range sm.loadRules().rules {
+		asm.allowed[asm.indexes[rule.From()]*int32(len(states))+asm.indexes[rule.To()]] = true
+	}
+
+	asm.state.Store(asm.indexes[sm.State()])
+
+	return asm, nil
+}
+
+// State returns the current state of the AtomicStateMachine
+func (asm *AtomicStateMachine) State() State {
+	return asm.states[asm.state.Load()]
+}
+
+// Transition attempts to transition the AtomicStateMachine into a new State
+// If another transition wins the race, the transition is checked again from the state it transitioned into
+func (asm *AtomicStateMachine) Transition(to State) error {
+	next, ok := asm.indexes[to]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	for {
+		current := asm.state.Load()
+		if current == next {
+			return nil
+		}
+
+		if !asm.allowed[current*int32(len(asm.states))+next] {
+			return TransitionNotAllowed
+		}
+
+		if asm.state.CompareAndSwap(current, next) {
+			return nil
+		}
+	}
+}
+
+// TransitionFrom transitions the AtomicStateMachine into a new State only if it is still in the from state,
+// with a single compare-and-swap, e.g. for claiming work exactly once
+// It fails with TransitionNotAllowed if the AtomicStateMachine is in another state
+func (asm *AtomicStateMachine) TransitionFrom(from, to State) error {
+	current, ok := asm.indexes[from]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", from, StateNotFound)
+	}
+
+	next, ok := asm.indexes[to]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	if current != next && !asm.allowed[current*int32(len(asm.states))+next] {
+		return TransitionNotAllowed
+	}
+
+	if !asm.state.CompareAndSwap(current, next) {
+		return TransitionNotAllowed
+	}
+
+	return nil
+}
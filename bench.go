@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BenchConfig configures a load test run by Bench
+type BenchConfig struct {
+	Instances int
+	Workers   int
+	// Rate is the target number of transitions per second of all workers together, 0 means as fast as possible
+	Rate     float64
+	Duration time.Duration
+	Seed     int64
+	// Hotspots is the number of most contended instances to report
+	Hotspots int
+}
+
+// Hotspot is an instance transitions had to wait for, because other transitions of it were in progress
+type Hotspot struct {
+	ID          string
+	Transitions int
+	Wait        time.Duration
+}
+
+// BenchReport describes the outcome of a load test
+type BenchReport struct {
+	Transitions int
+	Rejected    int
+	Elapsed     time.Duration
+	PerSecond   float64
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+	Max         time.Duration
+	Hotspots    []Hotspot
+}
+
+// String returns a human-readable summary of the report
+func (r BenchReport) String() string {
+	sb := strings.Builder{}
+	_, _ = fmt.Fprintf(&sb, "%d transitions, %d rejected in %v: %.1f/s\n", r.Transitions, r.Rejected, r.Elapsed, r.PerSecond)
+	_, _ = fmt.Fprintf(&sb, "latency p50 %v, p90 %v, p99 %v, max %v\n", r.P50, r.P90, r.P99, r.Max)
+	for _, h := range r.Hotspots {
+		_, _ = fmt.Fprintf(&sb, "hotspot %v: %d transitions waited %v\n", h.ID, h.Transitions, h.Wait)
+	}
+
+	return sb.String()
+}
+
+// benchSample is the measurement of a single transition
+type benchSample struct {
+	id       string
+	latency  time.Duration
+	wait     time.Duration
+	rejected bool
+}
+
+// Bench load tests a definition: it creates Instances instances in a new Manager and drives random transitions
+// permitted by their rules on them from Workers goroutines at the target rate for Duration
+// Instances reaching a terminal state are replaced by new ones, so the load does not run dry
+func Bench(definition func() *StateMachine, config BenchConfig) BenchReport {
+	if config.Instances <= 0 {
+		config.Instances = 1
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	m := NewManager()
+	ids := make([]string, config.Instances)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("bench-%d", i)
+		_ = m.Add(ids[i], definition())
+	}
+
+	var interval time.Duration
+	if config.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(config.Workers) / config.Rate)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Duration)
+	defer cancel()
+
+	samples := make([][]benchSample, config.Workers)
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for w := 0; w < config.Workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewSource(config.Seed + int64(w)))
+			next := time.Now()
+			for ctx.Err() == nil {
+				if interval > 0 {
+					next = next.Add(interval)
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(time.Until(next)):
+					}
+				}
+
+				sample, ok := benchTransition(m, ids[rnd.Intn(len(ids))], rnd, definition)
+				if ok {
+					samples[w] = append(samples[w], sample)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	return benchReport(samples, time.Since(start), config.Hotspots)
+}
+
+// benchTransition transitions an instance into a random target of its current state, or replaces it by a new
+// instance if it has no targets, it is false if no transition was attempted, e.g. as another one was in progress
+func benchTransition(m *Manager, id string, rnd *rand.Rand, definition func() *StateMachine) (benchSample, bool) {
+	sample := benchSample{id: id}
+	attempted, terminal := false, false
+
+	start := time.Now()
+	err := m.dispatch(context.Background(), id, func(ctx context.Context, sm *StateMachine) error {
+		sample.wait = time.Since(start)
+
+		targets := sm.Targets(sm.State())
+		if len(targets) == 0 {
+			terminal = true
+
+			return nil
+		}
+
+		attempted = true
+
+		return sm.TransitionContext(ctx, targets[rnd.Intn(len(targets))])
+	})
+	sample.latency = time.Since(start)
+	sample.rejected = err != nil
+
+	if terminal {
+		_ = m.Remove(id)
+		_ = m.Add(id, definition())
+	}
+
+	return sample, attempted
+}
+
+// benchReport aggregates the samples of every worker
+func benchReport(samples [][]benchSample, elapsed time.Duration, hotspots int) BenchReport {
+	report := BenchReport{Elapsed: elapsed}
+
+	var latencies []time.Duration
+	byID := map[string]*Hotspot{}
+	for _, worker := range samples {
+		for _, sample := range worker {
+			report.Transitions++
+			if sample.rejected {
+				report.Rejected++
+			}
+
+			latencies = append(latencies, sample.latency)
+
+			h, ok := byID[sample.id]
+			if !ok {
+				h = &Hotspot{ID: sample.id}
+				byID[sample.id] = h
+			}
+			h.Transitions++
+			h.Wait += sample.wait
+		}
+	}
+
+	if len(latencies) == 0 {
+		return report
+	}
+
+	// dwellStats sorts the latencies, so the last one is the maximum
+	stats := dwellStats(latencies)
+	report.PerSecond = float64(report.Transitions) / elapsed.Seconds()
+	report.P50, report.P90, report.P99 = stats.P50, stats.P90, stats.P99
+	report.Max = latencies[len(latencies)-1]
+
+	for _, h := range byID {
+		report.Hotspots = append(report.Hotspots, *h)
+	}
+
+	sort.Slice(report.Hotspots, func(i, j int) bool {
+		if report.Hotspots[i].Wait != report.Hotspots[j].Wait {
+			return report.Hotspots[i].Wait > report.Hotspots[j].Wait
+		}
+
+		return report.Hotspots[i].ID < report.Hotspots[j].ID
+	})
+
+	if len(report.Hotspots) > hotspots {
+		report.Hotspots = report.Hotspots[:hotspots]
+	}
+
+	return report
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+)
+
+var (
+	NoDeployment = fmt.Errorf("error: no definition deployed")
+)
+
+// deployment is a definition version instances can be created from
+type deployment struct {
+	version    string
+	definition func() *StateMachine
+}
+
+// Deploy makes definition the green version new instances are created from by Create
+// The previously green version turns blue: its instances finish on it, unless they are moved to green by Cutover
+// Instances still on the previously blue version keep it
+func (m *Manager) Deploy(version string, definition func() *StateMachine) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.blue = m.green
+	m.green = &deployment{version: version, definition: definition}
+}
+
+// Create registers a new instance of the green version under the given ID
+func (m *Manager) Create(id string) error {
+	m.mu.RLock()
+	green := m.green
+	m.mu.RUnlock()
+
+	if green == nil {
+		return fmt.Errorf("instance: %v, %w", id, NoDeployment)
+	}
+
+	sm := green.definition()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.add(id, sm, green.version)
+}
+
+// Version returns the definition version of the instance with the given ID, empty for instances added by Add
+func (m *Manager) Version(id string) (string, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return "", err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return inst.version, nil
+}
+
+// BlueRemaining returns the IDs of the instances of the blue version which are not finished yet,
+// i.e. not in a terminal state, in alphabetical order
+func (m *Manager) BlueRemaining() []string {
+	m.mu.RLock()
+	blue := m.blue
+	m.mu.RUnlock()
+
+	if blue == nil {
+		return nil
+	}
+
+	var ids []string
+	for _, id := range m.IDs() {
+		inst, err := m.instance(id)
+		if err != nil {
+			continue
+		}
+
+		inst.mu.Lock()
+		if inst.version == blue.version && len(inst.sm.Targets(inst.sm.State())) > 0 {
+			ids = append(ids, id)
+		}
+		inst.mu.Unlock()
+	}
+
+	return ids
+}
+
+// Cutover moves every instance of the blue version to the green version, keeping their states and histories,
+// instead of waiting for them to finish
+// It fails without changing anything if the green version does not have the state of a blue instance, the blue
+// instances can not transition while they are checked and moved
+func (m *Manager) Cutover() error {
+	m.mu.RLock()
+	blue, green := m.blue, m.green
+	m.mu.RUnlock()
+
+	if blue == nil || green == nil {
+		return NoDeployment
+	}
+
+	var ids []string
+	var moving []*instance
+	for _, id := range m.IDs() {
+		inst, err := m.instance(id)
+		if err != nil {
+			continue
+		}
+
+		inst.mu.Lock()
+		if inst.version == blue.version {
+			ids = append(ids, id)
+			moving = append(moving, inst)
+		}
+		inst.mu.Unlock()
+	}
+
+	definitions := make([]*StateMachine, len(moving))
+	for i := range moving {
+		definitions[i] = green.definition()
+	}
+
+	for _, inst := range moving {
+		inst.mu.Lock()
+		defer inst.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.blue != blue || m.green != green {
+		return fmt.Errorf("deployment changed during cutover")
+	}
+
+	var stranded []string
+	for i, inst := range moving {
+		if m.instances[ids[i]] != inst || inst.version != blue.version {
+			continue
+		}
+
+		if _, ok := definitions[i].states[inst.sm.State()]; !ok {
+			stranded = append(stranded, ids[i])
+		}
+	}
+
+	if len(stranded) > 0 {
+		return fmt.Errorf("instances: %v, %w", stranded, InstancesStranded)
+	}
+
+	for i, inst := range moving {
+		if m.instances[ids[i]] != inst || inst.version != blue.version {
+			continue
+		}
+
+		inst.redefine(definitions[i])
+		inst.version = green.version
+	}
+
+	m.blue = nil
+
+	return nil
+}
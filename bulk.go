@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync"
+)
+
+// SetBulkParallelism sets how many transitions of a bulk operation may run at the same time, at least one
+func (m *Manager) SetBulkParallelism(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	m.bulk = n
+}
+
+// TransitionMany attempts to transition every instance with the given IDs into a new State concurrently,
+// running at most as many transitions at the same time as the bulk parallelism allows
+// The result maps every ID to the error of its transition, which is nil for successful transitions
+func (m *Manager) TransitionMany(ids []string, to State, params ...interface{}) map[string]error {
+	results := make(map[string]error, len(ids))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, m.bulk)
+
+	for _, id := range ids {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			err := m.Transition(id, to, params...)
+
+			mu.Lock()
+			results[id] = err
+			mu.Unlock()
+		}(id)
+	}
+
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// EventBus delivers events to every subscribed StateMachine
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers []*StateMachine
+	atomic      bool
+}
+
+// NewEventBus creates a new EventBus
+// If atomic is true, an event is only applied if every subscriber handling it allows the transition
+func NewEventBus(atomic bool) *EventBus {
+	return &EventBus{
+		atomic: atomic,
+	}
+}
+
+// Subscribe adds a StateMachine to the subscribers of the EventBus
+func (b *EventBus) Subscribe(sm *StateMachine) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, sm)
+}
+
+// Unsubscribe removes a StateMachine from the subscribers of the EventBus
+func (b *EventBus) Unsubscribe(sm *StateMachine) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, subscriber := range b.subscribers {
+		if subscriber == sm {
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+
+			return
+		}
+	}
+}
+
+// Fire delivers the event to every subscriber which handles it in its current state,
+// subscribers which do not handle the event are skipped
+// In atomic mode either every handling subscriber transitions or none of them does,
+// otherwise every subscriber which allows the transition transitions
+// The errors of the rejecting subscribers and of failing actions are returned joined
+func (b *EventBus) Fire(event Event, params ...interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var handling []*StateMachine
+	for _, sm := range b.subscribers {
+		if sm.Handles(event) {
+			handling = append(handling, sm)
+		}
+	}
+
+	if !b.atomic {
+		var errs []error
+		for _, sm := range handling {
+			err := sm.Fire(event, params...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+
+	ctx := context.Background()
+
+	var errs []error
+	for _, sm := range handling {
+		claimed, err := sm.claim(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("event: %v, %w", event, err))
+
+			continue
+		}
+		if claimed {
+			defer sm.busy.Store(false)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	prepared := make([]TransitionEvent, len(handling))
+	results := make([]error, len(handling))
+	reports := make([]func(err error), len(handling))
+	for i, sm := range handling {
+		sm.final = true
+
+		to, ok := sm.target(event, params...)
+		if !ok {
+			results[i] = fmt.Errorf("event: %v, state: %v, %w", event, sm.state, EventNotHandled)
+			errs = append(errs, results[i])
+
+			continue
+		}
+
+		if to == sm.state {
+			continue
+		}
+
+		reports[i] = sm.trace(to, params)
+
+		sm.firing = event
+		transition, err := sm.prepare(ctx, to, params...)
+		if fallback, ok := sm.fallback(event); ok && fallback != to && errors.Is(err, TransitionNotAllowed) {
+			if fallback == sm.state {
+				continue
+			}
+
+			sm.firing = event
+			transition, err = sm.prepare(ctx, fallback, params...)
+		}
+
+		if err != nil {
+			results[i] = fmt.Errorf("event: %v, %w", event, err)
+			errs = append(errs, results[i])
+		}
+
+		prepared[i] = transition
+	}
+
+	if len(errs) > 0 {
+		aborted := errors.Join(errs...)
+		for i, report := range reports {
+			if report == nil {
+				continue
+			}
+
+			if results[i] != nil {
+				report(results[i])
+			} else {
+				report(aborted)
+			}
+		}
+
+		return aborted
+	}
+
+	for i, sm := range handling {
+		var err error
+		if prepared[i].Result == Allowed {
+			err = sm.commit(ctx, prepared[i])
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if reports[i] != nil {
+			reports[i](err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	OutsideWindow      = fmt.Errorf("error: outside of the transition window")
+	TransitionDeferred = fmt.Errorf("error: transition deferred")
+)
+
+// deferredTimer is the timer kind of transitions deferred to the next window of their calendar
+const deferredTimer = "deferred"
+
+// staleTimer is returned for the timers of instances which left the state the timer was set in
+var staleTimer = fmt.Errorf("error: stale timer")
+
+// calendarHorizon is how far calendars look ahead for the next window before giving up
+const calendarHorizon = 5 * 366 * 24 * time.Hour
+
+// Calendar decides when transitions may take place, e.g. business hours without holidays
+type Calendar interface {
+	// Open is true if transitions may take place at t
+	Open(t time.Time) bool
+	// Next returns the earliest time at or after t when the calendar is open, the zero time if it never opens again
+	Next(t time.Time) time.Time
+}
+
+// BusinessHours is a Calendar open on some days of the week between two times of the day, e.g. Monday to Friday
+// from 9:00 to 17:00, Start and End are measured from midnight in Location, UTC if it is nil
+type BusinessHours struct {
+	Days     []time.Weekday
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// Open is true during the business hours
+func (b BusinessHours) Open(t time.Time) bool {
+	midnight := b.midnight(t)
+	offset := t.Sub(midnight)
+
+	return b.day(midnight.Weekday()) && offset >= b.Start && offset < b.End
+}
+
+// Next returns the start of the next business hours if t is outside of them
+func (b BusinessHours) Next(t time.Time) time.Time {
+	if b.Open(t) {
+		return t
+	}
+
+	midnight := b.midnight(t)
+	for i := 0; i <= 7; i++ {
+		day := midnight.AddDate(0, 0, i)
+		start := day.Add(b.Start)
+		if b.day(day.Weekday()) && b.Start < b.End && !start.Before(t) {
+			return start
+		}
+	}
+
+	return time.Time{}
+}
+
+// midnight returns the start of the day of t in the location of the business hours
+func (b BusinessHours) midnight(t time.Time) time.Time {
+	location := b.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	local := t.In(location)
+
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+}
+
+// day is true if the business hours include the weekday
+func (b BusinessHours) day(weekday time.Weekday) bool {
+	for _, d := range b.Days {
+		if d == weekday {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Holidays is a Calendar closed on a list of dates, combine it with other calendars using AllOf
+type Holidays struct {
+	dates    map[string]bool
+	location *time.Location
+}
+
+// NewHolidays creates a new Holidays closed on the days of dates in location, UTC if it is nil
+func NewHolidays(location *time.Location, dates ...time.Time) *Holidays {
+	if location == nil {
+		location = time.UTC
+	}
+
+	h := &Holidays{dates: map[string]bool{}, location: location}
+	for _, date := range dates {
+		h.dates[h.key(date)] = true
+	}
+
+	return h
+}
+
+// Open is true if t is not on a holiday
+func (h *Holidays) Open(t time.Time) bool {
+	return !h.dates[h.key(t)]
+}
+
+// Next returns the start of the first day after t which is not a holiday if t is on a holiday
+func (h *Holidays) Next(t time.Time) time.Time {
+	for i := 0; i <= len(h.dates); i++ {
+		if h.Open(t) {
+			return t
+		}
+
+		local := t.In(h.location)
+		t = time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, h.location)
+	}
+
+	return time.Time{}
+}
+
+// key returns the date of t in the location of the holidays
+func (h *Holidays) key(t time.Time) string {
+	return t.In(h.location).Format(time.DateOnly)
+}
+
+// allOf is a Calendar open when all of its calendars are open
+type allOf []Calendar
+
+// AllOf combines calendars into one which is open only when all of them are, e.g. business hours without holidays
+func AllOf(calendars ...Calendar) Calendar {
+	return allOf(calendars)
+}
+
+// Open is true if every calendar is open
+func (a allOf) Open(t time.Time) bool {
+	for _, calendar := range a {
+		if !calendar.Open(t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Next returns the earliest time at or after t when every calendar is open
+func (a allOf) Next(t time.Time) time.Time {
+	limit := t.Add(calendarHorizon)
+	for t.Before(limit) {
+		moved := false
+		for _, calendar := range a {
+			next := calendar.Next(t)
+			if next.IsZero() {
+				return time.Time{}
+			}
+
+			if next.After(t) {
+				t = next
+				moved = true
+			}
+		}
+
+		if !moved {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// CronWindow is a Calendar open for a duration after every time matching a cron schedule, e.g. "0 22 * * *" for
+// 2 hours is open from 22:00 to midnight every day
+// The schedule has the five standard fields: minute, hour, day of month, month and day of week, each field is *,
+// a number, a range a-b, a step */n or a-b/n, or a comma separated list of them
+type CronWindow struct {
+	fields   [5]map[int]bool
+	any      [5]bool
+	duration time.Duration
+	location *time.Location
+}
+
+// cronBounds are the bounds of the fields of a cron schedule
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// NewCronWindow creates a new CronWindow, the schedule is evaluated in location, UTC if it is nil
+func NewCronWindow(schedule string, duration time.Duration, location *time.Location) (*CronWindow, error) {
+	parts := strings.Fields(schedule)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("schedule %q has %d fields instead of 5, %w", schedule, len(parts), InvalidDefinition)
+	}
+
+	if duration <= 0 {
+		return nil, fmt.Errorf("schedule %q has no duration, %w", schedule, InvalidDefinition)
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	w := &CronWindow{duration: duration, location: location}
+	for i, part := range parts {
+		values, err := parseCronField(part, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q, field %d: %w", schedule, i+1, err)
+		}
+
+		w.fields[i] = values
+		w.any[i] = part == "*"
+	}
+
+	return w, nil
+}
+
+// parseCronField parses a field of a cron schedule into the set of values it matches
+func parseCronField(field string, low, high int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return nil, fmt.Errorf("invalid step %q, %w", part, InvalidDefinition)
+			}
+
+			step = s
+			part = part[:i]
+		}
+
+		from, to := low, high
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			from, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q, %w", part, InvalidDefinition)
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				to, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q, %w", part, InvalidDefinition)
+				}
+			}
+		}
+
+		if from < low || to > high || from > to {
+			return nil, fmt.Errorf("value %q out of range %d-%d, %w", part, low, high, InvalidDefinition)
+		}
+
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
+
+// matches is true if the minute of t matches the schedule
+func (w *CronWindow) matches(t time.Time) bool {
+	return w.fields[0][t.Minute()] && w.fields[1][t.Hour()] && w.fields[3][int(t.Month())] && w.dayMatches(t)
+}
+
+// dayMatches is true if the day of t matches the schedule, like cron, a day matches its day of month or its day of
+// week if both are restricted
+func (w *CronWindow) dayMatches(t time.Time) bool {
+	dom, dow := w.fields[2][t.Day()], w.fields[4][int(t.Weekday())]
+	if w.any[2] || w.any[4] {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// Open is true if a time matching the schedule is at most the duration before t
+func (w *CronWindow) Open(t time.Time) bool {
+	local := t.In(w.location)
+	for m := local.Truncate(time.Minute); local.Sub(m) < w.duration; m = m.Add(-time.Minute) {
+		if w.matches(m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Next returns the next time matching the schedule if t is outside of a window
+func (w *CronWindow) Next(t time.Time) time.Time {
+	if w.Open(t) {
+		return t
+	}
+
+	m := t.In(w.location).Truncate(time.Minute).Add(time.Minute)
+	limit := m.Add(calendarHorizon)
+	for m.Before(limit) {
+		switch {
+		case !w.fields[3][int(m.Month())]:
+			m = time.Date(m.Year(), m.Month()+1, 1, 0, 0, 0, 0, w.location)
+		case !w.dayMatches(m):
+			m = time.Date(m.Year(), m.Month(), m.Day()+1, 0, 0, 0, 0, w.location)
+		case !w.fields[1][m.Hour()]:
+			m = time.Date(m.Year(), m.Month(), m.Day(), m.Hour()+1, 0, 0, 0, w.location)
+		case !w.fields[0][m.Minute()]:
+			m = m.Add(time.Minute)
+		default:
+			return m
+		}
+	}
+
+	return time.Time{}
+}
+
+// SetCalendar gates the transitions between two states by a calendar, e.g. Approved -> Dispatched only during
+// business hours, transitions attempted while it is closed are rejected with OutsideWindow before their rules are
+// evaluated, Managers defer them to the next window instead, nil removes the calendar
+func (sm *StateMachine) SetCalendar(from, to State, calendar Calendar) error {
+	if sm.final {
+		return fmt.Errorf("calendars must be defined before finalization")
+	}
+
+	_, ok := sm.states[from]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", from, StateNotFound)
+	}
+
+	_, ok = sm.states[to]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	e := edge{from: from, to: to}
+	if calendar == nil {
+		delete(sm.calendars, e)
+
+		return nil
+	}
+
+	if sm.calendars == nil {
+		sm.calendars = map[edge]Calendar{}
+	}
+
+	sm.calendars[e] = calendar
+
+	return nil
+}
+
+// closed returns the next window of a transition between two states, false if the transition may be taken at now
+func (sm *StateMachine) closed(from, to State, now time.Time) (time.Time, bool) {
+	calendar, ok := sm.calendars[edge{from: from, to: to}]
+	if !ok || calendar.Open(now) {
+		return time.Time{}, false
+	}
+
+	return calendar.Next(now), true
+}
+
+// deferred runs a transition of an instance through dispatch, deferring it to the next window of its calendar if
+// the calendar is closed, event is the event fired by the transition, if any
+// The timer of a deferred transition is keyed by the instance and the event or state it was deferred for, so that
+// deferring it again replaces the timer
+func (m *Manager) deferred(ctx context.Context, id string, event Event, transition func(ctx context.Context, sm *StateMachine) (State, error), params []interface{}) error {
+	var from, to State
+	var next time.Time
+	err := m.dispatch(ctx, id, func(ctx context.Context, sm *StateMachine) error {
+		from = sm.State()
+
+		var err error
+		to, err = transition(ctx, sm)
+		if errors.Is(err, OutsideWindow) {
+			next, _ = sm.closed(from, to, sm.clock.Now())
+		}
+
+		return err
+	})
+	if next.IsZero() {
+		return err
+	}
+
+	trigger := "state#" + string(to)
+	if event != "" {
+		trigger = "event#" + string(event)
+	}
+
+	timer := Timer{
+		ID:       fmt.Sprintf("%s#%s#%s", id, deferredTimer, trigger),
+		Instance: id,
+		Kind:     deferredTimer,
+		From:     from,
+		State:    to,
+		Event:    event,
+		Due:      next,
+		Params:   params,
+	}
+
+	saveErr := m.timerStore.SaveTimer(timer)
+	if saveErr != nil {
+		return errors.Join(err, fmt.Errorf("instance: %v, %w", id, saveErr))
+	}
+
+	return fmt.Errorf("instance: %v, transition into %v deferred until %v, %w", id, to, next.Format(time.RFC3339), TransitionDeferred)
+}
+
+// transitionDue transitions an instance whose deferred or scheduled transition is due, firing the event of the timer
+// if it has one, so that its hooks, choices and fallbacks are evaluated again
+// Timers of instances which left the state the timer was set in are stale, they are done with like transitions
+// deferred again, no longer allowed or of removed instances
+func (m *Manager) transitionDue(ctx context.Context, timer Timer) error {
+	err := m.deferred(ctx, timer.Instance, timer.Event, func(ctx context.Context, sm *StateMachine) (State, error) {
+		if timer.From != "" && sm.State() != timer.From {
+			return timer.State, fmt.Errorf("state: %v, timer set in %v, %w", sm.State(), timer.From, staleTimer)
+		}
+
+		if timer.Event != "" {
+			return sm.fire(ctx, timer.Event, timer.Params...)
+		}
+
+		return timer.State, sm.TransitionContext(ctx, timer.State, timer.Params...)
+	}, timer.Params)
+	if errors.Is(err, staleTimer) || errors.Is(err, TransitionDeferred) || errors.Is(err, TransitionNotAllowed) || errors.Is(err, InstanceNotFound) {
+		return nil
+	}
+
+	return err
+}
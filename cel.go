@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// CELType is the type of a variable declared for CEL expressions, named as in CEL
+type CELType string
+
+// CEL types of the declared variables
+const (
+	CELBool     CELType = "bool"
+	CELInt      CELType = "int"
+	CELDouble   CELType = "double"
+	CELString   CELType = "string"
+	CELDuration CELType = "duration"
+	CELMap      CELType = "map"
+	CELDyn      CELType = "dyn"
+)
+
+// CELEnvironment type-checks and compiles CEL expressions against the declared variables, it is implemented by adapters
+// of github.com/google/cel-go, which keeps the dependency out of this package
+type CELEnvironment interface {
+	Compile(expression string, variables map[string]CELType) (CELProgram, error)
+}
+
+// CELProgram is a compiled CEL expression evaluating to a bool
+type CELProgram interface {
+	Eval(activation map[string]interface{}) (bool, error)
+}
+
+// CELEngine compiles guards written as CEL expressions over a typed parameter map,
+// e.g. `amount <= approver.limit && region == "EU"`
+// The names of the parameter map are declared as variables next to "from", "to" and the built-in timers, the
+// transition passes the values as a map[string]interface{} param
+// Compiled expressions are cached, so that rules sharing a guard or reloading a definition only compile it once
+type CELEngine struct {
+	env       CELEnvironment
+	variables map[string]CELType
+	mu        sync.Mutex
+	cache     map[string]CELProgram
+}
+
+// NewCELEngine creates a new CELEngine declaring the typed parameter map params
+func NewCELEngine(env CELEnvironment, params map[string]CELType) (*CELEngine, error) {
+	variables := map[string]CELType{
+		"from":           CELString,
+		"to":             CELString,
+		TimerTimeInState: CELDuration,
+		TimerAge:         CELDuration,
+	}
+	for name, typ := range params {
+		if _, ok := variables[name]; ok {
+			return nil, fmt.Errorf("param %q: name is reserved", name)
+		}
+
+		variables[name] = typ
+	}
+
+	return &CELEngine{
+		env:       env,
+		variables: variables,
+		cache:     map[string]CELProgram{},
+	}, nil
+}
+
+// Compile compiles a CEL expression, or retrieves it from the cache if it was compiled before
+func (e *CELEngine) Compile(expression string) (CELProgram, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if program, ok := e.cache[expression]; ok {
+		return program, nil
+	}
+
+	program, err := e.env.Compile(expression, e.variables)
+	if err != nil {
+		return nil, fmt.Errorf("compiling CEL expression %q: %w", expression, err)
+	}
+
+	e.cache[expression] = program
+
+	return program, nil
+}
+
+// ScriptEngine adapts the CELEngine to a ScriptEngine, e.g. to register it with RegisterScriptEngine
+func (e *CELEngine) ScriptEngine() ScriptEngine {
+	return celScriptEngine{engine: e}
+}
+
+// celScriptEngine compiles guard scripts as CEL expressions
+type celScriptEngine struct {
+	engine *CELEngine
+}
+
+// Compile compiles a guard script as a CEL expression
+func (e celScriptEngine) Compile(source string) (Script, error) {
+	program, err := e.engine.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return celScript{program: program}, nil
+}
+
+// celScript evaluates a CEL expression as a guard script
+type celScript struct {
+	program CELProgram
+}
+
+// Eval evaluates the CEL expression with the variables of the guard script
+func (s celScript) Eval(vars map[string]interface{}) (bool, error) {
+	return s.program.Eval(celActivation(vars))
+}
+
+// celActivation flattens the variables of a guard into the declared CEL variables, states become strings and the
+// first map[string]interface{} param is the parameter map
+func celActivation(vars map[string]interface{}) map[string]interface{} {
+	activation := make(map[string]interface{}, len(vars))
+	for name, value := range vars {
+		if state, ok := value.(State); ok {
+			value = string(state)
+		}
+
+		activation[name] = value
+	}
+
+	params, _ := activation["params"].([]interface{})
+	delete(activation, "params")
+
+	for _, param := range params {
+		values, ok := param.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for name, value := range values {
+			if _, ok := activation[name]; !ok {
+				activation[name] = value
+			}
+		}
+
+		break
+	}
+
+	return activation
+}
+
+// CELTransitionRule allows the transition between two states only if its CEL expression evaluates to true
+type CELTransitionRule struct {
+	from    State
+	to      State
+	program CELProgram
+}
+
+// NewCELTransitionRule creates a new CELTransitionRule
+func NewCELTransitionRule(from, to State, program CELProgram) *CELTransitionRule {
+	return &CELTransitionRule{
+		from:    from,
+		to:      to,
+		program: program,
+	}
+}
+
+// From retrieves the start state the transition rule applies to
+func (r *CELTransitionRule) From() State {
+	return r.from
+}
+
+// To retrieves the end state the transition rule applies to
+func (r *CELTransitionRule) To() State {
+	return r.to
+}
+
+// Valid is true if transitioning between two states is allowed, evaluated without a StateMachine the timers are zero
+// An expression failing to evaluate, e.g. because the parameter map misses a variable, denies the transition
+func (r *CELTransitionRule) Valid(from, to State, params ...interface{}) bool {
+	return r.ValidIn(MachineView{state: from}, from, to, params...)
+}
+
+// ValidIn is true if transitioning between two states of the viewed StateMachine is allowed
+func (r *CELTransitionRule) ValidIn(view MachineView, from, to State, params ...interface{}) bool {
+	if from != r.from || to != r.to {
+		return false
+	}
+
+	vars := map[string]interface{}{
+		"from":   from,
+		"to":     to,
+		"params": params,
+	}
+	for name, value := range view.Timers() {
+		vars[name] = value
+	}
+
+	valid, err := r.program.Eval(celActivation(vars))
+
+	return err == nil && valid
+}
+
+// celRuleDefinition is a rule in a CEL rules file
+type celRuleDefinition struct {
+	From  State  `json:"from"`
+	To    State  `json:"to"`
+	Guard string `json:"guard"`
+}
+
+// LoadCELRules reads a declarative rules file, a JSON array of objects with "from", "to" and "guard" keys, and
+// compiles the guards as CEL expressions, so that invalid guards are reported at load time
+func LoadCELRules(r io.Reader, engine *CELEngine) ([]*CELTransitionRule, error) {
+	var definitions []celRuleDefinition
+	err := json.NewDecoder(r).Decode(&definitions)
+	if err != nil {
+		return nil, fmt.Errorf("decoding rules file: %w", err)
+	}
+
+	rules := make([]*CELTransitionRule, 0, len(definitions))
+	for i, definition := range definitions {
+		program, err := engine.Compile(definition.Guard)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%v -> %v): %w", i, definition.From, definition.To, err)
+		}
+
+		rules = append(rules, NewCELTransitionRule(definition.From, definition.To, program))
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// Checkpoint is the runtime of a Manager written by SaveTo: its instances, its pending timers and the events
+// queued in the Mailboxes it watches, see WatchQueue
+type Checkpoint struct {
+	Instances []StoredInstance
+	Timers    []Timer
+	Queues    map[string][]QueuedEvent
+}
+
+// SaveTo writes a Checkpoint of the Manager to w in the compact binary gob encoding, e.g. on shutdown
+// Params of custom types must be registered with gob.Register
+func (m *Manager) SaveTo(w io.Writer) error {
+	checkpoint := Checkpoint{Queues: map[string][]QueuedEvent{}}
+
+	for _, id := range m.IDs() {
+		instance, err := m.stored(id)
+		if err != nil {
+			continue
+		}
+
+		checkpoint.Instances = append(checkpoint.Instances, instance)
+	}
+
+	timers, err := m.timerStore.Timers()
+	if err != nil {
+		return fmt.Errorf("loading timers: %w", err)
+	}
+
+	checkpoint.Timers = timers
+
+	m.mu.RLock()
+	for name, mb := range m.queues {
+		checkpoint.Queues[name] = mb.queued()
+	}
+	m.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+
+	err = gob.NewEncoder(bw).Encode(checkpoint)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+
+	return bw.Flush()
+}
+
+// LoadFrom restores a Checkpoint written by SaveTo into the Manager
+// The instances are recreated from definitions by their versions, falling back to the deployed versions, see Deploy,
+// instances added by Add have the empty version, nothing is restored if any version is missing
+// Queued events are restored into the Mailboxes watched under the same names, which must be watched beforehand,
+// they have no caller waiting for their results
+func (m *Manager) LoadFrom(r io.Reader, definitions map[string]func() *StateMachine) error {
+	var checkpoint Checkpoint
+
+	err := gob.NewDecoder(bufio.NewReader(r)).Decode(&checkpoint)
+	if err != nil {
+		return fmt.Errorf("decoding checkpoint: %w", err)
+	}
+
+	m.mu.Lock()
+	machines := make([]*StateMachine, len(checkpoint.Instances))
+	for i, instance := range checkpoint.Instances {
+		definition, ok := definitions[instance.Version]
+		if !ok {
+			definition, ok = m.deployed(instance.Version)
+		}
+
+		if !ok {
+			m.mu.Unlock()
+
+			return fmt.Errorf("instance: %v, version: %q, %w", instance.ID, instance.Version, NoDeployment)
+		}
+
+		machines[i] = definition()
+		machines[i].state = instance.State
+		machines[i].history = instance.History
+		machines[i].metadata = instance.Metadata
+	}
+
+	for i, instance := range checkpoint.Instances {
+		err = m.add(instance.ID, machines[i], instance.Version)
+		if err != nil {
+			m.mu.Unlock()
+
+			return err
+		}
+	}
+
+	queues := make(map[string]*Mailbox, len(m.queues))
+	for name, mb := range m.queues {
+		queues[name] = mb
+	}
+	m.mu.Unlock()
+
+	for _, timer := range checkpoint.Timers {
+		err = m.timerStore.SaveTimer(timer)
+		if err != nil {
+			return fmt.Errorf("timer: %v, %w", timer.ID, err)
+		}
+	}
+
+	for name, events := range checkpoint.Queues {
+		mb, ok := queues[name]
+		if !ok {
+			return fmt.Errorf("queue %v is not watched", name)
+		}
+
+		mb.mu.Lock()
+		mb.restore(events)
+		mb.mu.Unlock()
+	}
+
+	return nil
+}
+
+// deployed returns the definition of a deployed version, m.mu must be held
+func (m *Manager) deployed(version string) (func() *StateMachine, bool) {
+	for _, d := range []*deployment{m.green, m.blue} {
+		if d != nil && d.version == version {
+			return d.definition, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Choice is a candidate target of an event defined by AddChoice, it is chosen if its guard accepts the params the
+// event is fired with
+type Choice struct {
+	To    State
+	Guard func(params ...interface{}) bool
+}
+
+// AddChoice defines that firing event in the from state transitions the StateMachine into the target of the first
+// choice whose guard accepts the params, or into the otherwise state if none of them does, e.g. routing a reviewed
+// claim into approved, escalated or rejected
+// The chosen transition itself still has to be allowed by the rules
+func (sm *StateMachine) AddChoice(event Event, from, otherwise State, choices ...Choice) error {
+	if sm.final {
+		return fmt.Errorf("events must be defined before finalization")
+	}
+
+	for i, choice := range choices {
+		_, ok := sm.states[choice.To]
+		if !ok {
+			return fmt.Errorf("choice %d, state: %v, %w", i, choice.To, StateNotFound)
+		}
+
+		if choice.Guard == nil {
+			return fmt.Errorf("choice %d: %v has no guard, %w", i, choice.To, InvalidDefinition)
+		}
+	}
+
+	err := sm.AddEvent(event, from, otherwise)
+	if err != nil {
+		return err
+	}
+
+	if len(choices) == 0 {
+		return nil
+	}
+
+	if sm.choices == nil {
+		sm.choices = map[trigger][]Choice{}
+	}
+
+	sm.choices[trigger{event: event, from: from}] = append([]Choice(nil), choices...)
+
+	return nil
+}
+
+// target returns the state firing event in the current state leads to with the given params, false if the event is
+// not handled in the current state
+func (sm *StateMachine) target(event Event, params ...interface{}) (State, bool) {
+	t := trigger{event: event, from: sm.state}
+
+	to, ok := sm.events[t]
+	if !ok {
+		return "", false
+	}
+
+	return choose(to, sm.choices[t], params...), true
+}
+
+// choose returns the target of the first choice whose guard accepts the params, otherwise if there is none
+func choose(otherwise State, choices []Choice, params ...interface{}) State {
+	for _, choice := range choices {
+		if choice.Guard(params...) {
+			return choice.To
+		}
+	}
+
+	return otherwise
+}
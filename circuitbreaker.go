@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var CircuitBreakerOpen = fmt.Errorf("error: circuit breaker open")
+
+const (
+	// CircuitClosed lets every call through and counts consecutive failures
+	CircuitClosed State = "Closed"
+	// CircuitOpen rejects every call until the recovery timeout passes
+	CircuitOpen State = "Open"
+	// CircuitHalfOpen lets a trial call through to decide whether to close or re-open the circuit
+	CircuitHalfOpen State = "HalfOpen"
+)
+
+// CircuitBreaker is a prebuilt StateMachine protecting calls to an unreliable dependency
+// Closed -> Open is guarded by the number of consecutive failures,
+// Open -> HalfOpen is a timed transition which is only allowed after the recovery timeout passed
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	sm        *StateMachine
+	clock     Clock
+	threshold int
+	timeout   time.Duration
+	failures  int
+	openedAt  time.Time
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker which opens after threshold consecutive failures
+// and attempts to recover after timeout
+func NewCircuitBreaker(threshold int, timeout time.Duration, clock Clock) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		sm:        NewStateMachine(CircuitClosed, CircuitOpen, CircuitHalfOpen),
+		clock:     clock,
+		threshold: threshold,
+		timeout:   timeout,
+	}
+
+	cb.sm.SetClock(clock)
+
+	rules := []TransitionRule{
+		NewConditionalTransitionRule(CircuitClosed, CircuitOpen, cb.tripped),
+		NewConditionalTransitionRule(CircuitOpen, CircuitHalfOpen, cb.recovered),
+		NewSimpleTransitionRule(CircuitHalfOpen, CircuitClosed),
+		NewSimpleTransitionRule(CircuitHalfOpen, CircuitOpen),
+	}
+	for _, rule := range rules {
+		_ = cb.sm.AddRule(rule)
+	}
+
+	return cb
+}
+
+// tripped is true if the number of consecutive failures reached the threshold
+func (cb *CircuitBreaker) tripped(params ...interface{}) bool {
+	return cb.failures >= cb.threshold
+}
+
+// recovered is true if the recovery timeout passed since the circuit was opened
+func (cb *CircuitBreaker) recovered(params ...interface{}) bool {
+	return !cb.clock.Now().Before(cb.openedAt.Add(cb.timeout))
+}
+
+// State returns the current state of the CircuitBreaker
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.sm.State()
+}
+
+// StateMachine returns the StateMachine backing the CircuitBreaker, e.g. for inspecting its history
+// It must not be transitioned directly
+func (cb *CircuitBreaker) StateMachine() *StateMachine {
+	return cb.sm
+}
+
+// Allow is true if a call may be made, an open circuit moves to HalfOpen once the recovery timeout passed
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.sm.State() == CircuitOpen {
+		_ = cb.sm.Transition(CircuitHalfOpen)
+	}
+
+	return cb.sm.State() != CircuitOpen
+}
+
+// Success records a successful call, closing a half-open circuit
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	_ = cb.sm.Transition(CircuitClosed)
+}
+
+// Failure records a failed call, opening the circuit if it is half-open or the threshold is reached
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+
+	if cb.sm.State() != CircuitOpen && cb.sm.Transition(CircuitOpen) == nil {
+		cb.openedAt = cb.clock.Now()
+	}
+}
+
+// Call calls fn if the circuit allows it and records the result
+// CircuitBreakerOpen is returned without calling fn if the circuit is open
+func (cb *CircuitBreaker) Call(fn func() error) error {
+	if !cb.Allow() {
+		return CircuitBreakerOpen
+	}
+
+	err := fn()
+	if err != nil {
+		cb.Failure()
+
+		return err
+	}
+
+	cb.Success()
+
+	return nil
+}
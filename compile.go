@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var InvalidDefinition = fmt.Errorf("error: invalid definition")
+
+// compiledEdge holds everything needed to evaluate and apply the transition between two states
+type compiledEdge struct {
+	rules       []TransitionRule
+	passThrough []bool
+	strategy    MatchStrategy
+	actions     []Action
+}
+
+// Representation decides how a CompiledStateMachine stores its transitions
+type Representation int
+
+const (
+	// Sparse keeps the transitions in a map, using memory proportional to the number of transitions
+	Sparse Representation = iota
+	// Dense keeps the transitions in an adjacency matrix with a bitset of existing transitions, using memory
+	// proportional to the square of the number of states, but checking transitions without hashing,
+	// it suits definitions where most pairs of states have rules, e.g. ones generated from matrices
+	Dense
+)
+
+// CompiledStateMachine is an immutable, validated runtime of a StateMachine definition
+// States are indexed, so the rules, the MatchStrategy and the actions of a transition are found by a single lookup
+// in the Representation set by SetRepresentation
+// It keeps no state of its own: the current state is passed in, and the resulting TransitionEvent returned,
+// so it is safe for concurrent use, e.g. by handlers of requests carrying the state of a stored entity
+type CompiledStateMachine struct {
+	initial   State
+	states    []State
+	indexes   map[State]int
+	sparse    map[int]*compiledEdge
+	matrix    []*compiledEdge
+	bits      []uint64
+	events    map[trigger]State
+	choices   map[trigger][]Choice
+	fallbacks map[trigger]State
+	clock     Clock
+}
+
+// Compile validates the definition of the StateMachine and compiles it into a CompiledStateMachine
+// Every problem is reported at once, wrapped in InvalidDefinition: events, actions and edge specific match
+// strategies of transitions without rules, which could never take effect, ViewRules and throttles, as a
+// CompiledStateMachine keeps no history or timers to view or throttle by, and calendars, as it cannot defer
+// transitions to their next window
+// Later changes of the StateMachine do not affect the CompiledStateMachine
+func (sm *StateMachine) Compile() (*CompiledStateMachine, error) {
+	states := sm.States()
+	c := &CompiledStateMachine{
+		initial:   sm.state,
+		states:    states,
+		indexes:   make(map[State]int, len(states)),
+		events:    make(map[trigger]State, len(sm.events)),
+		choices:   make(map[trigger][]Choice, len(sm.choices)),
+		fallbacks: make(map[trigger]State, len(sm.fallbacks)),
+		clock:     sm.clock,
+	}
+
+	for i, state := range states {
+		c.indexes[state] = i
+	}
+
+	if sm.representation == Dense {
+		c.matrix = make([]*compiledEdge, len(states)*len(states))
+		c.bits = make([]uint64, (len(c.matrix)+63)/64)
+	} else {
+		c.sparse = map[int]*compiledEdge{}
+	}
+
+	var errs []error
+	for _, from := range states {
+		for _, to := range states {
+			e := edge{from: from, to: to}
+			if _, ok := sm.throttles[e]; ok {
+				errs = append(errs, fmt.Errorf("transition: %v -> %v is throttled, %w", from, to, InvalidDefinition))
+			}
+
+			if _, ok := sm.calendars[e]; ok {
+				errs = append(errs, fmt.Errorf("transition: %v -> %v is gated by a calendar, %w", from, to, InvalidDefinition))
+			}
+
+			rules := sm.edgeRules(from, to)
+			if len(rules) == 0 {
+				if len(sm.actions[e]) > 0 {
+					errs = append(errs, fmt.Errorf("transition: %v -> %v has actions but no rules, %w", from, to, InvalidDefinition))
+				}
+				if _, ok := sm.edgeStrategies[e]; ok {
+					errs = append(errs, fmt.Errorf("transition: %v -> %v has a match strategy but no rules, %w", from, to, InvalidDefinition))
+				}
+
+				continue
+			}
+
+			if limit, ok := sm.limits[to]; ok && from != limit.overflow && len(sm.edgeRules(from, limit.overflow)) == 0 {
+				errs = append(errs, fmt.Errorf("transition: %v -> %v overflows into %v without rules, %w", from, to, limit.overflow, InvalidDefinition))
+			}
+
+			ce := &compiledEdge{
+				rules:       rules,
+				passThrough: make([]bool, len(rules)),
+				strategy:    sm.matchStrategy(from, to),
+				actions:     append([]Action(nil), sm.edgeActions(from, to)...),
+			}
+			for i, rule := range rules {
+				ce.passThrough[i] = isPassThrough(rule)
+
+				if _, ok := unwrap(rule).(ViewRule); ok {
+					errs = append(errs, fmt.Errorf("transition: %v -> %v, rule %d needs a view of the state machine, %w", from, to, i, InvalidDefinition))
+				}
+			}
+
+			c.store(c.indexes[from]*len(states)+c.indexes[to], ce)
+		}
+	}
+
+	triggers := make([]trigger, 0, len(sm.events))
+	for t := range sm.events {
+		triggers = append(triggers, t)
+	}
+
+	sort.Slice(triggers, func(i, j int) bool {
+		if triggers[i].event != triggers[j].event {
+			return triggers[i].event < triggers[j].event
+		}
+
+		return triggers[i].from < triggers[j].from
+	})
+
+	for _, t := range triggers {
+		to := sm.events[t]
+		if t.from != to && len(sm.edgeRules(t.from, to)) == 0 {
+			errs = append(errs, fmt.Errorf("event: %v, transition: %v -> %v has no rules, %w", t.event, t.from, to, InvalidDefinition))
+		}
+
+		for _, choice := range sm.choices[t] {
+			if t.from != choice.To && len(sm.edgeRules(t.from, choice.To)) == 0 {
+				errs = append(errs, fmt.Errorf("event: %v, choice: %v -> %v has no rules, %w", t.event, t.from, choice.To, InvalidDefinition))
+			}
+		}
+
+		if fallback, ok := sm.fallbacks[t]; ok {
+			if t.from != fallback && len(sm.edgeRules(t.from, fallback)) == 0 {
+				errs = append(errs, fmt.Errorf("event: %v, fallback: %v -> %v has no rules, %w", t.event, t.from, fallback, InvalidDefinition))
+			}
+
+			c.fallbacks[t] = fallback
+		}
+
+		c.events[t] = to
+		if choices, ok := sm.choices[t]; ok {
+			c.choices[t] = append([]Choice(nil), choices...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return c, nil
+}
+
+// SetRepresentation sets the Representation of the transitions compiled by Compile, Sparse by default
+func (sm *StateMachine) SetRepresentation(representation Representation) {
+	sm.representation = representation
+}
+
+// store sets the compiled transition at position i of the adjacency matrix
+func (c *CompiledStateMachine) store(i int, ce *compiledEdge) {
+	if c.matrix == nil {
+		c.sparse[i] = ce
+
+		return
+	}
+
+	c.matrix[i] = ce
+	c.bits[i/64] |= 1 << (i % 64)
+}
+
+// Initial returns the state the StateMachine was in when it was compiled
+func (c *CompiledStateMachine) Initial() State {
+	return c.initial
+}
+
+// States returns all existing states in alphabetical order
+func (c *CompiledStateMachine) States() []State {
+	return append([]State(nil), c.states...)
+}
+
+// edge returns the compiled transition between two states, it is nil if there are no rules for it
+func (c *CompiledStateMachine) edge(from, to State) (*compiledEdge, error) {
+	i, ok := c.indexes[from]
+	if !ok {
+		return nil, fmt.Errorf("state: %v, %w", from, StateNotFound)
+	}
+
+	j, ok := c.indexes[to]
+	if !ok {
+		return nil, fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	if c.matrix == nil {
+		return c.sparse[i*len(c.states)+j], nil
+	}
+
+	return c.matrix[i*len(c.states)+j], nil
+}
+
+// Can is true if there is at least one rule for the transition between two states, regardless of their guards
+// With the Dense Representation it is a single bit test
+func (c *CompiledStateMachine) Can(from, to State) bool {
+	i, ok := c.indexes[from]
+	if !ok {
+		return false
+	}
+
+	j, ok := c.indexes[to]
+	if !ok {
+		return false
+	}
+
+	k := i*len(c.states) + j
+	if c.matrix == nil {
+		_, ok = c.sparse[k]
+
+		return ok
+	}
+
+	return c.bits[k/64]&(1<<(k%64)) != 0
+}
+
+// Transition is like TransitionContext with a background context
+func (c *CompiledStateMachine) Transition(from, to State, params ...interface{}) (TransitionEvent, error) {
+	return c.TransitionContext(context.Background(), from, to, params...)
+}
+
+// TransitionContext evaluates the transition between two states and calls its actions if it is allowed
+// It returns the allowed TransitionEvent, which is also returned if an action failed, as the transition took place
+// Transitioning into the from state does nothing, like for StateMachine, and returns an empty TransitionEvent
+func (c *CompiledStateMachine) TransitionContext(ctx context.Context, from, to State, params ...interface{}) (TransitionEvent, error) {
+	return c.transition(ctx, from, to, "", params...)
+}
+
+// transition is TransitionContext recording the fired event, which is empty for transitions made directly
+func (c *CompiledStateMachine) transition(ctx context.Context, from, to State, via Event, params ...interface{}) (TransitionEvent, error) {
+	ce, err := c.edge(from, to)
+	if err != nil {
+		return TransitionEvent{}, err
+	}
+
+	if from == to {
+		return TransitionEvent{}, nil
+	}
+
+	if ce == nil || !ce.allowed(from, to, params...) {
+		return TransitionEvent{}, TransitionNotAllowed
+	}
+
+	event := TransitionEvent{From: from, To: to, Event: via, Params: params, At: c.clock.Now(), Result: Allowed}
+	for _, action := range ce.actions {
+		err = action(ctx, event)
+		if err != nil {
+			return event, fmt.Errorf("transition: %v -> %v, %w: %w", from, to, ActionFailed, err)
+		}
+	}
+
+	return event, nil
+}
+
+// Fire transitions from a state into the state the event leads to, see TransitionContext
+func (c *CompiledStateMachine) Fire(ctx context.Context, from State, event Event, params ...interface{}) (TransitionEvent, error) {
+	t := trigger{event: event, from: from}
+
+	to, ok := c.events[t]
+	if !ok {
+		return TransitionEvent{}, fmt.Errorf("event: %v, state: %v, %w", event, from, EventNotHandled)
+	}
+
+	to = choose(to, c.choices[t], params...)
+
+	transition, err := c.transition(ctx, from, to, event, params...)
+	if fallback, ok := c.fallbacks[t]; ok && fallback != to && errors.Is(err, TransitionNotAllowed) {
+		return c.transition(ctx, from, fallback, event, params...)
+	}
+
+	return transition, err
+}
+
+// allowed is true if the rules of the edge allow the transition according to its MatchStrategy
+func (ce *compiledEdge) allowed(from, to State, params ...interface{}) bool {
+	switch ce.strategy {
+	case AnyPasses:
+		for _, rule := range ce.rules {
+			if rule.Valid(from, to, params...) {
+				return true
+			}
+		}
+
+		return false
+	case AllMustPass:
+		for _, rule := range ce.rules {
+			if !rule.Valid(from, to, params...) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		for i, rule := range ce.rules {
+			if rule.Valid(from, to, params...) {
+				return true
+			}
+
+			if !ce.passThrough[i] {
+				return false
+			}
+		}
+
+		return false
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+)
+
+// ContextCondition is a condition which gives up as soon as ctx is done, e.g. a remote check aborting its request
+type ContextCondition func(ctx context.Context, params ...interface{}) bool
+
+// And creates a condition for a ConditionalTransitionRule which is only met if every condition is met,
+// the conditions are evaluated in order until the first unmet one
+func And(conditions ...func(params ...interface{}) bool) func(params ...interface{}) bool {
+	return func(params ...interface{}) bool {
+		for _, condition := range conditions {
+			if !condition(params...) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// Or creates a condition for a ConditionalTransitionRule which is met if at least one condition is met,
+// the conditions are evaluated in order until the first met one
+func Or(conditions ...func(params ...interface{}) bool) func(params ...interface{}) bool {
+	return func(params ...interface{}) bool {
+		for _, condition := range conditions {
+			if condition(params...) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// ParallelAnd is like And, but evaluates independent, slow conditions concurrently
+// As soon as a condition is unmet, the context of the others is canceled and the result returned,
+// so the latency is that of the first unmet or the slowest met condition instead of their sum
+func ParallelAnd(conditions ...ContextCondition) func(params ...interface{}) bool {
+	return func(params ...interface{}) bool {
+		return parallel(false, conditions, params)
+	}
+}
+
+// ParallelOr is like Or, but evaluates independent, slow conditions concurrently
+// As soon as a condition is met, the context of the others is canceled and the result returned
+func ParallelOr(conditions ...ContextCondition) func(params ...interface{}) bool {
+	return func(params ...interface{}) bool {
+		return parallel(true, conditions, params)
+	}
+}
+
+// WithoutContext adapts a condition which can not be canceled to a ContextCondition
+func WithoutContext(condition func(params ...interface{}) bool) ContextCondition {
+	return func(ctx context.Context, params ...interface{}) bool {
+		return condition(params...)
+	}
+}
+
+// parallel evaluates the conditions concurrently and returns decisive as soon as one of them returns it,
+// or !decisive once all of them returned !decisive
+func parallel(decisive bool, conditions []ContextCondition, params []interface{}) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan bool, len(conditions))
+	for _, condition := range conditions {
+		go func(condition ContextCondition) {
+			results <- condition(ctx, params...)
+		}(condition)
+	}
+
+	for range conditions {
+		if <-results == decisive {
+			return decisive
+		}
+	}
+
+	return !decisive
+}
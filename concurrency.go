@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+var ErrTransitionInProgress = fmt.Errorf("error: transition in progress")
+
+// ConcurrencyMode decides what happens to a transition attempted while another one of the same instance is in flight
+type ConcurrencyMode int
+
+const (
+	// QueueConcurrent makes competing transitions wait for the one in flight, like the Manager and the Mailbox do
+	// by default
+	QueueConcurrent ConcurrencyMode = iota
+	// RejectConcurrent rejects competing transitions with ErrTransitionInProgress instead of waiting
+	RejectConcurrent
+)
+
+// SetConcurrency sets how transitions competing with the one in flight are handled
+// With RejectConcurrent, the StateMachine itself rejects competing transitions, transitions made by its actions
+// through the context they receive are part of the one in flight, Managers reject them before waiting for the
+// instance, so at most one transition executes per instance at a time
+func (sm *StateMachine) SetConcurrency(mode ConcurrencyMode) error {
+	if sm.final {
+		return fmt.Errorf("concurrency must be defined before finalization")
+	}
+
+	sm.concurrency = mode
+
+	return nil
+}
+
+// claim marks a transition of the StateMachine as in flight if it rejects concurrent transitions, it returns true
+// if it did, then busy must be reset once the transition completed
+// Transitions made by the actions of the transition in flight are not claimed again
+func (sm *StateMachine) claim(ctx context.Context) (bool, error) {
+	if sm.concurrency != RejectConcurrent {
+		return false, nil
+	}
+
+	if running, ok := MetadataFrom(ctx); ok && running == sm {
+		return false, nil
+	}
+
+	if !sm.busy.CompareAndSwap(false, true) {
+		return false, ErrTransitionInProgress
+	}
+
+	return true, nil
+}
+
+// claim marks a transition of an instance as in flight for Managers rejecting concurrent transitions,
+// release must be called once it completed
+func (m *Manager) claim(id string) (func(), error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inst.reject.Load() {
+		return func() {}, nil
+	}
+
+	if !inst.busy.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("instance: %v, %w", id, ErrTransitionInProgress)
+	}
+
+	return func() { inst.busy.Store(false) }, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"text/template"
+)
+
+// constant is a generated constant of a state or event name
+type constant struct {
+	Name  string
+	Value string
+}
+
+// constantsFile holds everything needed to render a generated constants file
+type constantsFile struct {
+	Package string
+	Source  string
+	States  []constant
+	Events  []constant
+}
+
+var constantsTemplate = template.Must(template.New("constants").Parse(`// Code generated by {{ .Source }}. DO NOT EDIT.
+
+package {{ .Package }}
+{{ if .States }}
+const (
+{{- range .States }}
+	{{ .Name }} State = {{ printf "%q" .Value }}
+{{- end }}
+)
+{{ end }}
+{{- if .Events }}
+const (
+{{- range .Events }}
+	{{ .Name }} Event = {{ printf "%q" .Value }}
+{{- end }}
+)
+{{ end }}`))
+
+// GenerateConstants writes a Go file declaring a constant for every state and event of the StateMachine to w,
+// e.g. OrderStateInProgress for the state "in progress" of name "Order", so that code referencing them is checked
+// by the compiler instead of using raw strings
+func GenerateConstants(w io.Writer, sm *StateMachine, pkg, name string) error {
+	events := map[Event]bool{}
+	for t := range sm.events {
+		events[t.event] = true
+	}
+
+	names := make([]string, 0, len(events))
+	for event := range events {
+		names = append(names, string(event))
+	}
+
+	sort.Strings(names)
+
+	states := make([]string, 0, len(sm.states))
+	for _, state := range sm.States() {
+		states = append(states, string(state))
+	}
+
+	return writeConstants(w, "GenerateConstants", pkg, name, states, names)
+}
+
+// GenerateRulesFileConstants is like GenerateConstants for the states of a rules file, see LoadScriptRules, e.g. in
+// a go:generate step, as the guards do not have to be compiled
+func GenerateRulesFileConstants(w io.Writer, r io.Reader, pkg, name string) error {
+	var definitions []scriptRuleDefinition
+	err := json.NewDecoder(r).Decode(&definitions)
+	if err != nil {
+		return fmt.Errorf("decoding rules file: %w", err)
+	}
+
+	seen := map[State]bool{}
+	for _, definition := range definitions {
+		seen[definition.From] = true
+		seen[definition.To] = true
+	}
+
+	states := make([]string, 0, len(seen))
+	for state := range seen {
+		states = append(states, string(state))
+	}
+
+	sort.Strings(states)
+
+	return writeConstants(w, "GenerateRulesFileConstants", pkg, name, states, nil)
+}
+
+// writeConstants renders the constants of states and events, names which map to the same identifier are an error
+func writeConstants(w io.Writer, source, pkg, name string, states, events []string) error {
+	file := constantsFile{Package: pkg, Source: source}
+	prefix := identifier(name)
+
+	declared := map[string]string{}
+	declare := func(kind, value string) (constant, error) {
+		c := constant{Name: prefix + kind + identifier(value), Value: value}
+		if other, ok := declared[c.Name]; ok {
+			return c, fmt.Errorf("%q and %q are both %v, %w", other, value, c.Name, InvalidDefinition)
+		}
+
+		declared[c.Name] = value
+
+		return c, nil
+	}
+
+	for _, state := range states {
+		c, err := declare("State", state)
+		if err != nil {
+			return err
+		}
+
+		file.States = append(file.States, c)
+	}
+
+	for _, event := range events {
+		c, err := declare("Event", event)
+		if err != nil {
+			return err
+		}
+
+		file.Events = append(file.Events, c)
+	}
+
+	buf := &bytes.Buffer{}
+	err := constantsTemplate.Execute(buf, file)
+	if err != nil {
+		return fmt.Errorf("rendering constants: %w", err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting constants: %w", err)
+	}
+
+	_, err = w.Write(src)
+
+	return err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var ServiceNotFound = fmt.Errorf("error: service not found")
+
+// Container holds named services, e.g. repositories or API clients, which rules and actions can depend on
+type Container struct {
+	mu       sync.RWMutex
+	services map[string]interface{}
+}
+
+// Injectable is implemented by rules which depend on services of a Container
+// The dependencies are resolved and injected when the rule is added to a StateMachine, see also AddServiceAction
+type Injectable interface {
+	Dependencies() []string
+	Inject(services map[string]interface{})
+}
+
+// NewContainer creates a new Container
+func NewContainer() *Container {
+	return &Container{
+		services: map[string]interface{}{},
+	}
+}
+
+// Register adds a service to the Container, replacing any service registered under the same name
+func (c *Container) Register(name string, service interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.services[name] = service
+}
+
+// Resolve retrieves a service by name
+func (c *Container) Resolve(name string) (interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	service, ok := c.services[name]
+	if !ok {
+		return nil, fmt.Errorf("service: %v, %w", name, ServiceNotFound)
+	}
+
+	return service, nil
+}
+
+// inject resolves the dependencies of an Injectable and injects them
+func (c *Container) inject(injectable Injectable) error {
+	if c == nil {
+		return fmt.Errorf("a container must be set before adding rules or actions with dependencies")
+	}
+
+	services := map[string]interface{}{}
+	for _, name := range injectable.Dependencies() {
+		service, err := c.Resolve(name)
+		if err != nil {
+			return err
+		}
+
+		services[name] = service
+	}
+
+	injectable.Inject(services)
+
+	return nil
+}
+
+// SetContainer sets the Container the dependencies of rules and actions are resolved from
+func (sm *StateMachine) SetContainer(c *Container) error {
+	if sm.final {
+		return fmt.Errorf("container must be defined before finalization")
+	}
+
+	sm.container = c
+
+	return nil
+}
+
+// ServiceTransitionRule allows the transition between two states only if a condition depending on services is met
+type ServiceTransitionRule struct {
+	from         State
+	to           State
+	dependencies []string
+	services     map[string]interface{}
+	condition    func(services map[string]interface{}, params ...interface{}) bool
+}
+
+// NewServiceTransitionRule creates a new ServiceTransitionRule
+// The condition receives the services named in dependencies, resolved from the Container of the StateMachine
+func NewServiceTransitionRule(from, to State, dependencies []string, condition func(services map[string]interface{}, params ...interface{}) bool) *ServiceTransitionRule {
+	return &ServiceTransitionRule{
+		from:         from,
+		to:           to,
+		dependencies: dependencies,
+		condition:    condition,
+	}
+}
+
+// From retrieves the start state the transition rule applies to
+func (r *ServiceTransitionRule) From() State {
+	return r.from
+}
+
+// To retrieves the end state the transition rule applies to
+func (r *ServiceTransitionRule) To() State {
+	return r.to
+}
+
+// Dependencies retrieves the names of the services the condition depends on
+func (r *ServiceTransitionRule) Dependencies() []string {
+	return r.dependencies
+}
+
+// Inject sets the resolved services
+func (r *ServiceTransitionRule) Inject(services map[string]interface{}) {
+	r.services = services
+}
+
+// Valid is true if transitioning between two states is allowed
+func (r *ServiceTransitionRule) Valid(from, to State, params ...interface{}) bool {
+	return from == r.from && to == r.to && r.condition(r.services, params...)
+}
+
+// serviceAction is an Action depending on services
+type serviceAction struct {
+	dependencies []string
+	services     map[string]interface{}
+	action       func(ctx context.Context, event TransitionEvent, services map[string]interface{}) error
+}
+
+// Dependencies retrieves the names of the services the action depends on
+func (a *serviceAction) Dependencies() []string {
+	return a.dependencies
+}
+
+// Inject sets the resolved services
+func (a *serviceAction) Inject(services map[string]interface{}) {
+	a.services = services
+}
+
+// run runs the action with the resolved services
+func (a *serviceAction) run(ctx context.Context, event TransitionEvent) error {
+	return a.action(ctx, event, a.services)
+}
+
+// AddServiceAction adds an action to the transition between two states like AddAction
+// The action receives the services named in dependencies, resolved from the Container of the StateMachine
+func (sm *StateMachine) AddServiceAction(from, to State, dependencies []string, action func(ctx context.Context, event TransitionEvent, services map[string]interface{}) error) error {
+	if sm.final {
+		return fmt.Errorf("actions must be defined before finalization")
+	}
+
+	a := &serviceAction{
+		dependencies: dependencies,
+		action:       action,
+	}
+
+	err := sm.container.inject(a)
+	if err != nil {
+		return err
+	}
+
+	return sm.AddAction(from, to, a.run)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Coverage records which edges and rules of one or more StateMachines have been exercised
+// A single Coverage is usually shared by all StateMachines created during a test run
+type Coverage struct {
+	mu    sync.Mutex
+	edges map[edge]*EdgeCoverage
+	order []edge
+}
+
+// EdgeCoverage describes how often the transition between two states was exercised
+type EdgeCoverage struct {
+	From     State
+	To       State
+	Attempts int
+	Taken    int
+	Rules    []RuleCoverage
+}
+
+// RuleCoverage describes how often a rule of an edge was evaluated and how often it allowed the transition
+// Rules are identified by their position among the rules of the edge
+type RuleCoverage struct {
+	Evaluated int
+	Passed    int
+}
+
+// CoverageReport is a snapshot of a Coverage
+type CoverageReport struct {
+	Edges []EdgeCoverage
+}
+
+// NewCoverage creates a new Coverage
+func NewCoverage() *Coverage {
+	return &Coverage{
+		edges: map[edge]*EdgeCoverage{},
+	}
+}
+
+// SetCoverage enables the instrumentation mode of the StateMachine, recording exercised edges and rules in c
+func (sm *StateMachine) SetCoverage(c *Coverage) {
+	sm.coverage = c
+	c.register(sm)
+}
+
+// CoverageReport returns the edges known to the Coverage in the order they were first seen
+func (c *Coverage) CoverageReport() CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := CoverageReport{}
+	for _, e := range c.order {
+		ec := *c.edges[e]
+		ec.Rules = append([]RuleCoverage(nil), ec.Rules...)
+		report.Edges = append(report.Edges, ec)
+	}
+
+	return report
+}
+
+// register makes the edges and rules of the StateMachine known to the Coverage,
+// so that they are reported even if they are never exercised
+func (c *Coverage) register(sm *StateMachine) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := map[edge]int{}
+	for _, rule := range sm.loadRules().rules {
+		e := edge{from: rule.From(), to: rule.To()}
+		counts[e]++
+
+		ec := c.edge(e)
+		for len(ec.Rules) < counts[e] {
+			ec.Rules = append(ec.Rules, RuleCoverage{})
+		}
+	}
+}
+
+// edge retrieves the coverage of an edge, creating it if necessary, c.mu must be held
+func (c *Coverage) edge(e edge) *EdgeCoverage {
+	ec, ok := c.edges[e]
+	if !ok {
+		ec = &EdgeCoverage{From: e.from, To: e.to}
+		c.edges[e] = ec
+		c.order = append(c.order, e)
+	}
+
+	return ec
+}
+
+// attempted records an attempt to transition between two states
+func (c *Coverage) attempted(from, to State) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ec, ok := c.edges[edge{from: from, to: to}]
+	if ok {
+		ec.Attempts++
+	}
+}
+
+// taken records a successful transition between two states
+func (c *Coverage) taken(from, to State) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ec, ok := c.edges[edge{from: from, to: to}]
+	if ok {
+		ec.Taken++
+	}
+}
+
+// evaluated records the result of evaluating the index-th rule of an edge
+func (c *Coverage) evaluated(from, to State, index int, valid bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ec := c.edge(edge{from: from, to: to})
+	for len(ec.Rules) <= index {
+		ec.Rules = append(ec.Rules, RuleCoverage{})
+	}
+
+	ec.Rules[index].Evaluated++
+	if valid {
+		ec.Rules[index].Passed++
+	}
+}
+
+// Uncovered returns the edges which were never taken
+func (r CoverageReport) Uncovered() []EdgeCoverage {
+	var uncovered []EdgeCoverage
+	for _, ec := range r.Edges {
+		if ec.Taken == 0 {
+			uncovered = append(uncovered, ec)
+		}
+	}
+
+	return uncovered
+}
+
+// Ratio returns the ratio of taken edges, between 0 and 1
+func (r CoverageReport) Ratio() float64 {
+	if len(r.Edges) == 0 {
+		return 1
+	}
+
+	return float64(len(r.Edges)-len(r.Uncovered())) / float64(len(r.Edges))
+}
+
+// String returns a human-readable summary of the report, one edge per line
+func (r CoverageReport) String() string {
+	sb := strings.Builder{}
+	_, _ = fmt.Fprintf(&sb, "edge coverage: %.1f%%\n", r.Ratio()*100)
+	for _, ec := range r.Edges {
+		_, _ = fmt.Fprintf(&sb, "%v -> %v: taken %d of %d attempts", ec.From, ec.To, ec.Taken, ec.Attempts)
+		for i, rc := range ec.Rules {
+			_, _ = fmt.Fprintf(&sb, ", rule #%d passed %d of %d", i, rc.Passed, rc.Evaluated)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
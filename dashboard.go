@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DashboardView selects what RenderDashboard shows besides the instance counts
+type DashboardView struct {
+	// Recent is the number of most recent transitions of all instances to show
+	Recent int
+	// Focus is the ID of an instance whose whole history is shown, none if empty
+	Focus string
+}
+
+// RenderDashboard writes a plain-text snapshot of the Manager for operators in terminals: the number of instances
+// per state, the most recent transitions and the history of the focused instance
+// Rendering it periodically, e.g. every second after clearing the screen, gives a live dashboard
+func (m *Manager) RenderDashboard(w io.Writer, view DashboardView) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	counts := m.Counts()
+	states := make([]State, 0, len(counts))
+	for state := range counts {
+		states = append(states, state)
+	}
+
+	sortStates(states)
+
+	_, _ = fmt.Fprintf(tw, "STATE\tINSTANCES\n")
+	for _, state := range states {
+		_, _ = fmt.Fprintf(tw, "%v\t%d\n", state, counts[state])
+	}
+
+	if view.Recent > 0 {
+		type recorded struct {
+			id    string
+			event TransitionEvent
+		}
+
+		var events []recorded
+		m.each(func(id string, sm *StateMachine) {
+			for _, event := range sm.history {
+				events = append(events, recorded{id: id, event: event})
+			}
+		})
+
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].event.At.After(events[j].event.At)
+		})
+
+		if len(events) > view.Recent {
+			events = events[:view.Recent]
+		}
+
+		_, _ = fmt.Fprintf(tw, "\nRECENT\tINSTANCE\tTRANSITION\tRESULT\n")
+		for _, r := range events {
+			_, _ = fmt.Fprintf(tw, "%v\t%v\t%v -> %v\t%v\n", r.event.At.Format(time.TimeOnly), r.id, r.event.From, r.event.To, r.event.Result)
+		}
+	}
+
+	if view.Focus != "" {
+		history, err := m.History(view.Focus)
+		if err != nil {
+			return err
+		}
+
+		state, _ := m.State(view.Focus)
+		_, _ = fmt.Fprintf(tw, "\nHISTORY\t%v\tIN %v\n", view.Focus, state)
+		for _, event := range history {
+			_, _ = fmt.Fprintf(tw, "%v\t%v -> %v\t%v\t%v\n", event.At.Format(time.RFC3339), event.From, event.To, event.Result, event.Params)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// dashboardRows is the number of instances the interactive dashboard lists around the cursor
+const dashboardRows = 10
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\x1b[H\x1b[2J"
+
+// DashboardModel is the state of the interactive dashboard, shaped like a Bubble Tea model: Update handles a key and
+// View renders the screen, so that an adapter of github.com/charmbracelet/bubbletea only forwards key and tick messages,
+// which keeps the dependency out of this package
+type DashboardModel struct {
+	manager *Manager
+	recent  int
+	ids     []string
+	cursor  int
+	focus   string
+}
+
+// NewDashboardModel creates a new DashboardModel listing the instances of the Manager and its recent transitions
+func NewDashboardModel(m *Manager, recent int) *DashboardModel {
+	d := &DashboardModel{
+		manager: m,
+		recent:  recent,
+	}
+
+	d.Refresh()
+
+	return d
+}
+
+// Refresh reloads the instances, keeping the cursor on the selected instance if it still exists, e.g. on every tick
+func (d *DashboardModel) Refresh() {
+	selected := d.Selected()
+
+	d.ids = d.manager.IDs()
+	d.cursor = 0
+	for i, id := range d.ids {
+		if id == selected {
+			d.cursor = i
+		}
+	}
+}
+
+// Selected returns the ID of the instance under the cursor, empty if there are no instances
+func (d *DashboardModel) Selected() string {
+	if d.cursor >= len(d.ids) {
+		return ""
+	}
+
+	return d.ids[d.cursor]
+}
+
+// Update handles a key named as in Bubble Tea: "up" or "k" and "down" or "j" move the cursor, "enter" drills down into
+// the history of the selected instance and "esc" or "b" goes back to the overview
+// It returns true if the operator quits the dashboard with "q" or "ctrl+c"
+func (d *DashboardModel) Update(key string) bool {
+	switch key {
+	case "up", "k":
+		if d.cursor > 0 {
+			d.cursor--
+		}
+	case "down", "j":
+		if d.cursor < len(d.ids)-1 {
+			d.cursor++
+		}
+	case "enter":
+		d.focus = d.Selected()
+	case "esc", "b", "backspace":
+		d.focus = ""
+	case "q", "ctrl+c":
+		return true
+	}
+
+	return false
+}
+
+// View renders the screen: the overview lists the instances with the cursor, the drill-down the focused instance
+func (d *DashboardModel) View() string {
+	var b strings.Builder
+
+	err := d.manager.RenderDashboard(&b, DashboardView{Recent: d.recent, Focus: d.focus})
+	if err != nil {
+		_, _ = fmt.Fprintf(&b, "\nerror: %v\n", err)
+	}
+
+	if d.focus != "" {
+		_, _ = fmt.Fprintf(&b, "\n[esc/b] back  [q] quit\n")
+
+		return b.String()
+	}
+
+	start := d.cursor - dashboardRows/2
+	if start > len(d.ids)-dashboardRows {
+		start = len(d.ids) - dashboardRows
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	end := min(start+dashboardRows, len(d.ids))
+
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "\nINSTANCES %d-%d OF %d\n", min(start+1, end), end, len(d.ids))
+	for i := start; i < end; i++ {
+		cursor := " "
+		if i == d.cursor {
+			cursor = ">"
+		}
+
+		state, _ := d.manager.State(d.ids[i])
+		_, _ = fmt.Fprintf(tw, "%s %v\t%v\n", cursor, d.ids[i], state)
+	}
+
+	_ = tw.Flush()
+
+	_, _ = fmt.Fprintf(&b, "\n[k/j] move  [enter] history  [q] quit\n")
+
+	return b.String()
+}
+
+// RunDashboard runs the interactive dashboard in a terminal until the operator quits, in ends or ctx is done
+// The screen is redrawn every interval and after every key
+// Keys are read line by line from in, so that the terminal does not have to be put into raw mode, e.g. "j" followed by
+// return moves the cursor down, an empty line is "enter"
+func RunDashboard(ctx context.Context, model *DashboardModel, in io.Reader, out io.Writer, interval time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			key := strings.TrimSpace(scanner.Text())
+			if key == "" {
+				key = "enter"
+			}
+
+			select {
+			case keys <- key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := io.WriteString(out, clearScreen+model.View())
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			model.Refresh()
+		case key, ok := <-keys:
+			if !ok || model.Update(key) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	EventDeadLettered = fmt.Errorf("error: event dead-lettered")
+	LetterNotFound    = fmt.Errorf("error: dead letter not found")
+)
+
+// DeadLetter is an event which kept failing, with the context of its failures
+type DeadLetter struct {
+	ID       uint64
+	Event    Event
+	Priority Priority
+	Params   []interface{}
+	State    State
+	Attempts int
+	Errors   []error
+	At       time.Time
+}
+
+// maxRetryDelay caps the delay of retries, so that doubling it does not overflow
+const maxRetryDelay = time.Hour
+
+// DeadLetterSink receives the events a Mailbox gave up on
+type DeadLetterSink interface {
+	Put(letter DeadLetter) error
+}
+
+// DeadLetterQueue is a DeadLetterSink keeping dead letters in memory until they are reprocessed
+type DeadLetterQueue struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+// NewDeadLetterQueue creates a new DeadLetterQueue
+func NewDeadLetterQueue() *DeadLetterQueue {
+	return &DeadLetterQueue{}
+}
+
+// Put adds a dead letter to the queue
+func (q *DeadLetterQueue) Put(letter DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.letters = append(q.letters, letter)
+
+	return nil
+}
+
+// Letters returns the dead letters in the order they were added
+func (q *DeadLetterQueue) Letters() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]DeadLetter(nil), q.letters...)
+}
+
+// Reprocess removes the dead letter with the given ID from the queue and posts its event to mb again,
+// e.g. after the issue making it fail was fixed
+func (q *DeadLetterQueue) Reprocess(id uint64, mb *Mailbox) (<-chan error, error) {
+	letter, ok := q.take(id)
+	if !ok {
+		return nil, fmt.Errorf("letter: %v, %w", id, LetterNotFound)
+	}
+
+	return mb.Repost(letter), nil
+}
+
+// take removes the dead letter with the given ID from the queue
+func (q *DeadLetterQueue) take(id uint64) (DeadLetter, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, letter := range q.letters {
+		if letter.ID == id {
+			q.letters = append(q.letters[:i], q.letters[i+1:]...)
+
+			return letter, true
+		}
+	}
+
+	return DeadLetter{}, false
+}
+
+// ReprocessAll empties the queue and posts every event to mb again
+func (q *DeadLetterQueue) ReprocessAll(mb *Mailbox) []<-chan error {
+	q.mu.Lock()
+	letters := q.letters
+	q.letters = nil
+	q.mu.Unlock()
+
+	results := make([]<-chan error, 0, len(letters))
+	for _, letter := range letters {
+		results = append(results, mb.Repost(letter))
+	}
+
+	return results
+}
+
+// SetDeadLetter makes the Mailbox retry rejected events until they failed attempts times, then put them into sink
+// Events failed by an action are put into sink without being retried, as their transition already took place
+// Retried events are queued again behind the events of their priority, their callers receive the result once the
+// event succeeded or was dead-lettered, a Mailbox without dead-lettering does not retry events
+func (mb *Mailbox) SetDeadLetter(attempts int, sink DeadLetterSink) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.attempts = attempts
+	mb.deadLetter = sink
+}
+
+// SetRetryBackoff delays the retries of failing events, see SetDeadLetter, doubling the delay after every attempt
+// starting from base up to an hour, with a random jitter of plus or minus half of the delay drawn from source, so
+// that retries of many events do not happen at once
+// Injecting a seeded source makes the delays reproducible, a nil source is seeded by the current time
+func (mb *Mailbox) SetRetryBackoff(base time.Duration, source rand.Source) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.backoff = base
+	mb.jitter = newRand(source)
+}
+
+// retryDelay returns the delay before retrying an event which failed attempts times, mb.mu must be held
+func (mb *Mailbox) retryDelay(attempts int) time.Duration {
+	if mb.backoff <= 0 {
+		return 0
+	}
+
+	delay := mb.backoff
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, maxRetryDelay)
+
+	return delay/2 + time.Duration(mb.jitter.Int63n(int64(delay)+1))
+}
+
+// Repost posts the event of a dead letter again with its attempts reset, using the priority it had
+func (mb *Mailbox) Repost(letter DeadLetter) <-chan error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	return mb.post(letter.Priority, letter.Event, letter.Params)
+}
+
+// failed handles an event which failed in the given state, it is true if the event was queued again to be retried,
+// otherwise the returned error is the one the callers receive, mb.mu must be held
+func (mb *Mailbox) failed(msg message, state State, err error) (bool, error) {
+	if mb.deadLetter == nil || mb.attempts <= 0 {
+		return false, err
+	}
+
+	msg.errs = append(msg.errs, err)
+
+	if len(msg.errs) < mb.attempts && !errors.Is(err, ActionFailed) {
+		msg.ready = mb.clock.Now().Add(mb.retryDelay(len(msg.errs)))
+		mb.queues[msg.priority] = append(mb.queues[msg.priority], msg)
+
+		return true, nil
+	}
+
+	sinkErr := mb.deadLetter.Put(DeadLetter{
+		ID:       msg.seq,
+		Event:    msg.event,
+		Priority: msg.priority,
+		Params:   msg.params,
+		State:    state,
+		Attempts: len(msg.errs),
+		Errors:   msg.errs,
+		At:       mb.clock.Now(),
+	})
+
+	return false, errors.Join(fmt.Errorf("event: %v, %w: %w", msg.event, EventDeadLettered, err), sinkErr)
+}
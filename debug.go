@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DebugRule is a rule evaluated for a transition in debug mode, in the order the rules were evaluated
+type DebugRule struct {
+	Index int
+	Rule  string
+	Valid bool
+}
+
+// DebugAction is an action or wildcard hook called for a transition in debug mode, Hook is one of "exit",
+// "transition", "edge", "entry" and "enter", see runActions
+type DebugAction struct {
+	Hook  string
+	Index int
+	Err   error
+}
+
+// DebugTrace describes how a transition attempted in debug mode was decided, see SetDebug
+type DebugTrace struct {
+	From     State
+	To       State
+	Params   []interface{}
+	Strategy MatchStrategy
+	Rules    []DebugRule
+	Allowed  bool
+	Actions  []DebugAction
+	Err      error
+}
+
+// String describes the trace on several lines
+func (t DebugTrace) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "transition %v -> %v %v\n", t.From, t.To, t.Params)
+	if t.From == t.To {
+		fmt.Fprintf(&b, "  already in %v, nothing to do\n", t.To)
+
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "  strategy: %v\n", strategyNames[t.Strategy])
+	if len(t.Rules) == 0 {
+		fmt.Fprintf(&b, "  no rules evaluated\n")
+	}
+	for _, rule := range t.Rules {
+		fmt.Fprintf(&b, "  rule %d %s: %v\n", rule.Index, rule.Rule, rule.Valid)
+	}
+
+	result := Rejected
+	if t.Allowed {
+		result = Allowed
+	}
+	fmt.Fprintf(&b, "  result: %v\n", result)
+
+	for _, action := range t.Actions {
+		status := "ok"
+		if action.Err != nil {
+			status = action.Err.Error()
+		}
+
+		fmt.Fprintf(&b, "  %s action %d: %s\n", action.Hook, action.Index, status)
+	}
+
+	if t.Err != nil {
+		fmt.Fprintf(&b, "  error: %v\n", t.Err)
+	}
+
+	return b.String()
+}
+
+// hookNames names the groups of actions called by runActions in traces
+var hookNames = [...]string{"exit", "transition", "edge", "entry", "enter"}
+
+// strategyNames names the MatchStrategies in traces
+var strategyNames = map[MatchStrategy]string{
+	FirstMatch:  "first match",
+	AnyPasses:   "any passes",
+	AllMustPass: "all must pass",
+}
+
+// SetDebug turns on debug mode: report is called with a DebugTrace of every transition attempted on the
+// StateMachine, listing the rules considered in order with their results and the actions and hooks which ran
+// Debug mode is slower, nil turns it off
+func (sm *StateMachine) SetDebug(report func(trace DebugTrace)) {
+	sm.debug = report
+}
+
+// DebugLogger returns a report for SetDebug writing traces to w
+func DebugLogger(w io.Writer) func(trace DebugTrace) {
+	return func(trace DebugTrace) {
+		_, _ = io.WriteString(w, trace.String())
+	}
+}
+
+// transitionTraced makes a transition recording a DebugTrace of it and reports it
+func (sm *StateMachine) transitionTraced(ctx context.Context, to State, params ...interface{}) error {
+	report := sm.trace(to, params)
+
+	err := sm.TransitionContext(ctx, to, params...)
+	report(err)
+
+	return err
+}
+
+// trace starts recording a DebugTrace of a transition into to if the StateMachine is in debug mode and not
+// recording one already, the returned function stops recording and reports the trace with the result
+func (sm *StateMachine) trace(to State, params []interface{}) func(err error) {
+	if sm.debug == nil || sm.tracing != nil {
+		return func(error) {}
+	}
+
+	sm.tracing = &DebugTrace{From: sm.state, To: to, Params: params, Strategy: sm.matchStrategy(sm.state, to)}
+	trace := sm.tracing
+
+	return func(err error) {
+		sm.tracing = nil
+
+		trace.Err = err
+		sm.debug(*trace)
+	}
+}
+
+// evaluateTraced is evaluate recording the rules evaluated in the DebugTrace
+func (sm *StateMachine) evaluateTraced(ctx context.Context, from, to State, params ...interface{}) (bool, error) {
+	trace := sm.tracing
+
+	allowed := sm.check(ctx, from, to, trace, params...)
+	if ctx.Err() != nil {
+		return false, contextErr(ctx)
+	}
+
+	trace.Allowed = allowed
+
+	return allowed, nil
+}
+
+// evaluated records a rule evaluated for a transition, the trace may be nil
+func (t *DebugTrace) evaluated(index int, rule TransitionRule, valid bool) {
+	if t == nil {
+		return
+	}
+
+	t.Rules = append(t.Rules, DebugRule{Index: index, Rule: ruleName(rule), Valid: valid})
+}
+
+// acted records an action called for a transition, the trace may be nil
+func (t *DebugTrace) acted(hook string, index int, err error) {
+	if t == nil {
+		return
+	}
+
+	t.Actions = append(t.Actions, DebugAction{Hook: hook, Index: index, Err: err})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Debugger steps an in-memory replica of a StateMachine forward and backward through a recorded history
+type Debugger struct {
+	factory  func() *StateMachine
+	history  []TransitionEvent
+	replica  *StateMachine
+	position int
+}
+
+// NewDebugger creates a new Debugger for the recorded history
+// factory must create the replica in the state the history starts from
+func NewDebugger(factory func() *StateMachine, history []TransitionEvent) *Debugger {
+	return &Debugger{
+		factory: factory,
+		history: history,
+		replica: factory(),
+	}
+}
+
+// Position returns the number of recorded transitions applied to the replica
+func (d *Debugger) Position() int {
+	return d.position
+}
+
+// Len returns the number of recorded transitions
+func (d *Debugger) Len() int {
+	return len(d.history)
+}
+
+// State returns the current state of the replica
+func (d *Debugger) State() State {
+	return d.replica.State()
+}
+
+// Event returns the last recorded transition applied to the replica, including its params
+// It is false at the start of the history
+func (d *Debugger) Event() (TransitionEvent, bool) {
+	if d.position == 0 {
+		return TransitionEvent{}, false
+	}
+
+	return d.history[d.position-1], true
+}
+
+// Forward applies the next recorded transition to the replica
+// It fails at the end of the history or if the replica does not agree with the recorded result of the transition
+func (d *Debugger) Forward() error {
+	if d.position >= len(d.history) {
+		return fmt.Errorf("end of history reached")
+	}
+
+	event := d.history[d.position]
+	if d.replica.State() != event.From {
+		return fmt.Errorf("step %d: replica is in state %v, recorded transition starts in %v", d.position, d.replica.State(), event.From)
+	}
+
+	err := d.replica.Transition(event.requested(), event.Params...)
+	if err == nil && event.Result == Rejected {
+		return fmt.Errorf("step %d: replica allowed the rejected transition %v -> %v", d.position, event.From, event.requested())
+	}
+	if err != nil && event.Result != Rejected {
+		return fmt.Errorf("step %d: %w", d.position, err)
+	}
+
+	d.position++
+
+	return nil
+}
+
+// Backward reverts the last applied transition by replaying the history on a fresh replica
+func (d *Debugger) Backward() error {
+	if d.position == 0 {
+		return fmt.Errorf("start of history reached")
+	}
+
+	return d.Seek(d.position - 1)
+}
+
+// Seek moves the replica to the given position of the history
+func (d *Debugger) Seek(position int) error {
+	if position < 0 || position > len(d.history) {
+		return fmt.Errorf("position %d out of range [0, %d]", position, len(d.history))
+	}
+
+	if position < d.position {
+		d.replica = d.factory()
+		d.position = 0
+	}
+
+	for d.position < position {
+		err := d.Forward()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
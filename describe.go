@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// String returns a one line summary of the StateMachine
+func (sm *StateMachine) String() string {
+	return fmt.Sprintf("StateMachine in %v, %d states, %d rules", sm.state, len(sm.states), len(sm.loadRules().rules))
+}
+
+// GoString returns the StateMachine in Go syntax with its current state, states and edges, for %#v
+func (sm *StateMachine) GoString() string {
+	states := make([]string, 0, len(sm.states))
+	for _, state := range sm.States() {
+		states = append(states, fmt.Sprintf("%q", state))
+	}
+
+	edges := make([]string, 0, len(sm.loadRules().byEdge))
+	for _, e := range sortedEdgeSet(edgeSet(sm)) {
+		edges = append(edges, fmt.Sprintf("{From: %q, To: %q}", e.From, e.To))
+	}
+
+	return fmt.Sprintf("&StateMachine{state: %q, states: []State{%s}, edges: []Edge{%s}}", sm.state, strings.Join(states, ", "), strings.Join(edges, ", "))
+}
+
+// Describe returns a readable table of the states of the StateMachine, marking the current one, followed by its
+// edges with their match strategies and guards in evaluation order, e.g. for error reports
+// Guards are named by AddNamedRule, by their String method or by their type
+func (sm *StateMachine) Describe() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintf(tw, "STATE\tCURRENT\tTAGS\tDESCRIPTION\n")
+	for _, state := range sm.States() {
+		current := ""
+		if state == sm.state {
+			current = "*"
+		}
+
+		_, _ = fmt.Fprintf(tw, "%v\t%s\t%s\t%s\n", state, current, strings.Join(sm.tags[state], ","), sm.descriptions[state])
+	}
+
+	_, _ = fmt.Fprintf(tw, "\nEDGE\tSTRATEGY\tGUARDS\n")
+	for _, e := range sortedEdgeSet(edgeSet(sm)) {
+		var guards []string
+		for _, rule := range sm.edgeRules(e.From, e.To) {
+			guards = append(guards, sm.ruleName(rule))
+		}
+
+		_, _ = fmt.Fprintf(tw, "%v -> %v\t%s\t%s\n", e.From, e.To, strategyNames[sm.matchStrategy(e.From, e.To)], strings.Join(guards, ", "))
+	}
+
+	_ = tw.Flush()
+
+	return b.String()
+}
+
+// ruleName names a rule by the name it was added under, by its String method or by its type
+func (sm *StateMachine) ruleName(rule TransitionRule) string {
+	for name, r := range sm.ruleNames {
+		if sameRule(r, rule) {
+			return name
+		}
+	}
+
+	return ruleName(rule)
+}
+
+// ruleName names a rule by its String method or by its type
+func ruleName(rule TransitionRule) string {
+	if stringer, ok := rule.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+
+	return strings.TrimPrefix(fmt.Sprintf("%T", rule), "*main.")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"time"
+)
+
+// Entered returns when the current state was entered, the initial state is entered when the StateMachine is
+// created or its clock is set
+func (sm *StateMachine) Entered() time.Time {
+	return sm.enteredSince(sm.created)
+}
+
+// TimeInState returns the time spent in the current state according to the clock of the StateMachine
+func (sm *StateMachine) TimeInState() time.Duration {
+	return sm.clock.Now().Sub(sm.Entered())
+}
+
+// TimeInStates returns the total time spent in each state, including the current stay in the current state
+// States entered several times have the sum of their stays, states never entered are missing
+func (sm *StateMachine) TimeInStates() map[State]time.Duration {
+	return sm.dwell(sm.created, sm.clock.Now())
+}
+
+// enteredSince returns when the current state was entered by the last allowed transition, initial if the
+// StateMachine never transitioned
+func (sm *StateMachine) enteredSince(initial time.Time) time.Time {
+	for i := len(sm.history) - 1; i >= 0; i-- {
+		if sm.history[i].Result == Allowed {
+			return sm.history[i].At
+		}
+	}
+
+	return initial
+}
+
+// dwell returns the total time spent in each state until now, the stay in the state the StateMachine started in
+// begins at initial and is skipped if the history starts earlier, e.g. for a restored StateMachine
+func (sm *StateMachine) dwell(initial, now time.Time) map[State]time.Duration {
+	totals := map[State]time.Duration{}
+
+	entered := initial
+	for _, event := range sm.history {
+		if event.Result != Allowed {
+			continue
+		}
+
+		if d := event.At.Sub(entered); d > 0 {
+			totals[event.From] += d
+		}
+
+		entered = event.At
+	}
+
+	if d := now.Sub(entered); d > 0 {
+		totals[sm.state] += d
+	}
+
+	return totals
+}
+
+// TimeInState returns the time the instance with the given ID spent in its current state, instances which never
+// transitioned entered their state when they were added to the Manager
+func (m *Manager) TimeInState(id string) (time.Duration, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return 0, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return m.clock.Now().Sub(inst.entered()), nil
+}
+
+// TimeInStates returns the total time the instance with the given ID spent in each state, see TimeInState
+func (m *Manager) TimeInStates(id string) (map[State]time.Duration, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return nil, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return inst.sm.dwell(inst.added, m.clock.Now()), nil
+}
+
+// StateTotals returns the total time all instances spent in each state, including their current stays,
+// e.g. to find the states where work piles up
+func (m *Manager) StateTotals() map[State]time.Duration {
+	now := m.clock.Now()
+
+	m.mu.RLock()
+	added := make(map[string]time.Time, len(m.instances))
+	for id, inst := range m.instances {
+		added[id] = inst.added
+	}
+	m.mu.RUnlock()
+
+	totals := map[State]time.Duration{}
+	m.each(func(id string, sm *StateMachine) {
+		for state, d := range sm.dwell(added[id], now) {
+			totals[state] += d
+		}
+	})
+
+	return totals
+}
+
+// Age returns the time since the StateMachine was created, or since its first recorded transition if that is
+// earlier, e.g. for a restored StateMachine
+func (sm *StateMachine) Age() time.Duration {
+	born := sm.created
+	if len(sm.history) > 0 && sm.history[0].At.Before(born) {
+		born = sm.history[0].At
+	}
+
+	return sm.clock.Now().Sub(born)
+}
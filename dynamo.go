@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ConditionFailed = fmt.Errorf("error: condition failed")
+
+// DynamoBatchSize is the number of items DynamoDB writes in a single batch
+const DynamoBatchSize = 25
+
+// DynamoItem is an item of a DynamoDB table with the partition key PK and the sort key SK
+type DynamoItem struct {
+	PK       string
+	SK       string
+	Revision int64
+	Data     []byte
+}
+
+// DynamoTable is a DynamoDB table, adapters wrap the client of the AWS SDK
+// BatchPut writes at most DynamoBatchSize items unconditionally
+// TransactPut writes every item or none of them, each only if the stored item has the previous Revision, or for
+// Revision 1 if it does not exist yet, otherwise it fails with ConditionFailed
+// Query returns at most limit items of a partition with SK starting with prefix after startAfter, in order of SK
+// Keys returns the partition keys of the items with the sort key sk, e.g. by scanning a GSI on SK
+type DynamoTable interface {
+	BatchPut(ctx context.Context, items []DynamoItem) error
+	TransactPut(ctx context.Context, items []DynamoItem) error
+	Query(ctx context.Context, pk, prefix, startAfter string, limit int) ([]DynamoItem, error)
+	DeletePartition(ctx context.Context, pk string) error
+	Keys(ctx context.Context, sk string) ([]string, error)
+}
+
+// MemoryDynamoTable is a DynamoTable keeping items in memory, it does not survive restarts on its own
+type MemoryDynamoTable struct {
+	mu    sync.Mutex
+	items map[string]map[string]DynamoItem
+}
+
+// NewMemoryDynamoTable creates a new MemoryDynamoTable
+func NewMemoryDynamoTable() *MemoryDynamoTable {
+	return &MemoryDynamoTable{
+		items: map[string]map[string]DynamoItem{},
+	}
+}
+
+// BatchPut adds or replaces items
+func (t *MemoryDynamoTable) BatchPut(_ context.Context, items []DynamoItem) error {
+	if len(items) > DynamoBatchSize {
+		return fmt.Errorf("batch of %d items, %w", len(items), InvalidRequest)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, item := range items {
+		t.put(item)
+	}
+
+	return nil
+}
+
+// TransactPut adds or replaces items if none of them was changed concurrently
+func (t *MemoryDynamoTable) TransactPut(_ context.Context, items []DynamoItem) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, item := range items {
+		stored, ok := t.items[item.PK][item.SK]
+		if (!ok && item.Revision != 1) || (ok && stored.Revision != item.Revision-1) {
+			return fmt.Errorf("item: %v %v, %w", item.PK, item.SK, ConditionFailed)
+		}
+	}
+
+	for _, item := range items {
+		t.put(item)
+	}
+
+	return nil
+}
+
+// Query returns items of a partition in order of their sort keys
+func (t *MemoryDynamoTable) Query(_ context.Context, pk, prefix, startAfter string, limit int) ([]DynamoItem, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var items []DynamoItem
+	for sk, item := range t.items[pk] {
+		if strings.HasPrefix(sk, prefix) && sk > startAfter {
+			items = append(items, item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].SK < items[j].SK
+	})
+
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+
+	return items, nil
+}
+
+// DeletePartition removes every item of a partition
+func (t *MemoryDynamoTable) DeletePartition(_ context.Context, pk string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.items, pk)
+
+	return nil
+}
+
+// Keys returns the partition keys of the items with a sort key in alphabetical order
+func (t *MemoryDynamoTable) Keys(_ context.Context, sk string) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var keys []string
+	for pk, items := range t.items {
+		if _, ok := items[sk]; ok {
+			keys = append(keys, pk)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// put adds or replaces an item, t.mu must be held
+func (t *MemoryDynamoTable) put(item DynamoItem) {
+	if t.items[item.PK] == nil {
+		t.items[item.PK] = map[string]DynamoItem{}
+	}
+
+	t.items[item.PK][item.SK] = item
+}
+
+// Keys of the items of DynamoInstanceStore
+const (
+	dynamoInstancePrefix = "INSTANCE#"
+	dynamoMetaKey        = "META"
+	dynamoEventPrefix    = "EVENT#"
+)
+
+// dynamoMeta is the data of the item describing an instance, only the first Events events of its partition belong to it
+type dynamoMeta struct {
+	State    State    `json:"state"`
+	Version  string   `json:"version"`
+	Events   int      `json:"events"`
+	Metadata Metadata `json:"metadata,omitempty"`
+}
+
+// DynamoInstanceStore is an InstanceStore keeping instances in a single DynamoDB table
+// Every instance is a partition, INSTANCE#<id>, with a META item holding its state and an EVENT#<seq> item per
+// transition in its history
+// Writes are optimistically locked: the META item is only written if nobody else wrote it since the store loaded or
+// saved the instance, otherwise saving fails with ConditionFailed and the instance has to be loaded again
+type DynamoInstanceStore struct {
+	table    DynamoTable
+	pageSize int
+
+	mu        sync.Mutex
+	revisions map[string]int64
+	events    map[string]int
+}
+
+// NewDynamoInstanceStore creates a new DynamoInstanceStore reading histories in pages of 100 events
+func NewDynamoInstanceStore(table DynamoTable) *DynamoInstanceStore {
+	return &DynamoInstanceStore{
+		table:     table,
+		pageSize:  100,
+		revisions: map[string]int64{},
+		events:    map[string]int{},
+	}
+}
+
+// SetPageSize sets the number of events read by a single query when loading a history
+func (s *DynamoInstanceStore) SetPageSize(pageSize int) {
+	s.pageSize = pageSize
+}
+
+// Load returns an instance, reading its history in pages
+func (s *DynamoInstanceStore) Load(id string) (StoredInstance, error) {
+	ctx := context.Background()
+	pk := dynamoInstancePrefix + id
+
+	items, err := s.table.Query(ctx, pk, dynamoMetaKey, "", 1)
+	if err != nil {
+		return StoredInstance{}, fmt.Errorf("instance: %v, %w", id, err)
+	}
+	if len(items) == 0 {
+		return StoredInstance{}, fmt.Errorf("instance: %v, %w", id, InstanceNotFound)
+	}
+
+	var meta dynamoMeta
+	err = json.Unmarshal(items[0].Data, &meta)
+	if err != nil {
+		return StoredInstance{}, fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	instance := StoredInstance{ID: id, Version: meta.Version, State: meta.State, History: make([]TransitionEvent, 0, meta.Events), Metadata: meta.Metadata}
+	revision := items[0].Revision
+
+	startAfter := ""
+	for len(instance.History) < meta.Events {
+		page, err := s.table.Query(ctx, pk, dynamoEventPrefix, startAfter, s.pageSize)
+		if err != nil {
+			return StoredInstance{}, fmt.Errorf("instance: %v, %w", id, err)
+		}
+		if len(page) == 0 {
+			return StoredInstance{}, fmt.Errorf("instance: %v, %d of %d events, %w", id, len(instance.History), meta.Events, InstanceNotFound)
+		}
+
+		for _, item := range page {
+			if len(instance.History) == meta.Events {
+				break
+			}
+
+			var event TransitionEvent
+			err = json.Unmarshal(item.Data, &event)
+			if err != nil {
+				return StoredInstance{}, fmt.Errorf("instance: %v, %w", id, err)
+			}
+
+			instance.History = append(instance.History, event)
+		}
+
+		startAfter = page[len(page)-1].SK
+	}
+
+	s.mu.Lock()
+	s.revisions[id] = revision
+	s.events[id] = meta.Events
+	s.mu.Unlock()
+
+	return instance, nil
+}
+
+// Save adds or replaces an instance
+func (s *DynamoInstanceStore) Save(instance StoredInstance) error {
+	return s.SaveAll([]StoredInstance{instance})
+}
+
+// SaveAll adds or replaces instances, the new events are written in batches first and the META items of every
+// instance in a single transaction, which makes the events part of the instances
+func (s *DynamoInstanceStore) SaveAll(instances []StoredInstance) error {
+	ctx := context.Background()
+
+	s.mu.Lock()
+	revisions := make(map[string]int64, len(instances))
+	events := make(map[string]int, len(instances))
+	for _, instance := range instances {
+		revisions[instance.ID] = s.revisions[instance.ID]
+		events[instance.ID] = s.events[instance.ID]
+	}
+	s.mu.Unlock()
+
+	var batch []DynamoItem
+	metas := make([]DynamoItem, 0, len(instances))
+	for _, instance := range instances {
+		pk := dynamoInstancePrefix + instance.ID
+
+		// events are rewritten if the history was replaced by a shorter one, e.g. by Migrate
+		first := events[instance.ID]
+		if first > len(instance.History) {
+			first = 0
+		}
+
+		for seq := first; seq < len(instance.History); seq++ {
+			data, err := json.Marshal(instance.History[seq])
+			if err != nil {
+				return fmt.Errorf("instance: %v, %w", instance.ID, err)
+			}
+
+			batch = append(batch, DynamoItem{PK: pk, SK: fmt.Sprintf("%s%010d", dynamoEventPrefix, seq), Data: data})
+		}
+
+		data, err := json.Marshal(dynamoMeta{State: instance.State, Version: instance.Version, Events: len(instance.History), Metadata: instance.Metadata})
+		if err != nil {
+			return fmt.Errorf("instance: %v, %w", instance.ID, err)
+		}
+
+		metas = append(metas, DynamoItem{PK: pk, SK: dynamoMetaKey, Revision: revisions[instance.ID] + 1, Data: data})
+	}
+
+	for len(batch) > 0 {
+		n := min(len(batch), DynamoBatchSize)
+
+		err := s.table.BatchPut(ctx, batch[:n])
+		if err != nil {
+			return err
+		}
+
+		batch = batch[n:]
+	}
+
+	err := s.table.TransactPut(ctx, metas)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for i, instance := range instances {
+		s.revisions[instance.ID] = metas[i].Revision
+		s.events[instance.ID] = len(instance.History)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Delete removes an instance
+func (s *DynamoInstanceStore) Delete(id string) error {
+	err := s.table.DeletePartition(context.Background(), dynamoInstancePrefix+id)
+	if err != nil {
+		return fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	s.mu.Lock()
+	delete(s.revisions, id)
+	delete(s.events, id)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// IDs returns the IDs of the instances in alphabetical order
+func (s *DynamoInstanceStore) IDs() ([]string, error) {
+	keys, err := s.table.Keys(context.Background(), dynamoMetaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, strings.TrimPrefix(key, dynamoInstancePrefix))
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// Scan implements sql.Scanner, so that a State can be a field of a model stored in a database
+// NULL is scanned as the empty State
+func (s *State) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+	case string:
+		*s = State(v)
+	case []byte:
+		*s = State(v)
+	default:
+		return fmt.Errorf("scanning state: unsupported type %T", src)
+	}
+
+	return nil
+}
+
+// Value implements driver.Valuer
+func (s State) Value() (driver.Value, error) {
+	return string(s), nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *State) UnmarshalText(text []byte) error {
+	*s = State(text)
+
+	return nil
+}
+
+// validState scans into a State, rejecting states its definition does not have
+type validState struct {
+	sm    *StateMachine
+	state *State
+}
+
+// ValidState returns an sql.Scanner scanning into state which rejects states not defined by the StateMachine,
+// e.g. rows.Scan(&order.ID, definition.ValidState(&order.State))
+func (sm *StateMachine) ValidState(state *State) sql.Scanner {
+	return validState{sm: sm, state: state}
+}
+
+// Scan implements sql.Scanner
+func (v validState) Scan(src interface{}) error {
+	var state State
+	err := state.Scan(src)
+	if err != nil {
+		return err
+	}
+
+	_, ok := v.sm.states[state]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", state, StateNotFound)
+	}
+
+	*v.state = state
+
+	return nil
+}
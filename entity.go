@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var UnknownDiscriminator = fmt.Errorf("error: unknown discriminator")
+
+// ColumnHook maps a transition of an entity to the columns it changes besides the state column,
+// e.g. setting shipped_at when an order is shipped
+type ColumnHook func(event TransitionEvent) map[string]interface{}
+
+// EntityDefinitions selects the definition of the StateMachine embedded in an entity by a discriminator column,
+// e.g. the kind of an order
+type EntityDefinitions struct {
+	mu          sync.RWMutex
+	stateColumn string
+	definitions map[string]func() *StateMachine
+	hooks       []ColumnHook
+}
+
+// NewEntityDefinitions creates a new EntityDefinitions for entities keeping their state in stateColumn
+func NewEntityDefinitions(stateColumn string) *EntityDefinitions {
+	return &EntityDefinitions{
+		stateColumn: stateColumn,
+		definitions: map[string]func() *StateMachine{},
+	}
+}
+
+// Register sets the definition of the entities with a discriminator
+func (d *EntityDefinitions) Register(discriminator string, definition func() *StateMachine) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.definitions[discriminator] = definition
+}
+
+// AddColumnHook adds a hook called after every transition of the entities
+func (d *EntityDefinitions) AddColumnHook(hook ColumnHook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.hooks = append(d.hooks, hook)
+}
+
+// Bind creates the StateMachine of an FSM loaded from the database from the definition of the discriminator and
+// moves it into the loaded state, entities with an empty state column start in the initial state
+func (d *EntityDefinitions) Bind(fsm *FSM, discriminator string) error {
+	d.mu.RLock()
+	definition, ok := d.definitions[discriminator]
+	d.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("discriminator: %v, %w", discriminator, UnknownDiscriminator)
+	}
+
+	sm := definition()
+	if fsm.state != "" {
+		if _, ok := sm.states[fsm.state]; !ok {
+			return fmt.Errorf("discriminator: %v, state: %v, %w", discriminator, fsm.state, StateNotFound)
+		}
+
+		sm.state = fsm.state
+	}
+
+	fsm.definitions = d
+	fsm.machine = sm
+	fsm.loaded = sm.state
+	fsm.state = sm.state
+	fsm.changes = nil
+
+	return nil
+}
+
+// FSM embeds a StateMachine in a domain entity, e.g. `Order.FSM`, the state is persisted in a single column
+// It implements sql.Scanner and driver.Valuer, so GORM, sqlx and database/sql read and write it like a string, see
+// EntityDefinitions.Bind for creating its StateMachine after loading the entity
+type FSM struct {
+	state       State
+	loaded      State
+	machine     *StateMachine
+	definitions *EntityDefinitions
+	changes     map[string]interface{}
+}
+
+// Scan reads the state from a column
+func (f *FSM) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		f.state = ""
+	case string:
+		f.state = State(v)
+	case []byte:
+		f.state = State(v)
+	default:
+		return fmt.Errorf("scanning %T into FSM, %w", src, InvalidRequest)
+	}
+
+	return nil
+}
+
+// Value writes the state into a column
+func (f FSM) Value() (driver.Value, error) {
+	return string(f.state), nil
+}
+
+// State returns the current state of the entity
+func (f *FSM) State() State {
+	return f.state
+}
+
+// Machine returns the bound StateMachine, nil before Bind
+func (f *FSM) Machine() *StateMachine {
+	return f.machine
+}
+
+// Transition moves the entity into the given state and collects the columns changed by it, see Changes
+func (f *FSM) Transition(ctx context.Context, to State, params ...interface{}) error {
+	if f.machine == nil {
+		return fmt.Errorf("transition: %v -> %v, FSM is not bound, %w", f.state, to, InvalidRequest)
+	}
+
+	recorded := len(f.machine.history)
+	err := f.machine.TransitionContext(ctx, to, params...)
+	f.state = f.machine.State()
+
+	if f.changes == nil {
+		f.changes = map[string]interface{}{}
+	}
+
+	f.definitions.mu.RLock()
+	hooks := f.definitions.hooks
+	f.definitions.mu.RUnlock()
+
+	for _, event := range f.machine.history[recorded:] {
+		if event.Result != Allowed {
+			continue
+		}
+
+		for _, hook := range hooks {
+			for column, value := range hook(event) {
+				f.changes[column] = value
+			}
+		}
+	}
+
+	if f.state != f.loaded {
+		f.changes[f.definitions.stateColumn] = string(f.state)
+	}
+
+	return err
+}
+
+// Changes returns the columns changed by the transitions since the entity was bound or saved, e.g. for GORM's
+// Updates, the state column is included if the state changed
+func (f *FSM) Changes() map[string]interface{} {
+	changes := make(map[string]interface{}, len(f.changes))
+	for column, value := range f.changes {
+		changes[column] = value
+	}
+
+	return changes
+}
+
+// Saved marks the changes as saved, the loaded state becomes the current one
+func (f *FSM) Saved() {
+	f.loaded = f.state
+	f.changes = nil
+}
+
+// UpdateStatement builds an UPDATE statement writing the changed columns of an entity with ? placeholders, e.g. for
+// sqlx after Rebind, the statement only matches the row if it is still in the loaded state, so a concurrent
+// transition of the same entity makes it affect no rows, the statement is empty if nothing changed
+func (f *FSM) UpdateStatement(table, keyColumn string, key interface{}) (string, []interface{}) {
+	if len(f.changes) == 0 {
+		return "", nil
+	}
+
+	columns := make([]string, 0, len(f.changes))
+	for column := range f.changes {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+
+	sets := make([]string, len(columns))
+	args := make([]interface{}, 0, len(columns)+2)
+	for i, column := range columns {
+		sets[i] = column + " = ?"
+		args = append(args, f.changes[column])
+	}
+
+	args = append(args, key, string(f.loaded))
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s = ? AND %s = ?", table, strings.Join(sets, ", "), keyColumn, f.definitions.stateColumn)
+
+	return query, args
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+)
+
+// entryLimit is the number of times a state may be entered and the state entered instead once it is reached
+type entryLimit struct {
+	max      int
+	overflow State
+}
+
+// SetEntryLimit limits how many times the StateMachine may enter a state, e.g. an instance may be Rejected at most
+// 3 times, further transitions into it which the rules allow move the StateMachine into overflow instead,
+// e.g. Closed, without evaluating the rules into overflow, the redirected transitions keep the requested state in
+// their Requested field
+// The entries are counted in the history, so the limit holds for restored StateMachines too, but not for
+// CompiledStateMachines, which keep no history, Compile reports transitions into state without rules into overflow
+func (sm *StateMachine) SetEntryLimit(state State, max int, overflow State) error {
+	if sm.final {
+		return fmt.Errorf("entry limits must be defined before finalization")
+	}
+
+	_, ok := sm.states[state]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", state, StateNotFound)
+	}
+
+	_, ok = sm.states[overflow]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", overflow, StateNotFound)
+	}
+
+	if overflow == state {
+		return fmt.Errorf("state: %v, overflow into itself, %w", state, InvalidDefinition)
+	}
+
+	if sm.limits == nil {
+		sm.limits = map[State]entryLimit{}
+	}
+
+	sm.limits[state] = entryLimit{max: max, overflow: overflow}
+
+	return nil
+}
+
+// EntryCount returns how many times the StateMachine entered a state according to its history
+func (sm *StateMachine) EntryCount(state State) int {
+	count := 0
+	for _, event := range sm.history {
+		if event.Result == Allowed && event.To == state {
+			count++
+		}
+	}
+
+	return count
+}
+
+// overflow returns the state an allowed transition into to leads to, the overflow state of to if its entry limit
+// is reached, to otherwise
+func (sm *StateMachine) overflow(to State) State {
+	limit, ok := sm.limits[to]
+	if !ok || sm.EntryCount(to) < limit.max {
+		return to
+	}
+
+	return limit.overflow
+}
+
+// requested returns the state the transition was requested into, which is not To if it was redirected by an entry
+// limit
+func (e TransitionEvent) requested() State {
+	if e.Requested != "" {
+		return e.Requested
+	}
+
+	return e.To
+}
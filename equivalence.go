@@ -0,0 +1,88 @@
+package main
+
+// Counterexample is a sequence of requested states which distinguishes two definitions
+// The last transition of the sequence is judged differently by the two definitions
+type Counterexample struct {
+	Sequence []State
+	Reason   string
+}
+
+// pair is a combination of states of two StateMachines
+type pair struct {
+	a State
+	b State
+}
+
+// Equivalent checks whether two StateMachine definitions accept exactly the same sequences of transitions,
+// starting from their current states, e.g. to verify that a refactored definition behaves like the original
+// Guards are compared by presence only: an edge must be unconditional in both or guarded in both
+// If the definitions differ, the shortest distinguishing sequence is returned
+func Equivalent(a, b *StateMachine) (bool, Counterexample) {
+	symbols := unionStates(a.States(), b.States())
+
+	start := pair{a: a.State(), b: b.State()}
+	paths := map[pair][]State{start: nil}
+	queue := []pair{start}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, to := range symbols {
+			sequence := append(append([]State(nil), paths[current]...), to)
+
+			acceptsA, guardedA := a.accepts(current.a, to)
+			acceptsB, guardedB := b.accepts(current.b, to)
+
+			switch {
+			case acceptsA && !acceptsB:
+				return false, Counterexample{Sequence: sequence, Reason: "accepted by a, rejected by b"}
+			case !acceptsA && acceptsB:
+				return false, Counterexample{Sequence: sequence, Reason: "rejected by a, accepted by b"}
+			case guardedA != guardedB:
+				return false, Counterexample{Sequence: sequence, Reason: "guarded in only one of the definitions"}
+			case !acceptsA:
+				continue
+			}
+
+			next := pair{a: to, b: to}
+			_, seen := paths[next]
+			if !seen {
+				paths[next] = sequence
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return true, Counterexample{}
+}
+
+// accepts tells whether a transition between two states may be allowed and whether it depends on guards
+// Transitioning into the current state is always accepted
+func (sm *StateMachine) accepts(from, to State) (bool, bool) {
+	if from == to {
+		_, ok := sm.states[to]
+
+		return ok, false
+	}
+
+	rules := sm.edgeRules(from, to)
+
+	return len(rules) > 0, guarded(rules)
+}
+
+// unionStates merges two alphabetically ordered lists of states
+func unionStates(a, b []State) []State {
+	seen := map[State]bool{}
+	var states []State
+	for _, state := range append(append([]State(nil), a...), b...) {
+		if !seen[state] {
+			seen[state] = true
+			states = append(states, state)
+		}
+	}
+
+	sortStates(states)
+
+	return states
+}
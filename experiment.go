@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// InstanceID identifies an instance in the params of a transition, e.g. for experiment bucketing
+type InstanceID string
+
+// ExposureEvent is emitted when an instance is routed through one of the edges of an experiment
+type ExposureEvent struct {
+	Experiment string
+	InstanceID InstanceID
+	Variant    State
+}
+
+// Experiment routes a percentage of instances from a state to a treatment state and the rest to a control state
+// The variant of an instance is stable, as it is derived from the experiment name and the instance ID
+// Transitions of the experiment edges must carry the InstanceID among their params
+// OnExposure is called once an instance took one of the edges, see Define
+type Experiment struct {
+	Name       string
+	From       State
+	Control    State
+	Treatment  State
+	Percent    uint32
+	OnExposure func(event ExposureEvent)
+}
+
+// Variant returns the state the instance is routed to
+func (e *Experiment) Variant(id InstanceID) State {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.Name + ":" + string(id)))
+
+	if h.Sum32()%100 < e.Percent {
+		return e.Treatment
+	}
+
+	return e.Control
+}
+
+// Define adds the rules of the experiment to the StateMachine and the actions reporting the exposures of the
+// instances taking its edges, so exposures are only reported for transitions which took place
+func (e *Experiment) Define(sm *StateMachine) error {
+	err := sm.AddRules(e.Rules()...)
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range []State{e.Control, e.Treatment} {
+		err = sm.AddAction(e.From, variant, e.expose)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expose reports the exposure of the instance which took an edge of the experiment
+func (e *Experiment) expose(_ context.Context, event TransitionEvent) error {
+	id, ok := instanceIDParam(event.Params)
+	if ok && e.OnExposure != nil {
+		e.OnExposure(ExposureEvent{Experiment: e.Name, InstanceID: id, Variant: event.requested()})
+	}
+
+	return nil
+}
+
+// Rules returns the rules for the control and the treatment edges of the experiment
+// Each of them only allows the transition for instances routed to its edge, they report no exposures, see Define
+func (e *Experiment) Rules() []TransitionRule {
+	return []TransitionRule{
+		NewConditionalTransitionRule(e.From, e.Control, e.guard(e.Control)),
+		NewConditionalTransitionRule(e.From, e.Treatment, e.guard(e.Treatment)),
+	}
+}
+
+// guard creates a condition which is met if the instance in the params is routed to variant
+func (e *Experiment) guard(variant State) func(params ...interface{}) bool {
+	return func(params ...interface{}) bool {
+		id, ok := instanceIDParam(params)
+
+		return ok && e.Variant(id) == variant
+	}
+}
+
+// instanceIDParam retrieves the first InstanceID from the params
+func instanceIDParam(params []interface{}) (InstanceID, bool) {
+	for _, param := range params {
+		id, ok := param.(InstanceID)
+		if ok {
+			return id, true
+		}
+	}
+
+	return "", false
+}
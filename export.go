@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// HistoryFormat is a file format the history of a StateMachine can be exported in
+type HistoryFormat int
+
+const (
+	// HistoryCSV exports the history as CSV with a header row
+	HistoryCSV HistoryFormat = iota
+	// HistoryJSON exports the history as a JSON array of TransitionEvents
+	HistoryJSON
+)
+
+// Filter selects transition events of a history, zero values match every event
+type Filter struct {
+	From   State
+	To     State
+	Since  time.Time
+	Result TransitionResult
+}
+
+// Match is true if the event is selected by the filter
+func (f Filter) Match(event TransitionEvent) bool {
+	switch {
+	case f.From != "" && event.From != f.From:
+		return false
+	case f.To != "" && event.To != f.To:
+		return false
+	case !f.Since.IsZero() && event.At.Before(f.Since):
+		return false
+	case f.Result != "" && event.Result != f.Result:
+		return false
+	}
+
+	return true
+}
+
+// ExportHistory writes the events of the history selected by the filter to w in the given format
+func (sm *StateMachine) ExportHistory(w io.Writer, format HistoryFormat, filter Filter) error {
+	var events []TransitionEvent
+	for _, event := range sm.history {
+		if filter.Match(event) {
+			events = append(events, event)
+		}
+	}
+
+	switch format {
+	case HistoryCSV:
+		return exportHistoryCSV(w, events)
+	case HistoryJSON:
+		return exportHistoryJSON(w, events)
+	}
+
+	return fmt.Errorf("unknown history format: %d", format)
+}
+
+// exportHistoryCSV writes the events as CSV, params are encoded as a JSON array
+// The event and requested columns come last, so that readers of the earlier columns keep working
+func exportHistoryCSV(w io.Writer, events []TransitionEvent) error {
+	writer := csv.NewWriter(w)
+
+	err := writer.Write([]string{"at", "from", "to", "result", "params", "event", "requested"})
+	if err != nil {
+		return fmt.Errorf("writing csv: %w", err)
+	}
+
+	for _, event := range events {
+		params, err := json.Marshal(event.Params)
+		if err != nil {
+			return fmt.Errorf("encoding params: %w", err)
+		}
+
+		err = writer.Write([]string{
+			event.At.Format(time.RFC3339Nano),
+			string(event.From),
+			string(event.To),
+			string(event.Result),
+			string(params),
+			string(event.Event),
+			string(event.Requested),
+		})
+		if err != nil {
+			return fmt.Errorf("writing csv: %w", err)
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// exportHistoryJSON writes the events as a JSON array
+func exportHistoryJSON(w io.Writer, events []TransitionEvent) error {
+	if events == nil {
+		events = []TransitionEvent{}
+	}
+
+	err := json.NewEncoder(w).Encode(events)
+	if err != nil {
+		return fmt.Errorf("encoding json: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SetFallback defines the state firing event in the from state transitions the StateMachine into when the rules
+// reject the transition into the state the event leads to, including the state chosen by AddChoice, so that the
+// event is not dropped, e.g. routing a claim into manual review when it may not be approved automatically
+// The fallback transition itself still has to be allowed by the rules, the rejected transition is recorded like any
+// other, see SetRecordRejected
+func (sm *StateMachine) SetFallback(event Event, from, to State) error {
+	if sm.final {
+		return fmt.Errorf("events must be defined before finalization")
+	}
+
+	_, ok := sm.states[to]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	t := trigger{event: event, from: from}
+
+	_, ok = sm.events[t]
+	if !ok {
+		return fmt.Errorf("event: %v, state: %v, %w", event, from, EventNotHandled)
+	}
+
+	if sm.fallbacks == nil {
+		sm.fallbacks = map[trigger]State{}
+	}
+
+	sm.fallbacks[t] = to
+
+	return nil
+}
+
+// fallback returns the fallback of event in the current state, false if it has none
+func (sm *StateMachine) fallback(event Event) (State, bool) {
+	to, ok := sm.fallbacks[trigger{event: event, from: sm.state}]
+
+	return to, ok
+}
+
+// fire transitions the StateMachine into the state the event leads to, or into its fallback if the rules reject
+// that, and returns the state it attempted to transition into last
+func (sm *StateMachine) fire(ctx context.Context, event Event, params ...interface{}) (State, error) {
+	sm.final = true
+
+	to, ok := sm.target(event, params...)
+	if !ok {
+		return "", fmt.Errorf("event: %v, state: %v, %w", event, sm.state, EventNotHandled)
+	}
+
+	fallback, hasFallback := sm.fallback(event)
+
+	sm.firing = event
+	defer func() { sm.firing = "" }()
+
+	err := sm.TransitionContext(ctx, to, params...)
+	if !hasFallback || fallback == to || !errors.Is(err, TransitionNotAllowed) {
+		return to, err
+	}
+
+	sm.firing = event
+
+	return fallback, sm.TransitionContext(ctx, fallback, params...)
+}
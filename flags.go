@@ -0,0 +1,24 @@
+package main
+
+// FlagProvider tells whether a feature flag is enabled, it is implemented by adapters of feature flag services
+// The params of the transition are passed along, so that flags can be evaluated per user or tenant
+type FlagProvider interface {
+	Enabled(flag string, params ...interface{}) bool
+}
+
+// StaticFlags is a FlagProvider with fixed flag values, unknown flags are disabled
+type StaticFlags map[string]bool
+
+// Enabled is true if the flag is set to true
+func (f StaticFlags) Enabled(flag string, params ...interface{}) bool {
+	return f[flag]
+}
+
+// FlagGuard creates a condition for a ConditionalTransitionRule which is only met if the flag is enabled
+//
+//	sm.AddRule(NewConditionalTransitionRule(cart, checkout, FlagGuard(flags, "new-checkout-flow")))
+func FlagGuard(provider FlagProvider, flag string) func(params ...interface{}) bool {
+	return func(params ...interface{}) bool {
+		return provider.Enabled(flag, params...)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+)
+
+// FuzzTransitions decodes data into a sequence of transitions with params, applies them to a StateMachine
+// created by factory and checks that the structural invariants of the StateMachine hold after each of them:
+// the current state is always an existing state, failed transitions leave the StateMachine untouched
+// and the history forms a consistent chain ending in the current state
+// It is meant to be used as the body of a native fuzz test:
+//
+//	func FuzzOrder(f *testing.F) {
+//		f.Fuzz(func(t *testing.T, data []byte) {
+//			if err := FuzzTransitions(newOrderStateMachine, data); err != nil {
+//				t.Fatal(err)
+//			}
+//		})
+//	}
+func FuzzTransitions(factory func() *StateMachine, data []byte) error {
+	sm := factory()
+	states := sm.States()
+
+	for len(data) > 0 {
+		var to State
+		to, data = fuzzState(states, data)
+
+		var params []interface{}
+		params, data = fuzzParams(data)
+
+		from := sm.State()
+		length := len(allowedEvents(sm.History()))
+
+		err := sm.Transition(to, params...)
+
+		err = checkTransition(sm, from, to, length, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fuzzState decodes a target state from the first byte of data
+// Values beyond the existing states decode to a state which does not exist
+func fuzzState(states []State, data []byte) (State, []byte) {
+	i := int(data[0]) % (len(states) + 1)
+	if i == len(states) {
+		return State(fmt.Sprintf("fuzz-%d", data[0])), data[1:]
+	}
+
+	return states[i], data[1:]
+}
+
+// fuzzParams decodes up to three small integer params, the count is taken from the first byte of data
+func fuzzParams(data []byte) ([]interface{}, []byte) {
+	if len(data) == 0 {
+		return nil, data
+	}
+
+	count := int(data[0]) % 4
+	data = data[1:]
+
+	var params []interface{}
+	for i := 0; i < count && len(data) > 0; i++ {
+		params = append(params, int(data[0]%8))
+		data = data[1:]
+	}
+
+	return params, data
+}
+
+// checkTransition verifies the invariants of the StateMachine after attempting to transition from one state to another
+func checkTransition(sm *StateMachine, from, to State, length int, transitionErr error) error {
+	state := sm.State()
+
+	_, ok := sm.states[state]
+	if !ok {
+		return fmt.Errorf("state %v is not an existing state", state)
+	}
+
+	history := allowedEvents(sm.History())
+
+	switch {
+	case transitionErr != nil && state != from:
+		return fmt.Errorf("failed transition %v -> %v changed the state to %v", from, to, state)
+	case transitionErr != nil && len(history) != length:
+		return fmt.Errorf("failed transition %v -> %v changed the history", from, to)
+	case transitionErr == nil && state != to && (len(history) == 0 || history[len(history)-1].Requested != to):
+		return fmt.Errorf("transition %v -> %v ended in state %v", from, to, state)
+	}
+
+	for i, event := range history {
+		if i > 0 && event.From != history[i-1].To {
+			return fmt.Errorf("history entry %d starts in %v, previous entry ended in %v", i, event.From, history[i-1].To)
+		}
+	}
+
+	if len(history) > 0 && history[len(history)-1].To != state {
+		return fmt.Errorf("history ends in %v, current state is %v", history[len(history)-1].To, state)
+	}
+
+	return nil
+}
+
+// allowedEvents filters out the rejected transition attempts of a history
+func allowedEvents(history []TransitionEvent) []TransitionEvent {
+	var allowed []TransitionEvent
+	for _, event := range history {
+		if event.Result == Allowed {
+			allowed = append(allowed, event)
+		}
+	}
+
+	return allowed
+}
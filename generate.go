@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// DefinitionConfig parameterizes the definitions generated by RandomDefinition
+type DefinitionConfig struct {
+	States int
+	// Density is the probability of a rule between two states on top of the ones keeping every state reachable
+	Density float64
+	// GuardRatio is the probability of a rule being guarded, guards pass half of the time
+	GuardRatio float64
+	Seed       int64
+}
+
+// RandomDefinition returns a factory of a random, valid definition for fuzzing, benchmarks and simulations,
+// e.g. Bench(RandomDefinition(config), benchConfig)
+// The states are named S0, S1, ..., the machine starts in S0 and every state is reachable from it through rules
+// without guards, the factory creates the very same definition on every call for the same Seed,
+// including the results of the guards, which are drawn from a source seeded by Seed
+func RandomDefinition(config DefinitionConfig) func() *StateMachine {
+	if config.States < 1 {
+		config.States = 1
+	}
+
+	return func() *StateMachine {
+		r := rand.New(rand.NewSource(config.Seed))
+
+		states := make([]State, config.States)
+		for i := range states {
+			states[i] = State(fmt.Sprintf("S%d", i))
+		}
+
+		sm := NewStateMachine(states[0], states[1:]...)
+
+		reaching := map[edge]bool{}
+		for i := 1; i < len(states); i++ {
+			from := states[r.Intn(i)]
+			reaching[edge{from: from, to: states[i]}] = true
+			_ = sm.AddRule(NewSimpleTransitionRule(from, states[i]))
+		}
+
+		for _, from := range states {
+			for _, to := range states {
+				if from == to || reaching[edge{from: from, to: to}] || r.Float64() >= config.Density {
+					continue
+				}
+
+				if r.Float64() < config.GuardRatio {
+					_ = sm.AddRule(NewConditionalTransitionRule(from, to, ProbabilityGuard(0.5, rand.NewSource(r.Int63()))))
+
+					continue
+				}
+
+				_ = sm.AddRule(NewSimpleTransitionRule(from, to))
+			}
+		}
+
+		return sm
+	}
+}
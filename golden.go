@@ -0,0 +1,81 @@
+//go:build smtest
+
+// The golden-file helpers are only built with the smtest tag, like the other test helpers, so that testing is not
+// linked into production binaries
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// GoldenUpdateEnv is the environment variable which makes AssertGolden write the golden files instead of comparing
+// them, e.g. GOLDEN_UPDATE=1 go test ./...
+const GoldenUpdateEnv = "GOLDEN_UPDATE"
+
+// AssertGolden fails the test if the normalized export differs from the golden file at path, reporting the first
+// differing line, so exports like OpenAPI documents or generated tests can be regression-tested
+// The exporters of this package order states and edges alphabetically, so their output is stable between runs
+func AssertGolden(t testing.TB, path string, got []byte) {
+	t.Helper()
+
+	got = NormalizeExport(got)
+
+	if os.Getenv(GoldenUpdateEnv) != "" {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, got, 0o644)
+		}
+		if err != nil {
+			t.Fatalf("updating golden file %v: %v", path, err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file %v, run with %v=1 to create it: %v", path, GoldenUpdateEnv, err)
+	}
+
+	want = NormalizeExport(want)
+	if bytes.Equal(got, want) {
+		return
+	}
+
+	gotLines := bytes.Split(got, []byte("\n"))
+	wantLines := bytes.Split(want, []byte("\n"))
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w []byte
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+
+		if !bytes.Equal(g, w) {
+			t.Errorf("export differs from golden file %v at line %d:\n got: %s\nwant: %s", path, i+1, g, w)
+
+			return
+		}
+	}
+}
+
+// NormalizeExport removes the differences of exports which do not matter: Windows line endings,
+// trailing whitespace of lines and trailing empty lines, so the export ends with a single newline
+func NormalizeExport(data []byte) []byte {
+	lines := bytes.Split(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t")
+	}
+
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return append(bytes.Join(lines, []byte("\n")), '\n')
+}
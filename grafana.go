@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GrafanaDashboard generates a Grafana dashboard for the metrics written by WritePrometheus for a definition,
+// with one panel per state showing its instances and dwell times and one panel per edge showing its transition rate,
+// ready to be imported
+// datasource is the UID of the Prometheus data source the panels query
+func GrafanaDashboard(definition *StateMachine, machine, datasource string) ([]byte, error) {
+	const width, height, columns = 8, 8, 3
+
+	var panels []map[string]interface{}
+	panel := func(title string, targets ...map[string]interface{}) {
+		i := len(panels)
+		for j, target := range targets {
+			target["refId"] = string(rune('A' + j))
+		}
+
+		panels = append(panels, map[string]interface{}{
+			"id":    i + 1,
+			"type":  "timeseries",
+			"title": title,
+			"gridPos": map[string]interface{}{
+				"h": height,
+				"w": width,
+				"x": i % columns * width,
+				"y": i / columns * height,
+			},
+			"datasource": map[string]interface{}{"type": "prometheus", "uid": datasource},
+			"targets":    targets,
+		})
+	}
+
+	target := func(expr, legend string) map[string]interface{} {
+		return map[string]interface{}{"expr": expr, "legendFormat": legend}
+	}
+
+	for _, state := range definition.States() {
+		panel(
+			fmt.Sprintf("State %v", state),
+			target(fmt.Sprintf("%s{machine=%q,state=%q}", MetricInstances, machine, state), "instances"),
+			target(fmt.Sprintf("%s{machine=%q,state=%q,quantile=\"0.9\"}", MetricDwell, machine, state), "dwell p90 (s)"),
+		)
+	}
+
+	for _, e := range sortedEdgeSet(edgeSet(definition)) {
+		panel(
+			fmt.Sprintf("%v -> %v", e.From, e.To),
+			target(fmt.Sprintf("rate(%s{machine=%q,from=%q,to=%q}[$__rate_interval])", MetricTransitions, machine, e.From, e.To), "transitions/s"),
+		)
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"title":         fmt.Sprintf("State machine: %s", machine),
+		"tags":          []string{"statemachine", machine},
+		"schemaVersion": 39,
+		"refresh":       "30s",
+		"time":          map[string]interface{}{"from": "now-6h", "to": "now"},
+		"panels":        panels,
+	}, "", "  ")
+}
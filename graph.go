@@ -0,0 +1,114 @@
+package main
+
+// StateMetrics describes the edges of a single state
+type StateMetrics struct {
+	State  State
+	FanIn  int
+	FanOut int
+}
+
+// GraphMetrics describes the size and complexity of a StateMachine definition
+type GraphMetrics struct {
+	States []StateMetrics
+	Edges  int
+	// LongestPath is the longest path visiting every state at most once
+	LongestPath []State
+	// Cycles lists every elementary cycle, starting from its alphabetically first state
+	Cycles [][]State
+	// CyclomaticComplexity is the number of linearly independent paths: edges - states + 2
+	CyclomaticComplexity int
+	// Density is the ratio of existing edges to all possible edges between distinct states
+	Density float64
+}
+
+// Metrics analyses the graph of states and edges of the StateMachine
+// Guards are ignored, every edge with at least one rule counts
+// Finding the longest path and the cycles takes exponential time, which is fine for workflows of a usual size
+func (sm *StateMachine) Metrics() GraphMetrics {
+	states := sm.States()
+	metrics := GraphMetrics{}
+
+	fanIn := map[State]int{}
+	for _, from := range states {
+		for _, to := range sm.Targets(from) {
+			fanIn[to]++
+			metrics.Edges++
+		}
+	}
+
+	for _, state := range states {
+		metrics.States = append(metrics.States, StateMetrics{
+			State:  state,
+			FanIn:  fanIn[state],
+			FanOut: len(sm.Targets(state)),
+		})
+	}
+
+	metrics.LongestPath = longestPath(states, sm.Targets)
+	metrics.Cycles = elementaryCycles(states, sm.Targets)
+	metrics.CyclomaticComplexity = metrics.Edges - len(states) + 2
+
+	if len(states) > 1 {
+		metrics.Density = float64(metrics.Edges) / float64(len(states)*(len(states)-1))
+	}
+
+	return metrics
+}
+
+// longestPath finds the longest simple path of a graph by exhaustive search
+func longestPath(states []State, next func(State) []State) []State {
+	var longest []State
+	visited := map[State]bool{}
+
+	var walk func(path []State)
+	walk = func(path []State) {
+		if len(path) > len(longest) {
+			longest = append([]State(nil), path...)
+		}
+
+		for _, to := range next(path[len(path)-1]) {
+			if visited[to] {
+				continue
+			}
+
+			visited[to] = true
+			walk(append(path, to))
+			visited[to] = false
+		}
+	}
+
+	for _, state := range states {
+		visited[state] = true
+		walk([]State{state})
+		visited[state] = false
+	}
+
+	return longest
+}
+
+// elementaryCycles finds every elementary cycle of a graph
+// Each cycle is found from its alphabetically first state only, so that it is reported once
+func elementaryCycles(states []State, next func(State) []State) [][]State {
+	var result [][]State
+	visited := map[State]bool{}
+
+	for _, start := range states {
+		var walk func(path []State)
+		walk = func(path []State) {
+			for _, to := range next(path[len(path)-1]) {
+				switch {
+				case to == start:
+					result = append(result, append([]State(nil), path...))
+				case to > start && !visited[to]:
+					visited[to] = true
+					walk(append(path, to))
+					visited[to] = false
+				}
+			}
+		}
+
+		walk([]State{start})
+	}
+
+	return result
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"time"
+)
+
+// Names of the built-in timers of a StateMachine, see MachineView.Timers
+const (
+	TimerTimeInState = "timeInState"
+	TimerAge         = "age"
+)
+
+// MachineView is a read-only view of a StateMachine passed to the guards of ViewTransitionRules, so that they can
+// depend on the current state, the time spent in it and the recent history without external bookkeeping
+// The view is only valid while the guard is evaluated
+type MachineView struct {
+	sm    *StateMachine
+	state State
+}
+
+// State returns the current state
+func (v MachineView) State() State {
+	return v.state
+}
+
+// Entered returns when the current state was entered, the initial state is entered when the StateMachine is
+// created, see StateMachine.Entered, false without a StateMachine
+func (v MachineView) Entered() (time.Time, bool) {
+	if v.sm == nil {
+		return time.Time{}, false
+	}
+
+	return v.sm.Entered(), true
+}
+
+// TimeInState returns the time spent in the current state according to the clock of the StateMachine,
+// zero without a StateMachine, see Entered
+func (v MachineView) TimeInState() time.Duration {
+	if v.sm == nil {
+		return 0
+	}
+
+	return v.sm.TimeInState()
+}
+
+// Age returns the age of the StateMachine, zero without a StateMachine, see StateMachine.Age
+func (v MachineView) Age() time.Duration {
+	if v.sm == nil {
+		return 0
+	}
+
+	return v.sm.Age()
+}
+
+// Timers returns the built-in timers of the StateMachine by name, TimerTimeInState with the time since the current
+// state was entered, see TimeInState, and TimerAge with the age of the StateMachine
+// Script guards receive them as variables, so that guards such as "timeInState > duration('24h')" need no
+// timestamps passed as params
+func (v MachineView) Timers() map[string]time.Duration {
+	return map[string]time.Duration{
+		TimerTimeInState: v.TimeInState(),
+		TimerAge:         v.Age(),
+	}
+}
+
+// Recent returns a copy of the last n events of the history, or fewer if the history is shorter
+// Rejected transitions are only included if they are recorded, see SetRecordRejected
+func (v MachineView) Recent(n int) []TransitionEvent {
+	if v.sm == nil || n <= 0 {
+		return nil
+	}
+
+	history := v.sm.history
+	if n > len(history) {
+		n = len(history)
+	}
+
+	return append([]TransitionEvent(nil), history[len(history)-n:]...)
+}
+
+// Count returns the number of events of the history matching match, e.g. the failed attempts of a retry
+func (v MachineView) Count(match func(event TransitionEvent) bool) int {
+	if v.sm == nil {
+		return 0
+	}
+
+	count := 0
+	for _, event := range v.sm.history {
+		if match(event) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// ViewRule is a TransitionRule whose guard reads the StateMachine evaluating it, the StateMachine calls ValidIn
+// instead of Valid
+type ViewRule interface {
+	TransitionRule
+	ValidIn(view MachineView, from, to State, params ...interface{}) bool
+}
+
+// ViewTransitionRule allows the transition between two states only if a condition on the StateMachine and the
+// params is met, e.g. only allowing a retry after fewer than 3 failed attempts
+type ViewTransitionRule struct {
+	from      State
+	to        State
+	condition func(view MachineView, params ...interface{}) bool
+}
+
+// NewViewTransitionRule creates a new ViewTransitionRule
+func NewViewTransitionRule(from, to State, condition func(view MachineView, params ...interface{}) bool) *ViewTransitionRule {
+	return &ViewTransitionRule{
+		from:      from,
+		to:        to,
+		condition: condition,
+	}
+}
+
+// From retrieves the start state the transition rule applies to
+func (r *ViewTransitionRule) From() State {
+	return r.from
+}
+
+// To retrieves the end state the transition rule applies to
+func (r *ViewTransitionRule) To() State {
+	return r.to
+}
+
+// Valid is true if transitioning between two states is allowed, evaluated without a StateMachine the view has
+// the start state and no history, e.g. in a compiled StateMachine
+func (r *ViewTransitionRule) Valid(from, to State, params ...interface{}) bool {
+	return r.ValidIn(MachineView{state: from}, from, to, params...)
+}
+
+// ValidIn is true if transitioning between two states of the viewed StateMachine is allowed
+func (r *ViewTransitionRule) ValidIn(view MachineView, from, to State, params ...interface{}) bool {
+	return from == r.from && to == r.to && r.condition(view, params...)
+}
+
+// valid evaluates a rule of the StateMachine, passing a view of it to ViewRules
+func (sm *StateMachine) valid(rule TransitionRule, from, to State, params ...interface{}) bool {
+	if viewRule, ok := unwrap(rule).(ViewRule); ok {
+		return viewRule.ValidIn(MachineView{sm: sm, state: from}, from, to, params...)
+	}
+
+	return rule.Valid(from, to, params...)
+}
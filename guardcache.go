@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// guardKey identifies a cached guard result by the rule and the fingerprint of the params it was evaluated with
+type guardKey struct {
+	rule        *CachedTransitionRule
+	fingerprint string
+}
+
+// guardEntry is a cached guard result
+type guardEntry struct {
+	valid   bool
+	expires time.Time
+}
+
+// GuardCache caches the results of expensive guards for a while, see CachedTransitionRule
+// A single GuardCache can be shared by many rules
+type GuardCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	clock   Clock
+	entries map[guardKey]guardEntry
+	swept   int
+}
+
+// NewGuardCache creates a new GuardCache keeping results for ttl
+func NewGuardCache(ttl time.Duration, clock Clock) *GuardCache {
+	return &GuardCache{
+		ttl:     ttl,
+		clock:   clock,
+		entries: map[guardKey]guardEntry{},
+	}
+}
+
+// CachedTransitionRule wraps a rule whose guard is pure but expensive, e.g. a remote entitlement check,
+// so that its result is reused for the same params until the TTL of the GuardCache passes
+// Params are told apart by their Go syntax representation, so they should be values like IDs, not pointers
+// To combine it with a PassThroughTransitionRule, wrap the CachedTransitionRule into it, not the other way around
+type CachedTransitionRule struct {
+	TransitionRule
+	cache *GuardCache
+}
+
+// NewCachedTransitionRule creates a new CachedTransitionRule
+func NewCachedTransitionRule(rule TransitionRule, cache *GuardCache) *CachedTransitionRule {
+	return &CachedTransitionRule{
+		TransitionRule: rule,
+		cache:          cache,
+	}
+}
+
+// Valid returns the cached result of the wrapped rule for the params, evaluating it if it is not cached
+func (r *CachedTransitionRule) Valid(from, to State, params ...interface{}) bool {
+	if from != r.From() || to != r.To() {
+		return r.TransitionRule.Valid(from, to, params...)
+	}
+
+	key := guardKey{rule: r, fingerprint: fingerprint(params)}
+
+	valid, ok := r.cache.get(key)
+	if ok {
+		return valid
+	}
+
+	valid = r.TransitionRule.Valid(from, to, params...)
+	r.cache.put(key, valid)
+
+	return valid
+}
+
+// fingerprint tells params apart by their Go syntax representation
+func fingerprint(params []interface{}) string {
+	return fmt.Sprintf("%#v", params)
+}
+
+// get returns a cached result unless it expired
+func (c *GuardCache) get(key guardKey) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+
+	if !c.clock.Now().Before(entry.expires) {
+		delete(c.entries, key)
+
+		return false, false
+	}
+
+	return entry.valid, true
+}
+
+// put caches a result, sweeping expired results whenever the cache doubled in size since the last sweep
+func (c *GuardCache) put(key guardKey, valid bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	if len(c.entries) >= 2*c.swept+64 {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = len(c.entries)
+	}
+
+	c.entries[key] = guardEntry{valid: valid, expires: now.Add(c.ttl)}
+}
+
+// Invalidate drops the cached results of a rule, e.g. when the entitlements it checks changed
+func (c *GuardCache) Invalidate(rule *CachedTransitionRule) {
+	c.invalidate(func(key guardKey) bool {
+		return key.rule == rule
+	})
+}
+
+// InvalidateParams drops the cached results of every rule for the params, e.g. when the entitlements of the user
+// identified by them changed
+func (c *GuardCache) InvalidateParams(params ...interface{}) {
+	f := fingerprint(params)
+	c.invalidate(func(key guardKey) bool {
+		return key.fingerprint == f
+	})
+}
+
+// invalidate drops the cached results for which match is true
+func (c *GuardCache) invalidate(match func(key guardKey) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Clear drops every cached result
+func (c *GuardCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[guardKey]guardEntry{}
+	c.swept = 0
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// HealthLimits are the thresholds beyond which a Manager is not ready to take more traffic, 0 means no limit
+type HealthLimits struct {
+	// MaxQueueDepth limits the number of events queued in each watched Mailbox
+	MaxQueueDepth int
+	// MaxTimerBacklog limits the number of timers which are due but not processed yet
+	MaxTimerBacklog int
+}
+
+// HealthReport describes the health of a Manager, Failures lists the failed checks
+type HealthReport struct {
+	Healthy      bool           `json:"healthy"`
+	Failures     []string       `json:"failures,omitempty"`
+	QueueDepths  map[string]int `json:"queueDepths,omitempty"`
+	TimerBacklog int            `json:"timerBacklog"`
+}
+
+// SetHealthLimits sets the HealthLimits checked by Readyz
+func (m *Manager) SetHealthLimits(limits HealthLimits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.healthLimits = limits
+}
+
+// AddHealthCheck adds a check run by Readyz, e.g. pinging the database instances are persisted in
+func (m *Manager) AddHealthCheck(name string, check func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.healthChecks[name] = check
+}
+
+// WatchQueue makes Readyz report the depth of the event queue of a Mailbox
+func (m *Manager) WatchQueue(name string, mb *Mailbox) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queues[name] = mb
+}
+
+// Healthz reports whether the Manager is alive, i.e. it can still be locked before ctx is done,
+// orchestration platforms usually restart an unhealthy process
+func (m *Manager) Healthz(ctx context.Context) HealthReport {
+	locked := make(chan struct{})
+	go func() {
+		m.mu.RLock()
+		m.mu.RUnlock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return HealthReport{Healthy: true}
+	case <-ctx.Done():
+		return HealthReport{Failures: []string{fmt.Sprintf("manager: %v", contextErr(ctx))}}
+	}
+}
+
+// Readyz reports whether the Manager is ready to take traffic: every health check passes, the TimerStore can be
+// read, the event queues and the timer backlog are within the HealthLimits, and the Manager is not shut down
+func (m *Manager) Readyz(ctx context.Context) HealthReport {
+	m.mu.RLock()
+	limits := m.healthLimits
+	checks := make(map[string]func(ctx context.Context) error, len(m.healthChecks))
+	for name, check := range m.healthChecks {
+		checks[name] = check
+	}
+	queues := make(map[string]*Mailbox, len(m.queues))
+	for name, mb := range m.queues {
+		queues[name] = mb
+	}
+	m.mu.RUnlock()
+
+	report := HealthReport{QueueDepths: map[string]int{}}
+	if m.closed.Load() {
+		report.Failures = append(report.Failures, fmt.Sprintf("manager: %v", ManagerShutDown))
+	}
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := checks[name](ctx)
+		if err != nil {
+			report.Failures = append(report.Failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	timers, err := m.timerStore.Timers()
+	if err != nil {
+		report.Failures = append(report.Failures, fmt.Sprintf("timers: %v", err))
+	}
+
+	now := m.clock.Now()
+	for _, timer := range timers {
+		if !timer.Due.After(now) {
+			report.TimerBacklog++
+		}
+	}
+
+	if limits.MaxTimerBacklog > 0 && report.TimerBacklog > limits.MaxTimerBacklog {
+		report.Failures = append(report.Failures, fmt.Sprintf("timers: %d due, limit is %d", report.TimerBacklog, limits.MaxTimerBacklog))
+	}
+
+	names = names[:0]
+	for name := range queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		depth := queues[name].Len()
+		report.QueueDepths[name] = depth
+
+		if limits.MaxQueueDepth > 0 && depth > limits.MaxQueueDepth {
+			report.Failures = append(report.Failures, fmt.Sprintf("queue %s: %d events, limit is %d", name, depth, limits.MaxQueueDepth))
+		}
+	}
+
+	report.Healthy = len(report.Failures) == 0
+
+	return report
+}
+
+// HealthHandler serves Healthz at /healthz and Readyz at /readyz, with 503 Service Unavailable for failures
+func (m *Manager) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, m.Healthz(r.Context()))
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, m.Readyz(r.Context()))
+	})
+
+	return mux
+}
+
+// writeHealth writes a HealthReport with the status code matching it
+func writeHealth(w http.ResponseWriter, report HealthReport) {
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// wildcardHooks are the actions called for every transition regardless of its edge
+type wildcardHooks struct {
+	exit       []Action
+	transition []Action
+	enter      []Action
+}
+
+// OnAnyExit adds an action which is called whenever any state is left, before the actions of the edge
+func (sm *StateMachine) OnAnyExit(action Action) error {
+	if sm.final {
+		return fmt.Errorf("actions must be defined before finalization")
+	}
+
+	sm.hooks.exit = append(sm.hooks.exit, action)
+
+	return nil
+}
+
+// OnAnyTransition adds an action which is called after every transition, before the actions of the edge
+func (sm *StateMachine) OnAnyTransition(action Action) error {
+	if sm.final {
+		return fmt.Errorf("actions must be defined before finalization")
+	}
+
+	sm.hooks.transition = append(sm.hooks.transition, action)
+
+	return nil
+}
+
+// OnAnyEnter adds an action which is called whenever any state is entered, after the actions of the edge
+func (sm *StateMachine) OnAnyEnter(action Action) error {
+	if sm.final {
+		return fmt.Errorf("actions must be defined before finalization")
+	}
+
+	sm.hooks.enter = append(sm.hooks.enter, action)
+
+	return nil
+}
+
+// OnEnter adds an entry action which is called whenever the state is entered, after the actions of the edge and
+// before the enter hooks, the action can tell the incoming transition by the From and Event of the TransitionEvent
+func (sm *StateMachine) OnEnter(state State, action Action) error {
+	if sm.final {
+		return fmt.Errorf("actions must be defined before finalization")
+	}
+
+	_, ok := sm.states[state]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", state, StateNotFound)
+	}
+
+	sm.entries[state] = append(sm.entries[state], action)
+
+	return nil
+}
+
+// OnEnterVia adds an entry action which is only called when the state is entered by firing the event, e.g. entering
+// Closed via cancel but not via complete, see OnEnter
+func (sm *StateMachine) OnEnterVia(state State, event Event, action Action) error {
+	return sm.OnEnter(state, func(ctx context.Context, transition TransitionEvent) error {
+		if transition.Event != event {
+			return nil
+		}
+
+		return action(ctx, transition)
+	})
+}
+
+// edgeActions returns every action called for a transition between two states in order: the exit hooks,
+// the transition hooks, the actions of the edge, the entry actions of the end state and the enter hooks
+func (sm *StateMachine) edgeActions(from, to State) []Action {
+	actions := sm.actions[edge{from: from, to: to}]
+	entries := sm.entries[to]
+	if len(sm.hooks.exit)+len(sm.hooks.transition)+len(entries)+len(sm.hooks.enter) == 0 {
+		return actions
+	}
+
+	all := make([]Action, 0, len(sm.hooks.exit)+len(sm.hooks.transition)+len(actions)+len(entries)+len(sm.hooks.enter))
+	all = append(all, sm.hooks.exit...)
+	all = append(all, sm.hooks.transition...)
+	all = append(all, actions...)
+	all = append(all, entries...)
+
+	return append(all, sm.hooks.enter...)
+}
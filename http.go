@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	InvalidRequest = fmt.Errorf("error: invalid request")
+)
+
+// instanceResponse is the JSON representation of an instance
+type instanceResponse struct {
+	ID    string `json:"id"`
+	State State  `json:"state"`
+}
+
+// createRequest is the body of a request creating an instance
+type createRequest struct {
+	ID string `json:"id"`
+}
+
+// transitionRequest is the body of a request transitioning an instance
+type transitionRequest struct {
+	To     State         `json:"to"`
+	Params []interface{} `json:"params,omitempty"`
+}
+
+// eventRequest is the body of a request firing an event on an instance
+type eventRequest struct {
+	Params []interface{} `json:"params,omitempty"`
+}
+
+// errorResponse is the body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns an http.Handler exposing the instances of a Manager as a REST API,
+// new instances are created by definition
+// The API is described by the OpenAPI document served at /openapi.json
+func NewHandler(m *Manager, definition func() *StateMachine) http.Handler {
+	spec, err := OpenAPI(definition(), "State machine API")
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(spec)
+	})
+
+	mux.HandleFunc("POST /instances", func(w http.ResponseWriter, r *http.Request) {
+		var req createRequest
+		err := decodeRequest(r, &req)
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		sm := definition()
+		err = m.Add(req.ID, sm)
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, instanceResponse{ID: req.ID, State: sm.State()})
+	})
+
+	mux.HandleFunc("GET /instances/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeInstance(w, m, r.PathValue("id"), nil)
+	})
+
+	mux.HandleFunc("GET /instances/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+		history, err := m.History(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, history)
+	})
+
+	mux.HandleFunc("POST /instances/{id}/transitions", func(w http.ResponseWriter, r *http.Request) {
+		var req transitionRequest
+		err := decodeRequest(r, &req)
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		id := r.PathValue("id")
+		writeInstance(w, m, id, m.TransitionContext(r.Context(), id, req.To, req.Params...))
+	})
+
+	mux.HandleFunc("POST /instances/{id}/events/{event}", func(w http.ResponseWriter, r *http.Request) {
+		var req eventRequest
+		err := decodeRequest(r, &req)
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		id := r.PathValue("id")
+		writeInstance(w, m, id, m.FireContext(r.Context(), id, Event(r.PathValue("event")), req.Params...))
+	})
+
+	return mux
+}
+
+// decodeRequest decodes the JSON body of a request, an empty body is accepted
+// Whole numbers in params are decoded as int, other numbers as float64
+func decodeRequest(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	err := decoder.Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %w", InvalidRequest, err)
+	}
+
+	switch req := v.(type) {
+	case *transitionRequest:
+		decodeParams(req.Params)
+	case *eventRequest:
+		decodeParams(req.Params)
+	}
+
+	return nil
+}
+
+// decodeParams converts the JSON numbers of params in place
+func decodeParams(params []interface{}) {
+	for i, param := range params {
+		params[i] = jsonParam(param)
+	}
+}
+
+// writeInstance writes the instance with the given ID, or err if it is not nil
+func writeInstance(w http.ResponseWriter, m *Manager, id string, err error) {
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	state, err := m.State(id)
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, instanceResponse{ID: id, State: state})
+}
+
+// writeError writes an error with the status code matching it
+// Deferred transitions are accepted, they are taken once the window of their calendar opens
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, InvalidRequest), errors.Is(err, StateNotFound):
+		status = http.StatusBadRequest
+	case errors.Is(err, InstanceNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, InstanceExists), errors.Is(err, TransitionNotAllowed), errors.Is(err, EventNotHandled),
+		errors.Is(err, ErrTransitionInProgress):
+		status = http.StatusConflict
+	case errors.Is(err, TransitionDeferred):
+		status = http.StatusAccepted
+	case errors.Is(err, TransitionThrottled):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ManagerShutDown):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, ErrDeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
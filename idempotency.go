@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IdempotencyStore remembers the keys of actions which already succeeded
+type IdempotencyStore interface {
+	Done(key string) (bool, error)
+	MarkDone(key string) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore keeping keys in memory, it does not survive restarts on its own
+type MemoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// NewMemoryIdempotencyStore creates a new MemoryIdempotencyStore
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		keys: map[string]bool{},
+	}
+}
+
+// Done is true if the key was marked done
+func (s *MemoryIdempotencyStore) Done(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.keys[key], nil
+}
+
+// MarkDone marks the key done
+func (s *MemoryIdempotencyStore) MarkDone(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key] = true
+
+	return nil
+}
+
+// IdempotencyKey returns a key identifying a transition, the same when the transition is recovered from a journal,
+// e.g. to pass to an external API as an idempotency key
+// Within actions, the key includes the ID of the instance, see InstanceIDFrom, and the number of transitions the
+// StateMachine took, so that instances taking the same transition at the same time do not share keys
+func IdempotencyKey(ctx context.Context, event TransitionEvent) string {
+	id, _ := InstanceIDFrom(ctx)
+
+	seq := 0
+	if sm, ok := MetadataFrom(ctx); ok {
+		seq = sm.taken()
+	}
+
+	return fmt.Sprintf("%s#%d:%v->%v@%v", id, seq, event.From, event.To, event.At.UTC().Format(time.RFC3339Nano))
+}
+
+// taken returns the number of transitions the StateMachine took according to its history
+func (sm *StateMachine) taken() int {
+	n := 0
+	for _, event := range sm.history {
+		if event.Result == Allowed {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Idempotent wraps an action so that it is skipped for transitions it already succeeded for, e.g. when Recover
+// retries the actions of a transition, the name must be unique among the actions sharing the store, StateMachines
+// outside of a Manager sharing a store must have distinct names
+// The action may still run more than once if the process crashes between running it and marking it done
+func Idempotent(name string, store IdempotencyStore, action Action) Action {
+	return func(ctx context.Context, event TransitionEvent) error {
+		key := name + ":" + IdempotencyKey(ctx, event)
+
+		done, err := store.Done(key)
+		if err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+
+		err = action(ctx, event)
+		if err != nil {
+			return err
+		}
+
+		return store.MarkDone(key)
+	}
+}
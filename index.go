@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sort"
+)
+
+// CountInState returns the number of instances in a state without looking at the instances
+func (m *Manager) CountInState(state State) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.byState[state])
+}
+
+// InState returns the IDs of the instances in a state in alphabetical order
+func (m *Manager) InState(state State) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.byState[state]))
+	for id := range m.byState[state] {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// index adds an instance to the state index, m.mu must be held
+func (m *Manager) index(id string, state State) {
+	if m.byState[state] == nil {
+		m.byState[state] = map[string]bool{}
+	}
+
+	m.byState[state][id] = true
+}
+
+// unindex removes an instance from the state index and returns its indexed state, m.mu must be held
+func (m *Manager) unindex(id string) State {
+	for state, ids := range m.byState {
+		if ids[id] {
+			delete(ids, id)
+
+			return state
+		}
+	}
+
+	return ""
+}
+
+// reindex moves an instance between two states of the state index
+// It is called while holding the lock of the instance, so the index is updated together with the transition
+// Transitions done on the StateMachine directly, bypassing the Manager, are not reflected in the index
+func (m *Manager) reindex(id string, from, to State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.instances[id]
+	if !ok {
+		return
+	}
+
+	delete(m.byState[from], id)
+	m.index(id, to)
+}
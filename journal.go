@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// JournalEntry records that a transition began, or with Done, that every action of it succeeded,
+// or with RolledBack too, that it was undone, see Rollback
+type JournalEntry struct {
+	Seq        uint64          `json:"seq"`
+	Event      TransitionEvent `json:"event"`
+	Done       bool            `json:"done"`
+	RolledBack bool            `json:"rolledBack,omitempty"`
+}
+
+// Journal persists the transitions of a StateMachine until their actions succeeded
+type Journal interface {
+	Append(entry JournalEntry) error
+	Entries() ([]JournalEntry, error)
+}
+
+// MemoryJournal is a Journal keeping entries in memory, it does not survive restarts on its own
+type MemoryJournal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+}
+
+// NewMemoryJournal creates a new MemoryJournal
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{}
+}
+
+// Append adds an entry to the journal
+func (j *MemoryJournal) Append(entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, entry)
+
+	return nil
+}
+
+// Entries returns every entry in the order they were appended
+func (j *MemoryJournal) Entries() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]JournalEntry(nil), j.entries...), nil
+}
+
+// SetJournal sets the Journal of the StateMachine, transitions are journaled so that Recover can retry their actions
+// after a crash, which makes actions run at least once
+func (sm *StateMachine) SetJournal(journal Journal) error {
+	entries, err := journal.Entries()
+	if err != nil {
+		return fmt.Errorf("loading journal: %w", err)
+	}
+
+	sm.journal = journal
+	for _, entry := range entries {
+		if entry.Seq > sm.journalSeq {
+			sm.journalSeq = entry.Seq
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the journaled transitions whose actions did not all succeed, in the order they began
+func (sm *StateMachine) Pending() ([]JournalEntry, error) {
+	if sm.journal == nil {
+		return nil, nil
+	}
+
+	entries, err := sm.journal.Entries()
+	if err != nil {
+		return nil, fmt.Errorf("loading journal: %w", err)
+	}
+
+	begun := map[uint64]JournalEntry{}
+	for _, entry := range entries {
+		if entry.Done {
+			delete(begun, entry.Seq)
+		} else {
+			begun[entry.Seq] = entry
+		}
+	}
+
+	pending := make([]JournalEntry, 0, len(begun))
+	for _, entry := range begun {
+		pending = append(pending, entry)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Seq < pending[j].Seq
+	})
+
+	return pending, nil
+}
+
+// Recover retries the actions of the pending transitions of the journal, e.g. after restoring a StateMachine which
+// crashed during a transition, stopping at the first failing one
+// A StateMachine still in the start state of a pending transition, e.g. one restored from an earlier snapshot, is
+// moved into its end state first, one in any other state can not be recovered
+// Actions may run more than once, see Idempotent, use Rollback to undo pending transitions instead
+func (sm *StateMachine) Recover(ctx context.Context) error {
+	pending, err := sm.Pending()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range pending {
+		event := entry.Event
+
+		switch sm.state {
+		case event.From:
+			sm.apply(event)
+		case event.To:
+		default:
+			return fmt.Errorf("transition: %v -> %v, state: %v, %w", event.From, event.To, sm.state, TransitionNotAllowed)
+		}
+
+		err = sm.runActions(ctx, event)
+		if err != nil {
+			return err
+		}
+
+		err = sm.journalDone(entry.Seq, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// journalBegin journals a transition which is about to be applied, it returns the sequence number of the entry
+func (sm *StateMachine) journalBegin(event TransitionEvent) (uint64, error) {
+	if sm.journal == nil {
+		return 0, nil
+	}
+
+	sm.journalSeq++
+	err := sm.journal.Append(JournalEntry{Seq: sm.journalSeq, Event: event})
+	if err != nil {
+		return 0, fmt.Errorf("journaling: %w", err)
+	}
+
+	return sm.journalSeq, nil
+}
+
+// journalDone journals that every action of a transition succeeded
+func (sm *StateMachine) journalDone(seq uint64, event TransitionEvent) error {
+	if sm.journal == nil {
+		return nil
+	}
+
+	err := sm.journal.Append(JournalEntry{Seq: seq, Event: event, Done: true})
+	if err != nil {
+		return fmt.Errorf("transition: %v -> %v, journaling: %w", event.From, event.To, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var KeyNotFound = fmt.Errorf("error: key not found")
+
+// KVEvent is a change of a key seen by a watch, Value is empty for deleted keys
+// Revision is the revision of the key after the change
+type KVEvent struct {
+	Key      string
+	Value    []byte
+	Revision int64
+	Deleted  bool
+}
+
+// KVPut is a conditional write of a key, it only succeeds if the key still has Revision, 0 for a key which must not
+// exist yet
+type KVPut struct {
+	Value    []byte
+	Revision int64
+}
+
+// KV is a clustered key-value store like etcd or Consul, adapters wrap the client of the store
+// Get returns the value of a key with its revision, which changes with every write of the key, e.g. the ModRevision
+// in etcd or the ModifyIndex in Consul, and KeyNotFound for missing keys
+// PutAll writes every value or none of them, each only if the key still has the revision of its KVPut, otherwise it
+// fails with ConditionFailed, e.g. in an etcd transaction comparing ModRevisions or a Consul transaction with
+// check-and-set operations, and returns the new revisions of the keys
+// Watch sends the changes of the keys starting with prefix until ctx is done, then closes the channel
+type KV interface {
+	Get(ctx context.Context, key string) ([]byte, int64, error)
+	PutAll(ctx context.Context, puts map[string]KVPut) (map[string]int64, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]string, error)
+	Watch(ctx context.Context, prefix string) <-chan KVEvent
+}
+
+// MemoryKV is a KV keeping values in memory, it does not survive restarts on its own
+// Revisions count the writes of a key, the changes are queued for watchers which do not keep up, so none are missed
+type MemoryKV struct {
+	mu       sync.Mutex
+	values   map[string]kvValue
+	watchers map[*kvWatcher]bool
+}
+
+// kvValue is a value of a MemoryKV with its revision
+type kvValue struct {
+	data     []byte
+	revision int64
+}
+
+// kvWatcher is a watch of a MemoryKV, ready is signaled when changes are queued
+type kvWatcher struct {
+	prefix string
+	queue  []KVEvent
+	ready  chan struct{}
+}
+
+// NewMemoryKV creates a new MemoryKV
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		values:   map[string]kvValue{},
+		watchers: map[*kvWatcher]bool{},
+	}
+}
+
+// Get returns the value of a key with its revision
+func (kv *MemoryKV) Get(_ context.Context, key string) ([]byte, int64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	value, ok := kv.values[key]
+	if !ok {
+		return nil, 0, fmt.Errorf("key: %v, %w", key, KeyNotFound)
+	}
+
+	return append([]byte(nil), value.data...), value.revision, nil
+}
+
+// PutAll adds or replaces values if none of the keys was changed since the revisions of the puts
+func (kv *MemoryKV) PutAll(_ context.Context, puts map[string]KVPut) (map[string]int64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	for key, put := range puts {
+		if kv.values[key].revision != put.Revision {
+			return nil, fmt.Errorf("key: %v, %w", key, ConditionFailed)
+		}
+	}
+
+	revisions := make(map[string]int64, len(puts))
+	for key, put := range puts {
+		value := kvValue{data: append([]byte(nil), put.Value...), revision: put.Revision + 1}
+		kv.values[key] = value
+		revisions[key] = value.revision
+
+		kv.publish(KVEvent{Key: key, Value: value.data, Revision: value.revision})
+	}
+
+	return revisions, nil
+}
+
+// Delete removes a key, removing a missing key is not an error
+func (kv *MemoryKV) Delete(_ context.Context, key string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	_, ok := kv.values[key]
+	if ok {
+		delete(kv.values, key)
+		kv.publish(KVEvent{Key: key, Deleted: true})
+	}
+
+	return nil
+}
+
+// List returns the keys starting with prefix in lexical order
+func (kv *MemoryKV) List(_ context.Context, prefix string) ([]string, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	var keys []string
+	for key := range kv.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Watch sends the changes of the keys starting with prefix in order until ctx is done
+func (kv *MemoryKV) Watch(ctx context.Context, prefix string) <-chan KVEvent {
+	events := make(chan KVEvent)
+	w := &kvWatcher{prefix: prefix, ready: make(chan struct{}, 1)}
+
+	kv.mu.Lock()
+	kv.watchers[w] = true
+	kv.mu.Unlock()
+
+	go func() {
+		defer close(events)
+		defer func() {
+			kv.mu.Lock()
+			delete(kv.watchers, w)
+			kv.mu.Unlock()
+		}()
+
+		for {
+			kv.mu.Lock()
+			queue := w.queue
+			w.queue = nil
+			kv.mu.Unlock()
+
+			for _, event := range queue {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-w.ready:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// publish queues an event for the watchers of its key, kv.mu must be held
+func (kv *MemoryKV) publish(event KVEvent) {
+	for w := range kv.watchers {
+		if !strings.HasPrefix(event.Key, w.prefix) {
+			continue
+		}
+
+		w.queue = append(w.queue, event)
+
+		select {
+		case w.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// kvSaveAttempts is how many times KVInstanceStore.SaveAll tries to write instances changed concurrently
+const kvSaveAttempts = 3
+
+// KVInstanceStore is an InstanceStore keeping instances as JSON values of a KV under prefix
+// Writes are optimistically locked by the revisions of the keys: an instance is only written if nobody else wrote it
+// since the store loaded, saved or watched it, or if the stored history is the start of the saved one, otherwise
+// saving fails with ConditionFailed, so that transitions of other replicas are not overwritten
+type KVInstanceStore struct {
+	kv     KV
+	prefix string
+
+	mu        sync.Mutex
+	revisions map[string]int64
+}
+
+// NewKVInstanceStore creates a new KVInstanceStore
+func NewKVInstanceStore(kv KV, prefix string) *KVInstanceStore {
+	return &KVInstanceStore{
+		kv:        kv,
+		prefix:    strings.TrimSuffix(prefix, "/") + "/",
+		revisions: map[string]int64{},
+	}
+}
+
+// Load returns an instance
+func (s *KVInstanceStore) Load(id string) (StoredInstance, error) {
+	instance, revision, err := s.load(id)
+	if err != nil {
+		return StoredInstance{}, err
+	}
+
+	s.observed(id, revision)
+
+	return instance, nil
+}
+
+// load reads an instance with the revision of its key
+func (s *KVInstanceStore) load(id string) (StoredInstance, int64, error) {
+	value, revision, err := s.kv.Get(context.Background(), s.prefix+id)
+	if errors.Is(err, KeyNotFound) {
+		return StoredInstance{}, 0, fmt.Errorf("instance: %v, %w", id, InstanceNotFound)
+	}
+	if err != nil {
+		return StoredInstance{}, 0, fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	var instance StoredInstance
+	err = json.Unmarshal(value, &instance)
+	if err != nil {
+		return StoredInstance{}, 0, fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	return instance, revision, nil
+}
+
+// observed records the revision an instance was read or written at
+func (s *KVInstanceStore) observed(id string, revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revisions[id] = revision
+}
+
+// Save adds or replaces an instance
+func (s *KVInstanceStore) Save(instance StoredInstance) error {
+	return s.SaveAll([]StoredInstance{instance})
+}
+
+// SaveAll adds or replaces instances in a single write
+// If an instance was written concurrently, the write is tried again as long as the stored histories are the start of
+// the saved ones, e.g. because only metadata was changed elsewhere
+func (s *KVInstanceStore) SaveAll(instances []StoredInstance) error {
+	puts := make(map[string]KVPut, len(instances))
+
+	s.mu.Lock()
+	for _, instance := range instances {
+		value, err := json.Marshal(instance)
+		if err != nil {
+			s.mu.Unlock()
+
+			return fmt.Errorf("instance: %v, %w", instance.ID, err)
+		}
+
+		puts[s.prefix+instance.ID] = KVPut{Value: value, Revision: s.revisions[instance.ID]}
+	}
+	s.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		revisions, err := s.kv.PutAll(context.Background(), puts)
+		if err == nil {
+			s.mu.Lock()
+			for _, instance := range instances {
+				s.revisions[instance.ID] = revisions[s.prefix+instance.ID]
+			}
+			s.mu.Unlock()
+
+			return nil
+		}
+
+		if !errors.Is(err, ConditionFailed) || attempt == kvSaveAttempts {
+			return err
+		}
+
+		for _, instance := range instances {
+			stored, revision, err := s.load(instance.ID)
+			if errors.Is(err, InstanceNotFound) {
+				revision = 0
+			} else if err != nil {
+				return err
+			} else if !historyPrefix(stored.History, instance.History) {
+				return fmt.Errorf("instance: %v, history was changed concurrently, %w", instance.ID, ConditionFailed)
+			}
+
+			put := puts[s.prefix+instance.ID]
+			put.Revision = revision
+			puts[s.prefix+instance.ID] = put
+		}
+	}
+}
+
+// historyPrefix is true if history starts with the events of prefix
+func historyPrefix(prefix, history []TransitionEvent) bool {
+	if len(prefix) > len(history) {
+		return false
+	}
+
+	for i, event := range prefix {
+		other := history[i]
+		if event.From != other.From || event.To != other.To || event.Event != other.Event ||
+			event.Result != other.Result || !event.At.Equal(other.At) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Delete removes an instance
+func (s *KVInstanceStore) Delete(id string) error {
+	err := s.kv.Delete(context.Background(), s.prefix+id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.revisions, id)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// IDs returns the IDs of the instances in alphabetical order
+func (s *KVInstanceStore) IDs() ([]string, error) {
+	keys, err := s.kv.List(context.Background(), s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = strings.TrimPrefix(key, s.prefix)
+	}
+
+	return ids, nil
+}
+
+// WatchKV keeps the instances of the Manager in sync with the ones other replicas save to store, until ctx is done
+// An instance whose stored history continues its own is moved into the stored state and gets the missing events
+// like a transition done by the Manager, an instance deleted from store is removed
+// Instances the Manager does not have are ignored, they are loaded on demand, errors of catching up, e.g. of
+// projections, are passed to onError if it is not nil
+func (m *Manager) WatchKV(ctx context.Context, store *KVInstanceStore, onError func(err error)) {
+	for event := range store.kv.Watch(ctx, store.prefix) {
+		id := strings.TrimPrefix(event.Key, store.prefix)
+
+		if event.Deleted {
+			_ = m.Remove(id)
+
+			continue
+		}
+
+		var instance StoredInstance
+		err := json.Unmarshal(event.Value, &instance)
+		if err != nil {
+			continue
+		}
+
+		err = m.refresh(store, id, instance, event.Revision)
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// refresh catches an instance up with its stored form if the stored history continues its own, taking the stored
+// metadata unless the instance has unsaved changes
+// Stored forms which are behind or diverged are ignored, a diverged instance fails to be saved with ConditionFailed
+func (m *Manager) refresh(store *KVInstanceStore, id string, stored StoredInstance, revision int64) error {
+	inst, err := m.instance(id)
+	if err != nil {
+		return nil
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	recorded := len(inst.sm.history)
+	if !historyPrefix(inst.sm.history, stored.History) {
+		return nil
+	}
+
+	if !inst.dirty {
+		inst.sm.metadata = stored.Metadata
+	}
+
+	store.observed(id, revision)
+
+	if len(stored.History) == recorded {
+		return nil
+	}
+
+	return m.catchUp(id, inst, stored.History[recorded:], stored.State)
+}
+
+// catchUp appends the events of transitions done elsewhere to an instance and moves it into state like a transition
+// done by the Manager, see with, the lock of the instance must be held
+// The events are stored already, so they do not make the instance dirty
+func (m *Manager) catchUp(id string, inst *instance, events []TransitionEvent, state State) error {
+	dirty := inst.dirty
+	err := m.within(id, inst, func(sm *StateMachine) error {
+		sm.history = append(sm.history, events...)
+		sm.state = state
+
+		return nil
+	})
+	inst.dirty = dirty
+
+	return err
+}
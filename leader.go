@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LeaderElector elects a single leader among the replicas of a Manager sharing a TimerStore, so that only one of
+// them fires the due timers
+type LeaderElector interface {
+	// Campaign blocks until the replica is the leader or ctx is done, the returned channel is closed when the
+	// leadership is lost, e.g. because the session of the replica expired
+	Campaign(ctx context.Context) (<-chan struct{}, error)
+	// Resign gives up the leadership, resigning without being the leader is not an error
+	Resign(ctx context.Context) error
+}
+
+// EtcdElection is an etcd election of a session, adapters wrap concurrency.Election and concurrency.Session of the
+// etcd client, Done is the Done channel of the session
+type EtcdElection interface {
+	Campaign(ctx context.Context, value string) error
+	Resign(ctx context.Context) error
+	Done() <-chan struct{}
+}
+
+// EtcdElector is a LeaderElector campaigning in an etcd election, the leadership is lost when the session expires
+// The session of an election can not be renewed once it expired, so a new one is created before campaigning again
+type EtcdElector struct {
+	mu          sync.Mutex
+	newElection func(ctx context.Context) (EtcdElection, error)
+	election    EtcdElection
+	name        string
+}
+
+// NewEtcdElector creates a new EtcdElector campaigning with the name of the replica
+// newElection must create a new session and an election on it, e.g. with concurrency.NewSession and
+// concurrency.NewElection
+func NewEtcdElector(newElection func(ctx context.Context) (EtcdElection, error), name string) *EtcdElector {
+	return &EtcdElector{
+		newElection: newElection,
+		name:        name,
+	}
+}
+
+// Campaign blocks until the replica is elected, creating a new session first if the previous one expired
+func (e *EtcdElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	election, err := e.session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("replica: %v, creating session: %w", e.name, err)
+	}
+
+	err = election.Campaign(ctx, e.name)
+	if err != nil {
+		return nil, fmt.Errorf("replica: %v, %w", e.name, err)
+	}
+
+	return election.Done(), nil
+}
+
+// session returns the election of the current session, or of a new session if there is none or it expired
+func (e *EtcdElector) session(ctx context.Context) (EtcdElection, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.election != nil {
+		select {
+		case <-e.election.Done():
+		default:
+			return e.election, nil
+		}
+	}
+
+	election, err := e.newElection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e.election = election
+
+	return election, nil
+}
+
+// Resign gives up the leadership
+func (e *EtcdElector) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	election := e.election
+	e.mu.Unlock()
+
+	if election == nil {
+		return nil
+	}
+
+	err := election.Resign(ctx)
+	if err != nil {
+		return fmt.Errorf("replica: %v, %w", e.name, err)
+	}
+
+	return nil
+}
+
+// MemoryElection is an election between the replicas of a single process, e.g. in tests
+type MemoryElection struct {
+	mu       sync.Mutex
+	leader   string
+	lost     chan struct{}
+	released chan struct{}
+}
+
+// NewMemoryElection creates a new MemoryElection
+func NewMemoryElection() *MemoryElection {
+	return &MemoryElection{
+		released: make(chan struct{}),
+	}
+}
+
+// Elector returns the LeaderElector of a replica, the names of the replicas must be unique
+func (e *MemoryElection) Elector(name string) LeaderElector {
+	return memoryElector{election: e, name: name}
+}
+
+// Leader returns the name of the leader, an empty string if there is none
+func (e *MemoryElection) Leader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leader
+}
+
+// memoryElector is a replica campaigning in a MemoryElection
+type memoryElector struct {
+	election *MemoryElection
+	name     string
+}
+
+// Campaign blocks until the previous leader resigned
+func (r memoryElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	e := r.election
+	for {
+		e.mu.Lock()
+		if e.leader == "" {
+			e.leader = r.name
+			e.lost = make(chan struct{})
+			lost := e.lost
+			e.mu.Unlock()
+
+			return lost, nil
+		}
+
+		released := e.released
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// Resign gives up the leadership and wakes up the campaigning replicas
+func (r memoryElector) Resign(_ context.Context) error {
+	e := r.election
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leader != r.name {
+		return nil
+	}
+
+	e.leader = ""
+	close(e.lost)
+	close(e.released)
+	e.released = make(chan struct{})
+
+	return nil
+}
+
+// RunTimersAsLeader calls ProcessTimers every interval while the replica is elected by elector until ctx is done,
+// campaigning again whenever the leadership is lost, then resigns, errors are passed to onError if it is not nil
+func (m *Manager) RunTimersAsLeader(ctx context.Context, elector LeaderElector, interval time.Duration, onError func(err error)) {
+	report := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+
+	for ctx.Err() == nil {
+		lost, err := elector.Campaign(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
+			report(fmt.Errorf("campaigning: %w", err))
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+
+			continue
+		}
+
+		leading, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-lost:
+			case <-leading.Done():
+			}
+
+			cancel()
+		}()
+
+		m.RunTimers(leading, interval, onError)
+		cancel()
+	}
+
+	err := elector.Resign(context.Background())
+	if err != nil {
+		report(fmt.Errorf("resigning: %w", err))
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintIssue is a problem found in a StateMachine definition by a LintRule
+type LintIssue struct {
+	Rule    string
+	State   State
+	Message string
+}
+
+// String returns the issue in a "rule: state: message" form
+func (i LintIssue) String() string {
+	if i.State == "" {
+		return fmt.Sprintf("%s: %s", i.Rule, i.Message)
+	}
+
+	return fmt.Sprintf("%s: %v: %s", i.Rule, i.State, i.Message)
+}
+
+// LintRule checks a StateMachine definition for a single kind of problem
+type LintRule struct {
+	Name  string
+	Check func(sm *StateMachine) []LintIssue
+}
+
+// Linter checks StateMachine definitions against a set of individually enabled rules
+type Linter struct {
+	rules    []LintRule
+	disabled map[string]bool
+}
+
+// NewLinter creates a new Linter with the given rules, all of them enabled
+func NewLinter(rules ...LintRule) *Linter {
+	return &Linter{
+		rules:    rules,
+		disabled: map[string]bool{},
+	}
+}
+
+// DefaultLintRules returns every built-in rule with sensible settings
+func DefaultLintRules() []LintRule {
+	return []LintRule{
+		NoStateWithoutDescription(),
+		NoUnconditionalCycle(),
+		MaxOutDegree(7),
+		TerminalStatesTagged("terminal"),
+	}
+}
+
+// Enable turns on the rules with the given names
+func (l *Linter) Enable(names ...string) {
+	for _, name := range names {
+		delete(l.disabled, name)
+	}
+}
+
+// Disable turns off the rules with the given names
+func (l *Linter) Disable(names ...string) {
+	for _, name := range names {
+		l.disabled[name] = true
+	}
+}
+
+// Lint checks the StateMachine against every enabled rule, an empty result means the definition is clean
+func (l *Linter) Lint(sm *StateMachine) []LintIssue {
+	var issues []LintIssue
+	for _, rule := range l.rules {
+		if l.disabled[rule.Name] {
+			continue
+		}
+
+		issues = append(issues, rule.Check(sm)...)
+	}
+
+	return issues
+}
+
+// NoStateWithoutDescription reports states which have no description
+func NoStateWithoutDescription() LintRule {
+	name := "no-state-without-description"
+
+	return LintRule{
+		Name: name,
+		Check: func(sm *StateMachine) []LintIssue {
+			var issues []LintIssue
+			for _, state := range sm.States() {
+				if sm.Description(state) == "" {
+					issues = append(issues, LintIssue{Rule: name, State: state, Message: "state has no description"})
+				}
+			}
+
+			return issues
+		},
+	}
+}
+
+// NoUnconditionalCycle reports cycles consisting only of edges without guards,
+// as they can be traversed forever without any condition being met
+func NoUnconditionalCycle() LintRule {
+	name := "no-unconditional-cycle"
+
+	return LintRule{
+		Name: name,
+		Check: func(sm *StateMachine) []LintIssue {
+			var issues []LintIssue
+			for _, cycle := range cycles(sm.States(), sm.unconditionalTargets) {
+				names := make([]string, 0, len(cycle))
+				for _, state := range cycle {
+					names = append(names, string(state))
+				}
+
+				issues = append(issues, LintIssue{
+					Rule:    name,
+					State:   cycle[0],
+					Message: "unconditional cycle through " + strings.Join(names, ", "),
+				})
+			}
+
+			return issues
+		},
+	}
+}
+
+// MaxOutDegree reports states with more than max outgoing edges
+func MaxOutDegree(max int) LintRule {
+	name := "max-out-degree"
+
+	return LintRule{
+		Name: name,
+		Check: func(sm *StateMachine) []LintIssue {
+			var issues []LintIssue
+			for _, state := range sm.States() {
+				degree := len(sm.Targets(state))
+				if degree > max {
+					issues = append(issues, LintIssue{
+						Rule:    name,
+						State:   state,
+						Message: fmt.Sprintf("%d outgoing edges, at most %d allowed", degree, max),
+					})
+				}
+			}
+
+			return issues
+		},
+	}
+}
+
+// TerminalStatesTagged reports states without outgoing edges which are not tagged with tag
+func TerminalStatesTagged(tag string) LintRule {
+	name := "terminal-states-tagged"
+
+	return LintRule{
+		Name: name,
+		Check: func(sm *StateMachine) []LintIssue {
+			var issues []LintIssue
+			for _, state := range sm.States() {
+				if len(sm.Targets(state)) == 0 && !sm.HasTag(state, tag) {
+					issues = append(issues, LintIssue{
+						Rule:    name,
+						State:   state,
+						Message: fmt.Sprintf("terminal state is not tagged %q", tag),
+					})
+				}
+			}
+
+			return issues
+		},
+	}
+}
+
+// unconditionalTargets returns the states reachable from a state through edges without guards
+func (sm *StateMachine) unconditionalTargets(from State) []State {
+	var targets []State
+	for _, to := range sm.Targets(from) {
+		if !guarded(sm.edgeRules(from, to)) {
+			targets = append(targets, to)
+		}
+	}
+
+	return targets
+}
+
+// cycles returns the strongly connected components of a graph which contain a cycle,
+// using Tarjan's algorithm, states within a cycle are in alphabetical order
+func cycles(states []State, next func(State) []State) [][]State {
+	index := map[State]int{}
+	low := map[State]int{}
+	onStack := map[State]bool{}
+	var stack []State
+	var result [][]State
+
+	var connect func(state State)
+	connect = func(state State) {
+		index[state] = len(index)
+		low[state] = index[state]
+		stack = append(stack, state)
+		onStack[state] = true
+
+		for _, to := range next(state) {
+			_, visited := index[to]
+			if !visited {
+				connect(to)
+				low[state] = minInt(low[state], low[to])
+			} else if onStack[to] {
+				low[state] = minInt(low[state], index[to])
+			}
+		}
+
+		if low[state] != index[state] {
+			return
+		}
+
+		var component []State
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+
+			if top == state {
+				break
+			}
+		}
+
+		if len(component) > 1 {
+			sortStates(component)
+			result = append(result, component)
+		}
+	}
+
+	for _, state := range states {
+		_, visited := index[state]
+		if !visited {
+			connect(state)
+		}
+	}
+
+	return result
+}
+
+// minInt returns the smaller of two integers
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
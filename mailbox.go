@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	MailboxClosed = fmt.Errorf("error: mailbox closed")
+	MailboxFull   = fmt.Errorf("error: mailbox full")
+	EventDropped  = fmt.Errorf("error: event dropped")
+)
+
+// Priority decides the order in which a Mailbox processes queued events
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// OverflowPolicy decides what happens to an event posted to a full Mailbox
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Post wait until there is room in the Mailbox
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the event queued the earliest to make room, it receives EventDropped
+	OverflowDropOldest
+	// OverflowDropNewest drops the posted event, it receives EventDropped
+	OverflowDropNewest
+	// OverflowError rejects the posted event with MailboxFull
+	OverflowError
+)
+
+// priorities lists the priorities from the highest to the lowest
+var priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// message is an event queued in a Mailbox
+// A coalesced message stands for several posted events, each of them waiting for the result on its own channel
+type message struct {
+	event    Event
+	params   []interface{}
+	results  []chan error
+	ready    time.Time
+	seq      uint64
+	priority Priority
+	errs     []error
+}
+
+// Mailbox owns a StateMachine and fires the events posted to it one by one on a single goroutine, like an actor
+// Events of higher priority are processed first, see SetStarvationLimit for how low-priority events are protected
+type Mailbox struct {
+	mu         sync.Mutex
+	queues     map[Priority][]message
+	skipped    map[Priority]int
+	priorities map[Event]Priority
+	coalesce   map[Event]time.Duration
+	starvation int
+	clock      Clock
+	capacity   int
+	overflow   OverflowPolicy
+	seq        uint64
+	room       *sync.Cond
+	store      QueueStore
+	attempts   int
+	deadLetter DeadLetterSink
+	backoff    time.Duration
+	jitter     *rand.Rand
+	wake       chan struct{}
+	closed     bool
+
+	smMu sync.Mutex
+	sm   *StateMachine
+}
+
+// NewMailbox creates a new Mailbox owning sm, the StateMachine must not be used directly afterwards
+func NewMailbox(sm *StateMachine) *Mailbox {
+	mb := &Mailbox{
+		sm:         sm,
+		queues:     map[Priority][]message{},
+		skipped:    map[Priority]int{},
+		priorities: map[Event]Priority{},
+		coalesce:   map[Event]time.Duration{},
+		starvation: 16,
+		clock:      systemClock{},
+		wake:       make(chan struct{}, 1),
+	}
+	mb.room = sync.NewCond(&mb.mu)
+
+	return mb
+}
+
+// SetCapacity bounds the number of queued events, posting to a full Mailbox is handled according to overflow
+// Coalesced events only take up room once, a capacity of 0 means the Mailbox is unbounded, which is the default
+func (mb *Mailbox) SetCapacity(capacity int, overflow OverflowPolicy) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.capacity = capacity
+	mb.overflow = overflow
+	mb.room.Broadcast()
+}
+
+// SetStarvationLimit sets how many events of higher priority may be processed while an event is waiting,
+// before the waiting event is processed regardless of its priority, 0 disables the protection
+func (mb *Mailbox) SetStarvationLimit(limit int) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.starvation = limit
+}
+
+// SetPriority sets the priority of an event, events have PriorityNormal by default
+func (mb *Mailbox) SetPriority(event Event, priority Priority) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.priorities[event] = priority
+}
+
+// SetCoalesce makes the Mailbox coalesce an event: posting it while it is already queued does not queue it again,
+// the queued event is fired once, with the params of the latest post, and every post receives its result
+// If debounce is positive, the event is only fired once it was not posted for debounce, e.g. to collapse a burst of
+// progress updates into a single transition
+func (mb *Mailbox) SetCoalesce(event Event, debounce time.Duration) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.coalesce[event] = debounce
+}
+
+// SetClock sets the Clock used by the Mailbox for debouncing
+func (mb *Mailbox) SetClock(clock Clock) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.clock = clock
+}
+
+// Post queues an event, the returned channel receives the error of firing it once it was processed
+// Posting to a full Mailbox with OverflowBlock blocks until there is room in the Mailbox
+func (mb *Mailbox) Post(event Event, params ...interface{}) <-chan error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	priority, ok := mb.priorities[event]
+	if !ok {
+		priority = PriorityNormal
+	}
+
+	return mb.post(priority, event, params)
+}
+
+// post queues an event with the given priority, mb.mu must be held
+func (mb *Mailbox) post(priority Priority, event Event, params []interface{}) <-chan error {
+	result := make(chan error, 1)
+
+	if mb.coalesced(priority, event, params, result) {
+		return result
+	}
+
+	for !mb.closed && mb.full() {
+		switch mb.overflow {
+		case OverflowBlock:
+			mb.room.Wait()
+		case OverflowDropOldest:
+			mb.dropOldest()
+		case OverflowDropNewest:
+			result <- fmt.Errorf("event: %v, %w", event, EventDropped)
+
+			return result
+		default:
+			result <- fmt.Errorf("event: %v, %w", event, MailboxFull)
+
+			return result
+		}
+	}
+
+	if mb.closed {
+		result <- fmt.Errorf("event: %v, %w", event, MailboxClosed)
+
+		return result
+	}
+
+	mb.enqueue(priority, event, params, result)
+
+	select {
+	case mb.wake <- struct{}{}:
+	default:
+	}
+
+	return result
+}
+
+// coalesced is true if the event was coalesced with the same event already queued, mb.mu must be held
+func (mb *Mailbox) coalesced(priority Priority, event Event, params []interface{}, result chan error) bool {
+	debounce, ok := mb.coalesce[event]
+	if !ok || mb.closed {
+		return false
+	}
+
+	queue := mb.queues[priority]
+	for i := range queue {
+		if queue[i].event != event {
+			continue
+		}
+
+		msg := queue[i]
+		msg.params = params
+		msg.ready = mb.clock.Now().Add(debounce)
+
+		err := mb.persist(msg)
+		if err != nil {
+			result <- fmt.Errorf("event: %v, %w", event, err)
+
+			return true
+		}
+
+		msg.results = append(msg.results, result)
+		queue[i] = msg
+
+		return true
+	}
+
+	return false
+}
+
+// enqueue adds an event to a queue, mb.mu must be held
+func (mb *Mailbox) enqueue(priority Priority, event Event, params []interface{}, result chan error) {
+	mb.seq++
+
+	msg := message{event: event, params: params, results: []chan error{result}, seq: mb.seq, priority: priority}
+
+	debounce := mb.coalesce[event]
+	if debounce > 0 {
+		msg.ready = mb.clock.Now().Add(debounce)
+	}
+
+	err := mb.persist(msg)
+	if err != nil {
+		result <- fmt.Errorf("event: %v, %w", event, err)
+
+		return
+	}
+
+	mb.queues[priority] = append(mb.queues[priority], msg)
+}
+
+// full is true if the Mailbox is bounded and has no room for another event, mb.mu must be held
+func (mb *Mailbox) full() bool {
+	return mb.capacity > 0 && mb.len() >= mb.capacity
+}
+
+// dropOldest drops the event queued the earliest, mb.mu must be held
+func (mb *Mailbox) dropOldest() {
+	oldest := PriorityNormal
+	found := false
+	for _, priority := range priorities {
+		queue := mb.queues[priority]
+		if len(queue) > 0 && (!found || queue[0].seq < mb.queues[oldest][0].seq) {
+			oldest = priority
+			found = true
+		}
+	}
+
+	if !found {
+		return
+	}
+
+	msg := mb.queues[oldest][0]
+	mb.queues[oldest] = mb.queues[oldest][1:]
+
+	err := mb.forget(msg)
+	for _, result := range msg.results {
+		result <- errors.Join(fmt.Errorf("event: %v, %w", msg.event, EventDropped), err)
+	}
+}
+
+// Len returns the number of queued events
+func (mb *Mailbox) Len() int {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	return mb.len()
+}
+
+// len returns the number of queued events, mb.mu must be held
+func (mb *Mailbox) len() int {
+	n := 0
+	for _, queue := range mb.queues {
+		n += len(queue)
+	}
+
+	return n
+}
+
+// State returns the current state of the StateMachine owned by the Mailbox
+func (mb *Mailbox) State() State {
+	mb.smMu.Lock()
+	defer mb.smMu.Unlock()
+
+	return mb.sm.State()
+}
+
+// Run processes the queued events until ctx is done, then closes the Mailbox
+// Events still queued when ctx is done receive MailboxClosed, but they are kept in the QueueStore if there is one,
+// so are events whose transition was cut short by ctx
+func (mb *Mailbox) Run(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			mb.close()
+
+			return
+		}
+
+		msg, wait, ok := mb.next()
+		if !ok {
+			var timer <-chan time.Time
+			if wait > 0 {
+				timer = time.After(wait)
+			}
+
+			select {
+			case <-ctx.Done():
+				mb.close()
+
+				return
+			case <-mb.wake:
+			case <-timer:
+			}
+
+			continue
+		}
+
+		mb.smMu.Lock()
+		err := mb.sm.FireContext(ctx, msg.event, msg.params...)
+		state := mb.sm.State()
+		mb.smMu.Unlock()
+
+		if err != nil && ctx.Err() != nil && !errors.Is(err, ActionFailed) {
+			for _, result := range msg.results {
+				result <- errors.Join(fmt.Errorf("event: %v, %w", msg.event, MailboxClosed), err)
+			}
+
+			continue
+		}
+
+		mb.mu.Lock()
+		if err != nil {
+			var retried bool
+			retried, err = mb.failed(msg, state, err)
+			if retried {
+				mb.mu.Unlock()
+
+				continue
+			}
+		}
+		err = errors.Join(err, mb.forget(msg))
+		mb.mu.Unlock()
+
+		for _, result := range msg.results {
+			result <- err
+		}
+	}
+}
+
+// next dequeues the event to be processed next
+// If no event is ready, it returns how long to wait for the earliest debounced event, 0 if there is none
+func (mb *Mailbox) next() (message, time.Duration, bool) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	now := mb.clock.Now()
+
+	ready := map[Priority]int{}
+	var earliest time.Time
+	for _, priority := range priorities {
+		for i, msg := range mb.queues[priority] {
+			if !msg.ready.After(now) {
+				ready[priority] = i
+
+				break
+			}
+
+			if earliest.IsZero() || msg.ready.Before(earliest) {
+				earliest = msg.ready
+			}
+		}
+	}
+
+	chosen, ok := mb.choose(ready)
+	if !ok {
+		if earliest.IsZero() {
+			return message{}, 0, false
+		}
+
+		return message{}, earliest.Sub(now), false
+	}
+
+	for priority := range ready {
+		if priority != chosen {
+			mb.skipped[priority]++
+		}
+	}
+	mb.skipped[chosen] = 0
+
+	i := ready[chosen]
+	queue := mb.queues[chosen]
+	msg := queue[i]
+	if i == 0 {
+		mb.queues[chosen] = queue[1:]
+	} else {
+		mb.queues[chosen] = append(queue[:i], queue[i+1:]...)
+	}
+	mb.room.Signal()
+
+	return msg, 0, true
+}
+
+// choose returns the priority of the queue to dequeue from, given the index of the first ready event of each queue,
+// mb.mu must be held
+// Starving queues come first, the lowest priority first, then the highest priority queue with a ready event
+func (mb *Mailbox) choose(ready map[Priority]int) (Priority, bool) {
+	for i := len(priorities) - 1; i >= 0; i-- {
+		priority := priorities[i]
+		_, ok := ready[priority]
+		if ok && mb.starvation > 0 && mb.skipped[priority] >= mb.starvation {
+			return priority, true
+		}
+	}
+
+	for _, priority := range priorities {
+		_, ok := ready[priority]
+		if ok {
+			return priority, true
+		}
+	}
+
+	return 0, false
+}
+
+// close rejects every queued event and every event posted later
+func (mb *Mailbox) close() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.closed = true
+	for priority, queue := range mb.queues {
+		for _, msg := range queue {
+			for _, result := range msg.results {
+				result <- fmt.Errorf("event: %v, %w", msg.event, MailboxClosed)
+			}
+		}
+
+		delete(mb.queues, priority)
+	}
+
+	mb.room.Broadcast()
+}
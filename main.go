@@ -1,21 +1,44 @@
 // This package provides a simple StateMachine implementation
-// with two Rule types, both implementing the TransitionRule interface:
+// with three Rule types, all implementing the TransitionRule interface:
 // - SimpleTransitionRule: always allows the transition between two states as long as they exist
 // - ConditionalTransitionRule: allows the transition between two states only if some conditions are met
+// - PassThroughTransitionRule: wraps another rule and defers to later rules if the wrapped rule denies the transition
+//
+// The test helpers are only built with their tags, so that they are not linked into production binaries:
+// - smtest: property-based testing helpers, AssertUnreachable, ReachPath and AssertGolden, e.g. `go test -tags smtest`
+// - smmock: the MockRule and MockClock fakes, e.g. `go test -tags smmock`
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
 	TransitionNotAllowed = fmt.Errorf("error: transition not allowed")
 	StateNotFound        = fmt.Errorf("error: state not found")
+	StateInUse           = fmt.Errorf("error: state in use")
+	RuleNotFound         = fmt.Errorf("error: rule not found")
+	EventNotHandled      = fmt.Errorf("error: event not handled")
+	ActionFailed         = fmt.Errorf("error: action failed")
+	ErrDeadlineExceeded  = fmt.Errorf("error: transition deadline exceeded")
 )
 
 // State describes a possible state in a StateMachine
 type State string
 
+// Event is a named trigger which transitions a StateMachine into a state depending on its current state
+type Event string
+
+// Action is called after the StateMachine transitioned between two states
+type Action func(ctx context.Context, event TransitionEvent) error
+
 // TransitionRule allows or denies transitioning between two states
 type TransitionRule interface {
 	From() State
@@ -83,12 +106,127 @@ func (r *ConditionalTransitionRule) Valid(from, to State, params ...interface{})
 	return from == r.from && to == r.to && r.condition(params...)
 }
 
+// PassThroughTransitionRule wraps a TransitionRule so that if the wrapped rule denies a transition,
+// the subsequent rules matching the same states are evaluated instead of rejecting the transition
+// It only makes a difference with the FirstMatch strategy
+type PassThroughTransitionRule struct {
+	TransitionRule
+}
+
+// NewPassThroughTransitionRule creates a new PassThroughTransitionRule
+func NewPassThroughTransitionRule(rule TransitionRule) *PassThroughTransitionRule {
+	return &PassThroughTransitionRule{
+		TransitionRule: rule,
+	}
+}
+
+// unwrap returns the rule wrapped by a PassThroughTransitionRule, the rule itself otherwise, e.g. to check which
+// interfaces the guard implements
+func unwrap(rule TransitionRule) TransitionRule {
+	if passThrough, ok := rule.(*PassThroughTransitionRule); ok {
+		return passThrough.TransitionRule
+	}
+
+	return rule
+}
+
+// MatchStrategy decides how multiple rules matching the same pair of states are combined
+type MatchStrategy int
+
+const (
+	// FirstMatch lets the first matching rule decide whether the transition is allowed
+	FirstMatch MatchStrategy = iota
+	// AnyPasses allows the transition if at least one of the matching rules is valid
+	AnyPasses
+	// AllMustPass allows the transition only if all of the matching rules are valid
+	AllMustPass
+)
+
+// Clock provides the current time to a StateMachine
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is a Clock using the system time
+type systemClock struct{}
+
+// Now returns the current system time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// TransitionResult describes the outcome of a transition attempt
+type TransitionResult string
+
+const (
+	// Allowed means that the StateMachine transitioned into the requested state
+	Allowed TransitionResult = "allowed"
+	// Rejected means that the rules did not allow the transition
+	Rejected TransitionResult = "rejected"
+)
+
+// TransitionEvent describes a transition attempt in a StateMachine, Event is the fired event, empty for transitions
+// made directly, Requested is the state the transition was requested into if an entry limit redirected it to To
+type TransitionEvent struct {
+	From      State            `json:"from"`
+	To        State            `json:"to"`
+	Event     Event            `json:"event,omitempty"`
+	Requested State            `json:"requested,omitempty"`
+	Params    []interface{}    `json:"params,omitempty"`
+	At        time.Time        `json:"at"`
+	Result    TransitionResult `json:"result"`
+}
+
+// edge identifies a transition between two states
+type edge struct {
+	from State
+	to   State
+}
+
+// trigger identifies an event fired in a state
+type trigger struct {
+	event Event
+	from  State
+}
+
 // StateMachine defines as StateMachine with current and existing states and rules to transition between states
 type StateMachine struct {
-	state  State
-	states map[State]State
-	rules  []TransitionRule
-	final  bool
+	state          State
+	states         map[State]State
+	descriptions   map[State]string
+	tags           map[State][]string
+	rules          atomic.Pointer[ruleSet]
+	rulesMu        sync.Mutex
+	ruleNames      map[string]TransitionRule
+	events         map[trigger]State
+	choices        map[trigger][]Choice
+	fallbacks      map[trigger]State
+	actions        map[edge][]Action
+	entries        map[State][]Action
+	metadata       Metadata
+	limits         map[State]entryLimit
+	concurrency    ConcurrencyMode
+	throttles      map[edge]time.Duration
+	calendars      map[edge]Calendar
+	busy           atomic.Bool
+	hooks          wildcardHooks
+	strategy       MatchStrategy
+	edgeStrategies map[edge]MatchStrategy
+	history        []TransitionEvent
+	recordRejected bool
+	clock          Clock
+	created        time.Time
+	coverage       *Coverage
+	container      *Container
+	shadow         *shadow
+	journal        Journal
+	journalSeq     uint64
+	representation Representation
+	adaptive       *adaptiveOrder
+	debug          func(trace DebugTrace)
+	tracing        *DebugTrace
+	firing         Event
+	final          bool
 }
 
 // NewStateMachine creates a new StateMachine instance
@@ -100,11 +238,121 @@ func NewStateMachine(initialState State, states ...State) *StateMachine {
 		stateMap[state] = state
 	}
 
-	return &StateMachine{
-		state:  initialState,
-		states: stateMap,
-		rules:  []TransitionRule{},
+	sm := &StateMachine{
+		state:          initialState,
+		states:         stateMap,
+		descriptions:   map[State]string{},
+		tags:           map[State][]string{},
+		ruleNames:      map[string]TransitionRule{},
+		events:         map[trigger]State{},
+		actions:        map[edge][]Action{},
+		entries:        map[State][]Action{},
+		strategy:       FirstMatch,
+		edgeStrategies: map[edge]MatchStrategy{},
+		clock:          systemClock{},
 	}
+	sm.created = sm.clock.Now()
+	sm.rules.Store(newRuleSet(nil))
+
+	return sm
+}
+
+// AddStates adds states to the StateMachine, e.g. ones contributed by another module, adding an existing state does
+// nothing
+func (sm *StateMachine) AddStates(states ...State) error {
+	if sm.final {
+		return fmt.Errorf("states must be defined before finalization")
+	}
+
+	for _, state := range states {
+		sm.states[state] = state
+	}
+
+	return nil
+}
+
+// RemoveState removes a state from the StateMachine
+// It fails with StateInUse if the StateMachine is in the state or any rule, event, action or match strategy
+// references it
+func (sm *StateMachine) RemoveState(state State) error {
+	if sm.final {
+		return fmt.Errorf("states must be defined before finalization")
+	}
+
+	_, ok := sm.states[state]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", state, StateNotFound)
+	}
+
+	if sm.state == state {
+		return fmt.Errorf("state: %v, current state, %w", state, StateInUse)
+	}
+
+	for _, rule := range sm.Rules() {
+		if rule.From() == state || rule.To() == state {
+			return fmt.Errorf("state: %v, rule %v -> %v, %w", state, rule.From(), rule.To(), StateInUse)
+		}
+	}
+
+	for t, to := range sm.events {
+		if t.from == state || to == state {
+			return fmt.Errorf("state: %v, event %v, %w", state, t.event, StateInUse)
+		}
+	}
+
+	for t, choices := range sm.choices {
+		for _, choice := range choices {
+			if choice.To == state {
+				return fmt.Errorf("state: %v, choice of event %v, %w", state, t.event, StateInUse)
+			}
+		}
+	}
+
+	for t, to := range sm.fallbacks {
+		if to == state {
+			return fmt.Errorf("state: %v, fallback of event %v, %w", state, t.event, StateInUse)
+		}
+	}
+
+	for e, actions := range sm.actions {
+		if len(actions) > 0 && (e.from == state || e.to == state) {
+			return fmt.Errorf("state: %v, action %v -> %v, %w", state, e.from, e.to, StateInUse)
+		}
+	}
+
+	if len(sm.entries[state]) > 0 {
+		return fmt.Errorf("state: %v, entry actions, %w", state, StateInUse)
+	}
+
+	for limited, limit := range sm.limits {
+		if limited == state || limit.overflow == state {
+			return fmt.Errorf("state: %v, entry limit of %v, %w", state, limited, StateInUse)
+		}
+	}
+
+	for e := range sm.throttles {
+		if e.from == state || e.to == state {
+			return fmt.Errorf("state: %v, throttling %v -> %v, %w", state, e.from, e.to, StateInUse)
+		}
+	}
+
+	for e := range sm.calendars {
+		if e.from == state || e.to == state {
+			return fmt.Errorf("state: %v, calendar %v -> %v, %w", state, e.from, e.to, StateInUse)
+		}
+	}
+
+	for e := range sm.edgeStrategies {
+		if e.from == state || e.to == state {
+			return fmt.Errorf("state: %v, match strategy %v -> %v, %w", state, e.from, e.to, StateInUse)
+		}
+	}
+
+	delete(sm.states, state)
+	delete(sm.descriptions, state)
+	delete(sm.tags, state)
+
+	return nil
 }
 
 func (sm *StateMachine) AddRule(rule TransitionRule) error {
@@ -112,21 +360,196 @@ func (sm *StateMachine) AddRule(rule TransitionRule) error {
 		return fmt.Errorf("rules must be defined before finalization")
 	}
 
-	_, ok := sm.states[rule.From()]
+	err := sm.validRule(rule)
+	if err != nil {
+		return err
+	}
+
+	injectable, ok := unwrap(rule).(Injectable)
+	if ok {
+		err = sm.container.inject(injectable)
+		if err != nil {
+			return err
+		}
+	}
+
+	sm.rulesMu.Lock()
+	defer sm.rulesMu.Unlock()
+
+	sm.storeRules(append(sm.Rules(), rule))
+
+	return nil
+}
+
+// AddRules adds several rules at once, either every rule is added or none of them
+// Every invalid rule is reported, the errors are joined by errors.Join
+func (sm *StateMachine) AddRules(rules ...TransitionRule) error {
+	if sm.final {
+		return fmt.Errorf("rules must be defined before finalization")
+	}
+
+	var errs []error
+	for i, rule := range rules {
+		err := sm.validRule(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %v -> %v, %w", i, rule.From(), rule.To(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i, rule := range rules {
+		injectable, ok := unwrap(rule).(Injectable)
+		if !ok {
+			continue
+		}
+
+		err := sm.container.inject(injectable)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %v -> %v, %w", i, rule.From(), rule.To(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	sm.rulesMu.Lock()
+	defer sm.rulesMu.Unlock()
+
+	sm.storeRules(append(sm.Rules(), rules...))
+
+	return nil
+}
+
+// AddEvent defines that firing event in the from state transitions the StateMachine into the to state
+// The transition itself still has to be allowed by the rules
+func (sm *StateMachine) AddEvent(event Event, from, to State) error {
+	if sm.final {
+		return fmt.Errorf("events must be defined before finalization")
+	}
+
+	_, ok := sm.states[from]
 	if !ok {
-		return fmt.Errorf("state: %v, %w", rule.From(), StateNotFound)
+		return fmt.Errorf("state: %v, %w", from, StateNotFound)
 	}
 
-	_, ok = sm.states[rule.To()]
+	_, ok = sm.states[to]
 	if !ok {
-		return fmt.Errorf("state: %v, %w", rule.To(), StateNotFound)
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
 	}
 
-	sm.rules = append(sm.rules, rule)
+	_, ok = sm.events[trigger{event: event, from: from}]
+	if ok {
+		return fmt.Errorf("event %v is already defined for state %v", event, from)
+	}
+
+	sm.events[trigger{event: event, from: from}] = to
 
 	return nil
 }
 
+// AddAction adds an action which is called after every transition between two states
+// Actions are called in the order they were added, the first failing action stops the rest,
+// but the transition itself is not undone
+func (sm *StateMachine) AddAction(from, to State, action Action) error {
+	if sm.final {
+		return fmt.Errorf("actions must be defined before finalization")
+	}
+
+	_, ok := sm.states[from]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", from, StateNotFound)
+	}
+
+	_, ok = sm.states[to]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	e := edge{from: from, to: to}
+	sm.actions[e] = append(sm.actions[e], action)
+
+	return nil
+}
+
+// Handles is true if the event is defined for the current state
+func (sm *StateMachine) Handles(event Event) bool {
+	_, ok := sm.events[trigger{event: event, from: sm.state}]
+
+	return ok
+}
+
+// Fire transitions the StateMachine into the state the event leads to from the current state
+func (sm *StateMachine) Fire(event Event, params ...interface{}) error {
+	return sm.FireContext(context.Background(), event, params...)
+}
+
+// FireContext is like Fire, but gives up as soon as ctx is done
+func (sm *StateMachine) FireContext(ctx context.Context, event Event, params ...interface{}) error {
+	_, err := sm.fire(ctx, event, params...)
+
+	return err
+}
+
+// SetMatchStrategy sets the MatchStrategy used for every transition without an edge specific strategy
+func (sm *StateMachine) SetMatchStrategy(strategy MatchStrategy) error {
+	if sm.final {
+		return fmt.Errorf("match strategy must be defined before finalization")
+	}
+
+	sm.strategy = strategy
+
+	return nil
+}
+
+// SetEdgeMatchStrategy sets the MatchStrategy used for transitions between two states
+func (sm *StateMachine) SetEdgeMatchStrategy(from, to State, strategy MatchStrategy) error {
+	if sm.final {
+		return fmt.Errorf("match strategy must be defined before finalization")
+	}
+
+	_, ok := sm.states[from]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", from, StateNotFound)
+	}
+
+	_, ok = sm.states[to]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	sm.edgeStrategies[edge{from: from, to: to}] = strategy
+
+	return nil
+}
+
+// matchStrategy retrieves the MatchStrategy which applies to transitions between two states
+func (sm *StateMachine) matchStrategy(from, to State) MatchStrategy {
+	strategy, ok := sm.edgeStrategies[edge{from: from, to: to}]
+	if ok {
+		return strategy
+	}
+
+	return sm.strategy
+}
+
+// SetClock sets the Clock used for timestamping transitions, a StateMachine which never transitioned entered its
+// state at the current time of the clock, see Entered
+func (sm *StateMachine) SetClock(clock Clock) {
+	sm.clock = clock
+	if len(sm.history) == 0 {
+		sm.created = clock.Now()
+	}
+}
+
+// SetRecordRejected sets whether transition attempts denied by the rules are recorded in the history
+func (sm *StateMachine) SetRecordRejected(recordRejected bool) {
+	sm.recordRejected = recordRejected
+}
+
 // IsFinal is true if the StateMachine is ready to handle transitions
 func (sm *StateMachine) IsFinal() bool {
 	return sm.final
@@ -137,33 +560,337 @@ func (sm *StateMachine) State() State {
 	return sm.state
 }
 
+// History returns the transitions which took place in the StateMachine in chronological order
+// Rejected transition attempts are only included if they are recorded, see SetRecordRejected
+// The Params of a transition are recorded as they were passed, so they must not be modified afterwards
+func (sm *StateMachine) History() []TransitionEvent {
+	history := make([]TransitionEvent, len(sm.history))
+	copy(history, sm.history)
+
+	return history
+}
+
+// AppendHistory appends the history to dst and returns the extended slice, like History, but reusing the buffer
+// of dst, e.g. dst[:0] of the previous call, so polling the history does not allocate once the buffer is big enough
+func (sm *StateMachine) AppendHistory(dst []TransitionEvent) []TransitionEvent {
+	return append(dst, sm.history...)
+}
+
+// DescribeState sets a human-readable description of a state
+func (sm *StateMachine) DescribeState(state State, description string) error {
+	_, ok := sm.states[state]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", state, StateNotFound)
+	}
+
+	sm.descriptions[state] = description
+
+	return nil
+}
+
+// Description returns the description of a state, it is empty if the state was not described
+func (sm *StateMachine) Description(state State) string {
+	return sm.descriptions[state]
+}
+
+// TagState adds tags to a state, e.g. "terminal"
+func (sm *StateMachine) TagState(state State, tags ...string) error {
+	_, ok := sm.states[state]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", state, StateNotFound)
+	}
+
+	for _, tag := range tags {
+		if !sm.HasTag(state, tag) {
+			sm.tags[state] = append(sm.tags[state], tag)
+		}
+	}
+
+	return nil
+}
+
+// Tags returns the tags of a state in the order they were added
+func (sm *StateMachine) Tags(state State) []string {
+	return append([]string(nil), sm.tags[state]...)
+}
+
+// HasTag is true if the state is tagged with tag
+func (sm *StateMachine) HasTag(state State, tag string) bool {
+	for _, t := range sm.tags[state] {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// States returns all existing states of the StateMachine in alphabetical order
+func (sm *StateMachine) States() []State {
+	states := make([]State, 0, len(sm.states))
+	for state := range sm.states {
+		states = append(states, state)
+	}
+
+	sortStates(states)
+
+	return states
+}
+
+// sortStates sorts states in alphabetical order
+func sortStates(states []State) {
+	sort.Slice(states, func(i, j int) bool {
+		return states[i] < states[j]
+	})
+}
+
+// Rules returns the transition rules of the StateMachine in the order they were added
+func (sm *StateMachine) Rules() []TransitionRule {
+	return append([]TransitionRule(nil), sm.loadRules().rules...)
+}
+
+// Targets returns the states which have at least one rule for transitioning from the given state
+func (sm *StateMachine) Targets(from State) []State {
+	var targets []State
+	for _, to := range sm.States() {
+		if to != from && len(sm.edgeRules(from, to)) > 0 {
+			targets = append(targets, to)
+		}
+	}
+
+	return targets
+}
+
+// edgeRules returns the rules applying to transitions between two states, they must not be modified
+func (sm *StateMachine) edgeRules(from, to State) []TransitionRule {
+	return sm.loadRules().byEdge[edge{from: from, to: to}]
+}
+
 // Transition attempts to transition the StateMachine into a new State
 // The transition is only allowed if there's a rule which allows it
 func (sm *StateMachine) Transition(to State, params ...interface{}) error {
+	return sm.TransitionContext(context.Background(), to, params...)
+}
+
+// TransitionDeadline is like Transition, but fails with ErrDeadlineExceeded
+// if the transition cannot be completed before the deadline
+func (sm *StateMachine) TransitionDeadline(deadline time.Time, to State, params ...interface{}) error {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	return sm.TransitionContext(ctx, to, params...)
+}
+
+// TransitionContext is like Transition, but gives up once ctx is done, ctx is checked before each rule is evaluated
+// and before the transition is applied
+// The state is left untouched if ctx is done before the transition is applied, ErrDeadlineExceeded is returned if
+// its deadline passed, the hooks and actions run once it is applied
+func (sm *StateMachine) TransitionContext(ctx context.Context, to State, params ...interface{}) error {
+	if sm.debug != nil && sm.tracing == nil {
+		return sm.transitionTraced(ctx, to, params...)
+	}
+
+	claimed, err := sm.claim(ctx)
+	if err != nil {
+		return err
+	}
+	if claimed {
+		defer sm.busy.Store(false)
+	}
+
 	sm.final = true
 
 	if sm.state == to {
 		return nil
 	}
 
+	event, err := sm.prepare(ctx, to, params...)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return contextErr(ctx)
+	}
+
+	return sm.commit(ctx, event)
+}
+
+// prepare evaluates a transition from the current state without applying it
+// A rejected transition is recorded if rejected transitions are recorded
+func (sm *StateMachine) prepare(ctx context.Context, to State, params ...interface{}) (TransitionEvent, error) {
 	_, ok := sm.states[to]
 	if !ok {
-		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+		return TransitionEvent{}, fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	from := sm.state
+
+	sm.coverage.attempted(from, to)
+
+	event := TransitionEvent{From: from, To: to, Event: sm.firing, Params: params, At: sm.clock.Now(), Result: Rejected}
+	sm.firing = ""
+
+	if next, ok := sm.throttled(from, to, event.At); ok {
+		if sm.recordRejected {
+			sm.history = append(sm.history, event)
+		}
+
+		return TransitionEvent{}, fmt.Errorf("transition: %v -> %v, not before %v, %w", from, to, next.Format(time.RFC3339), TransitionThrottled)
+	}
+
+	if next, ok := sm.closed(from, to, event.At); ok {
+		if sm.recordRejected {
+			sm.history = append(sm.history, event)
+		}
+
+		return TransitionEvent{}, fmt.Errorf("transition: %v -> %v, next window at %v, %w", from, to, next.Format(time.RFC3339), OutsideWindow)
+	}
+
+	allowed, err := sm.evaluate(ctx, from, to, params...)
+	if err != nil {
+		return TransitionEvent{}, err
+	}
+
+	sm.shadow.compare(from, to, allowed, params...)
+
+	if !allowed {
+		if sm.recordRejected {
+			sm.history = append(sm.history, event)
+		}
+
+		return TransitionEvent{}, TransitionNotAllowed
+	}
+
+	event.Result = Allowed
+	event.To = sm.overflow(to)
+	if event.To != to {
+		event.Requested = to
+	}
+
+	return event, nil
+}
+
+// commit applies a transition prepared by prepare and calls the actions of the edge
+// Whether ctx is done is decided by the caller, so that a transition is not applied after it timed out
+// If the StateMachine has a Journal, the transition is journaled before it is applied and marked done once every
+// action succeeded, see Recover
+func (sm *StateMachine) commit(ctx context.Context, event TransitionEvent) error {
+	seq, err := sm.journalBegin(event)
+	if err != nil {
+		return fmt.Errorf("transition: %v -> %v, %w", event.From, event.To, err)
+	}
+
+	sm.apply(event)
+
+	err = sm.runActions(ctx, event)
+	if err != nil {
+		return err
 	}
 
-	for _, rule := range sm.rules {
-		if rule.From() == sm.state && rule.To() == to {
-			if rule.Valid(sm.state, to, params...) {
-				sm.state = to
+	return sm.journalDone(seq, event)
+}
+
+// apply records an allowed transition and moves the StateMachine into its end state
+func (sm *StateMachine) apply(event TransitionEvent) {
+	sm.coverage.taken(event.From, event.requested())
+	sm.history = append(sm.history, event)
+	sm.state = event.To
+}
+
+// runActions runs the actions of a transition between the wildcard hooks, see edgeActions,
+// stopping at the first failing one, the context of the actions gives access to the metadata, see MetadataFrom
+func (sm *StateMachine) runActions(ctx context.Context, event TransitionEvent) error {
+	groups := [...][]Action{sm.hooks.exit, sm.hooks.transition, sm.actions[edge{from: event.From, to: event.To}], sm.entries[event.To], sm.hooks.enter}
+	if len(groups[0])+len(groups[1])+len(groups[2])+len(groups[3])+len(groups[4]) == 0 {
+		return nil
+	}
 
-				return nil
+	ctx = context.WithValue(ctx, metadataKey{}, sm)
+	for g, actions := range groups {
+		for i, action := range actions {
+			err := action(ctx, event)
+			sm.tracing.acted(hookNames[g], i, err)
+			if err != nil {
+				return fmt.Errorf("transition: %v -> %v, %w: %w", event.From, event.To, ActionFailed, err)
 			}
+		}
+	}
 
-			return TransitionNotAllowed
+	return nil
+}
+
+// evaluate checks the rules of an edge, ctx is checked before each rule, so that no rule is evaluated once it is done
+func (sm *StateMachine) evaluate(ctx context.Context, from, to State, params ...interface{}) (bool, error) {
+	if sm.tracing != nil {
+		return sm.evaluateTraced(ctx, from, to, params...)
+	}
+
+	allowed := sm.check(ctx, from, to, nil, params...)
+	if ctx.Err() != nil {
+		return false, contextErr(ctx)
+	}
+
+	return allowed, nil
+}
+
+// contextErr converts the error of a done context into the error returned by transitions
+func contextErr(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrDeadlineExceeded
+	}
+
+	return ctx.Err()
+}
+
+// allowed is true if the rules matching the two states allow the transition
+// according to the MatchStrategy of the edge
+func (sm *StateMachine) allowed(from, to State, params ...interface{}) bool {
+	return sm.check(context.Background(), from, to, nil, params...)
+}
+
+// check is allowed recording the evaluated rules in trace, which may be nil
+// It is false once ctx is done, without evaluating the remaining rules
+func (sm *StateMachine) check(ctx context.Context, from, to State, trace *DebugTrace, params ...interface{}) bool {
+	strategy := sm.matchStrategy(from, to)
+	if strategy == AnyPasses && sm.adaptive != nil {
+		return sm.adaptive.anyPasses(ctx, sm, from, to, trace, params...)
+	}
+
+	matched := false
+	for index, rule := range sm.edgeRules(from, to) {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		valid := sm.valid(rule, from, to, params...)
+		sm.coverage.evaluated(from, to, index, valid)
+		trace.evaluated(index, rule, valid)
+
+		switch strategy {
+		case AnyPasses:
+			if valid {
+				return true
+			}
+		case AllMustPass:
+			if !valid {
+				return false
+			}
+		default:
+			if valid {
+				return true
+			}
+
+			_, passThrough := rule.(*PassThroughTransitionRule)
+			if !passThrough {
+				return false
+			}
 		}
+
+		matched = true
 	}
 
-	return TransitionNotAllowed
+	return matched && strategy == AllMustPass
 }
 
 // equalIntegers is a helper function to demonstrate the capabilities of the ConditionalTransitionRule
@@ -194,6 +921,10 @@ func equalIntegers(params ...interface{}) bool {
 // Initial -> Backlog is unconditional (SimpleTransitionRule)
 // Backlog -> Progress is conditional (ConditionalTransitionRule)
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(smctl(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// Initialise
 	i := State("Initial")
 	b := State("Backlog")
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	InstanceNotFound = fmt.Errorf("error: instance not found")
+	InstanceExists   = fmt.Errorf("error: instance already exists")
+)
+
+// instance is a StateMachine managed by a Manager, guarded by its own lock
+type instance struct {
+	mu      sync.Mutex
+	sm      *StateMachine
+	added   time.Time
+	tags    []string
+	version string
+	dirty   bool
+	reject  atomic.Bool
+	busy    atomic.Bool
+}
+
+// Manager keeps track of StateMachine instances identified by an ID
+// Transitions done through the Manager are safe for concurrent use
+type Manager struct {
+	mu        sync.RWMutex
+	instances map[string]*instance
+	byState   map[State]map[string]bool
+	byTag     map[string]map[string]bool
+	groups    map[string]*childGroup
+	spawned   map[string]int
+	clock     Clock
+	signals   SignalPolicy
+	bulk      int
+
+	timerStore    TimerStore
+	timerHandlers map[string]func(ctx context.Context, timer Timer) error
+	slas          map[State]SLAPolicy
+	projections   []Projection
+
+	watchMu  sync.Mutex
+	watchers map[string]map[*watcher]bool
+
+	blue  *deployment
+	green *deployment
+
+	healthLimits HealthLimits
+	healthChecks map[string]func(ctx context.Context) error
+	queues       map[string]*Mailbox
+
+	instanceStore InstanceStore
+	closed        atomic.Bool
+	inFlight      atomic.Int64
+}
+
+// NewManager creates a new Manager instance
+func NewManager() *Manager {
+	m := &Manager{
+		instances: map[string]*instance{},
+		byState:   map[State]map[string]bool{},
+		byTag:     map[string]map[string]bool{},
+		groups:    map[string]*childGroup{},
+		spawned:   map[string]int{},
+		clock:     systemClock{},
+		signals:   SignalPolicy{MaxDepth: 8},
+		bulk:      runtime.GOMAXPROCS(0),
+
+		timerStore:    NewMemoryTimerStore(),
+		timerHandlers: map[string]func(ctx context.Context, timer Timer) error{},
+		slas:          map[State]SLAPolicy{},
+
+		watchers: map[string]map[*watcher]bool{},
+
+		healthChecks: map[string]func(ctx context.Context) error{},
+		queues:       map[string]*Mailbox{},
+	}
+	m.timerHandlers[deferredTimer] = m.transitionDue
+	m.timerHandlers[scheduledTimer] = m.transitionDue
+
+	return m
+}
+
+// SetClock sets the Clock used by the Manager, e.g. for rolling windows of statistics
+func (m *Manager) SetClock(clock Clock) {
+	m.clock = clock
+}
+
+// Add registers a StateMachine under the given ID
+func (m *Manager) Add(id string, sm *StateMachine) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.add(id, sm, "")
+}
+
+// add registers a StateMachine of a definition version under the given ID, m.mu must be held
+func (m *Manager) add(id string, sm *StateMachine, version string) error {
+	if m.closed.Load() {
+		return fmt.Errorf("instance: %v, %w", id, ManagerShutDown)
+	}
+
+	_, ok := m.instances[id]
+	if ok {
+		return fmt.Errorf("instance: %v, %w", id, InstanceExists)
+	}
+
+	inst := &instance{sm: sm, added: m.clock.Now(), version: version}
+	inst.reject.Store(sm.concurrency == RejectConcurrent)
+	m.instances[id] = inst
+	m.index(id, sm.State())
+
+	policy, ok := m.slas[sm.State()]
+	if ok {
+		return m.resumeSLA(id, sm.State(), policy, inst.entered())
+	}
+
+	return nil
+}
+
+// Remove unregisters the StateMachine with the given ID
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.remove(id)
+}
+
+// remove unregisters the StateMachine with the given ID, m.mu must be held
+func (m *Manager) remove(id string) error {
+	_, ok := m.instances[id]
+	if !ok {
+		return fmt.Errorf("instance: %v, %w", id, InstanceNotFound)
+	}
+
+	delete(m.instances, id)
+	delete(m.groups, id)
+	for _, ids := range m.byTag {
+		delete(ids, id)
+	}
+	state := m.unindex(id)
+	m.unwatch(id)
+
+	return m.stopSLA(id, state)
+}
+
+// IDs returns the IDs of all instances in alphabetical order
+func (m *Manager) IDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.instances))
+	for id := range m.instances {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// State returns the current state of the instance with the given ID
+func (m *Manager) State(id string) (State, error) {
+	var state State
+	err := m.with(id, func(sm *StateMachine) error {
+		state = sm.State()
+
+		return nil
+	})
+
+	return state, err
+}
+
+// History returns the history of the instance with the given ID
+func (m *Manager) History(id string) ([]TransitionEvent, error) {
+	var history []TransitionEvent
+	err := m.with(id, func(sm *StateMachine) error {
+		history = sm.History()
+
+		return nil
+	})
+
+	return history, err
+}
+
+// AppendHistory appends the history of the instance with the given ID to dst, see StateMachine.AppendHistory
+func (m *Manager) AppendHistory(dst []TransitionEvent, id string) ([]TransitionEvent, error) {
+	err := m.with(id, func(sm *StateMachine) error {
+		dst = sm.AppendHistory(dst)
+
+		return nil
+	})
+
+	return dst, err
+}
+
+// Transition attempts to transition the instance with the given ID into a new State
+func (m *Manager) Transition(id string, to State, params ...interface{}) error {
+	return m.TransitionContext(context.Background(), id, to, params...)
+}
+
+// TransitionContext is like Transition, but gives up as soon as ctx is done
+// Transitions outside of the window of their calendar are deferred to the next window, see SetCalendar, which is
+// reported by TransitionDeferred
+func (m *Manager) TransitionContext(ctx context.Context, id string, to State, params ...interface{}) error {
+	return m.deferred(ctx, id, "", func(ctx context.Context, sm *StateMachine) (State, error) {
+		return to, sm.TransitionContext(ctx, to, params...)
+	}, params)
+}
+
+// Fire fires an event on the instance with the given ID
+func (m *Manager) Fire(id string, event Event, params ...interface{}) error {
+	return m.FireContext(context.Background(), id, event, params...)
+}
+
+// FireContext is like Fire, but gives up as soon as ctx is done
+// Transitions outside of the window of their calendar are deferred like by TransitionContext
+func (m *Manager) FireContext(ctx context.Context, id string, event Event, params ...interface{}) error {
+	return m.deferred(ctx, id, event, func(ctx context.Context, sm *StateMachine) (State, error) {
+		return sm.fire(ctx, event, params...)
+	}, params)
+}
+
+// instance retrieves an instance by ID
+func (m *Manager) instance(id string) (*instance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	inst, ok := m.instances[id]
+	if !ok {
+		return nil, fmt.Errorf("instance: %v, %w", id, InstanceNotFound)
+	}
+
+	return inst, nil
+}
+
+// with calls fn with the StateMachine of the given ID while holding the lock of the instance
+// The state index, the SLA timers, the projections and the watchers are updated before the lock is released
+func (m *Manager) with(id string, fn func(sm *StateMachine) error) error {
+	inst, err := m.instance(id)
+	if err != nil {
+		return err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return m.within(id, inst, fn)
+}
+
+// within is with for an instance whose lock is held
+func (m *Manager) within(id string, inst *instance, fn func(sm *StateMachine) error) error {
+	from := inst.sm.State()
+	recorded := len(inst.sm.history)
+	err := fn(inst.sm)
+
+	to := inst.sm.State()
+	if to != from || len(inst.sm.history) > recorded {
+		inst.dirty = true
+	}
+
+	if to != from {
+		m.reindex(id, from, to)
+		err = errors.Join(err, m.enterSLA(id, from, to, inst.entered()))
+	}
+
+	if len(inst.sm.history) > recorded {
+		err = errors.Join(err, m.project(id, inst.sm.history[recorded:]))
+		m.notify(id, inst.sm.history[recorded:])
+	}
+
+	return err
+}
+
+// each calls fn with every instance while holding the lock of the instance, in alphabetical order of the IDs
+func (m *Manager) each(fn func(id string, sm *StateMachine)) {
+	for _, id := range m.IDs() {
+		_ = m.with(id, func(sm *StateMachine) error {
+			fn(id, sm)
+
+			return nil
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Matrix is the table of the transitions allowed between every two states of a StateMachine, Rules[i][j] names
+// the rules from States[i] to States[j] in evaluation order, none if the transition is never allowed
+type Matrix struct {
+	States []State
+	Rules  [][][]string
+}
+
+// Matrix returns the permission matrix of the StateMachine, e.g. for product owners reviewing a workflow
+// Rules are named by AddNamedRule, by their String method or by their type, see Describe
+func (sm *StateMachine) Matrix() Matrix {
+	states := sm.States()
+	matrix := Matrix{States: states, Rules: make([][][]string, len(states))}
+
+	for i, from := range states {
+		matrix.Rules[i] = make([][]string, len(states))
+		for j, to := range states {
+			for _, rule := range sm.edgeRules(from, to) {
+				matrix.Rules[i][j] = append(matrix.Rules[i][j], sm.ruleName(rule))
+			}
+		}
+	}
+
+	return matrix
+}
+
+// Cell describes the rules of a transition, "-" for staying in the same state, which is always allowed,
+// and an empty string for transitions without rules
+func (m Matrix) Cell(i, j int) string {
+	if i == j {
+		return "-"
+	}
+
+	return strings.Join(m.Rules[i][j], ", ")
+}
+
+// WriteCSV writes the matrix as CSV, the rows are the start states and the columns the end states
+func (m Matrix) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	err := writer.Write(m.header())
+	if err != nil {
+		return fmt.Errorf("writing csv: %w", err)
+	}
+
+	for i, from := range m.States {
+		err = writer.Write(m.row(i, string(from)))
+		if err != nil {
+			return fmt.Errorf("writing csv: %w", err)
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// WriteMarkdown writes the matrix as a Markdown table, the rows are the start states and the columns the end states
+func (m Matrix) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	escape := strings.NewReplacer("|", "\\|")
+
+	line := func(cells []string) {
+		for i, cell := range cells {
+			cells[i] = escape.Replace(cell)
+		}
+
+		_, _ = fmt.Fprintf(bw, "| %s |\n", strings.Join(cells, " | "))
+	}
+
+	line(m.header())
+	_, _ = fmt.Fprintf(bw, "|%s\n", strings.Repeat(" --- |", len(m.States)+1))
+
+	for i, from := range m.States {
+		line(m.row(i, string(from)))
+	}
+
+	return bw.Flush()
+}
+
+// header returns the header row of the matrix with the end states
+func (m Matrix) header() []string {
+	cells := []string{"from \\ to"}
+	for _, to := range m.States {
+		cells = append(cells, string(to))
+	}
+
+	return cells
+}
+
+// row returns the row of a start state
+func (m Matrix) row(i int, from string) []string {
+	cells := []string{from}
+	for j := range m.States {
+		cells = append(cells, m.Cell(i, j))
+	}
+
+	return cells
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// Metadata is the key-value context of an instance persisted with it, e.g. its assignee or retry count
+// Values restored from JSON are decoded like the params of scenarios, whole numbers as int
+type Metadata map[string]interface{}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping whole numbers as int
+func (md *Metadata) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var values map[string]interface{}
+	err := decoder.Decode(&values)
+	if err != nil {
+		return err
+	}
+
+	*md = Metadata(jsonValue(values).(map[string]interface{}))
+
+	return nil
+}
+
+// copy returns a copy of the metadata, nil if it is empty
+func (md Metadata) copy() Metadata {
+	if len(md) == 0 {
+		return nil
+	}
+
+	copied := make(Metadata, len(md))
+	for key, value := range md {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+// metadataKey is the context key of the StateMachine whose actions are running
+type metadataKey struct{}
+
+// Metadata returns a copy of the metadata of the StateMachine
+func (sm *StateMachine) Metadata() Metadata {
+	return sm.metadata.copy()
+}
+
+// MetadataValue returns a metadata value of the StateMachine
+func (sm *StateMachine) MetadataValue(key string) (interface{}, bool) {
+	value, ok := sm.metadata[key]
+
+	return value, ok
+}
+
+// SetMetadata sets a metadata value of the StateMachine
+func (sm *StateMachine) SetMetadata(key string, value interface{}) {
+	if sm.metadata == nil {
+		sm.metadata = Metadata{}
+	}
+
+	sm.metadata[key] = value
+}
+
+// DeleteMetadata removes a metadata value of the StateMachine
+func (sm *StateMachine) DeleteMetadata(key string) {
+	delete(sm.metadata, key)
+}
+
+// MetadataFrom returns the StateMachine whose actions are running from the context passed to an action, so that
+// the action can read and write the metadata of the instance, false outside of actions and in a
+// CompiledStateMachine
+func MetadataFrom(ctx context.Context) (*StateMachine, bool) {
+	sm, ok := ctx.Value(metadataKey{}).(*StateMachine)
+
+	return sm, ok
+}
+
+// Metadata returns a metadata value of the viewed StateMachine
+func (v MachineView) Metadata(key string) (interface{}, bool) {
+	if v.sm == nil {
+		return nil, false
+	}
+
+	return v.sm.MetadataValue(key)
+}
+
+// InstanceMetadata returns a copy of the metadata of the instance with the given ID
+func (m *Manager) InstanceMetadata(id string) (Metadata, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return nil, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return inst.sm.Metadata(), nil
+}
+
+// SetInstanceMetadata sets a metadata value of the instance with the given ID
+func (m *Manager) SetInstanceMetadata(id, key string, value interface{}) error {
+	return m.withMetadata(id, func(sm *StateMachine) {
+		sm.SetMetadata(key, value)
+	})
+}
+
+// DeleteInstanceMetadata removes a metadata value of the instance with the given ID
+func (m *Manager) DeleteInstanceMetadata(id, key string) error {
+	return m.withMetadata(id, func(sm *StateMachine) {
+		sm.DeleteMetadata(key)
+	})
+}
+
+// withMetadata calls fn changing the metadata of an instance while holding its lock and marks it as changed,
+// see Flush
+func (m *Manager) withMetadata(id string, fn func(sm *StateMachine)) error {
+	inst, err := m.instance(id)
+	if err != nil {
+		return err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	fn(inst.sm)
+	inst.dirty = true
+
+	return nil
+}
+
+// matchesMetadata is true if the metadata has every value of the query, inst.mu must be held
+func (q Query) matchesMetadata(inst *instance) bool {
+	for key, want := range q.Metadata {
+		value, ok := inst.sm.metadata[key]
+		if !ok || !reflect.DeepEqual(value, want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stored returns the persisted form of the instance with the given ID, inst.mu must be held
+func (inst *instance) stored(id string) StoredInstance {
+	return StoredInstance{ID: id, Version: inst.version, State: inst.sm.State(), History: inst.sm.History(), Metadata: inst.sm.Metadata()}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MigrationReport describes the outcome of a Migrate
+type MigrationReport struct {
+	Migrated []string
+	// Unmigratable maps the IDs of the instances which were left alone to their states missing from the mapping
+	Unmigratable map[string]State
+}
+
+// String returns a one line summary of the migration
+func (r MigrationReport) String() string {
+	ids := make([]string, 0, len(r.Unmigratable))
+	for id := range r.Unmigratable {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return fmt.Sprintf("%d migrated, %d unmigratable: %v", len(r.Migrated), len(r.Unmigratable), strings.Join(ids, ", "))
+}
+
+// Migrate moves the instances of fromVersion in store to toVersion, mapping their states by mapping
+// Every state of fromVersion must be mapped, even to itself, instances in unmapped states are reported and left alone
+// The migrated instances are saved at once, so either all of them are migrated or none of them, their histories
+// are kept as they were recorded
+func Migrate(store InstanceStore, fromVersion, toVersion string, mapping map[State]State) (MigrationReport, error) {
+	report := MigrationReport{Unmigratable: map[string]State{}}
+
+	ids, err := store.IDs()
+	if err != nil {
+		return report, fmt.Errorf("listing instances: %w", err)
+	}
+
+	var migrated []StoredInstance
+	for _, id := range ids {
+		instance, err := store.Load(id)
+		if err != nil {
+			return report, err
+		}
+
+		if instance.Version != fromVersion {
+			continue
+		}
+
+		state, ok := mapping[instance.State]
+		if !ok {
+			report.Unmigratable[id] = instance.State
+
+			continue
+		}
+
+		instance.Version = toVersion
+		instance.State = state
+		migrated = append(migrated, instance)
+	}
+
+	if len(migrated) == 0 {
+		return report, nil
+	}
+
+	err = store.SaveAll(migrated)
+	if err != nil {
+		return report, fmt.Errorf("saving migrated instances: %w", err)
+	}
+
+	for _, instance := range migrated {
+		report.Migrated = append(report.Migrated, instance.ID)
+	}
+
+	return report, nil
+}
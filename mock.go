@@ -0,0 +1,127 @@
+//go:build smmock
+
+// The fakes are only built with the smmock tag, e.g. `go test -tags smmock`, so that they are not part of production
+// binaries, a separate smmock package could not import package main
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// MockRule is a scriptable TransitionRule for tests, recording the params of every evaluation
+// It returns its scripted results one by one, repeating the last one, and allows every transition without a script
+type MockRule struct {
+	mu      sync.Mutex
+	from    State
+	to      State
+	results []bool
+	calls   [][]interface{}
+}
+
+// NewMockRule creates a new MockRule returning results in order
+func NewMockRule(from, to State, results ...bool) *MockRule {
+	return &MockRule{
+		from:    from,
+		to:      to,
+		results: results,
+	}
+}
+
+// From retrieves the start state the transition rule applies to
+func (r *MockRule) From() State {
+	return r.from
+}
+
+// To retrieves the end state the transition rule applies to
+func (r *MockRule) To() State {
+	return r.to
+}
+
+// Script replaces the results returned by the following evaluations
+func (r *MockRule) Script(results ...bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results = results
+}
+
+// Valid records the evaluation and returns the next scripted result
+func (r *MockRule) Valid(from, to State, params ...interface{}) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, params)
+
+	if from != r.from || to != r.to {
+		return false
+	}
+
+	if len(r.results) == 0 {
+		return true
+	}
+
+	result := r.results[0]
+	if len(r.results) > 1 {
+		r.results = r.results[1:]
+	}
+
+	return result
+}
+
+// Calls returns the params of every evaluation in order
+func (r *MockRule) Calls() [][]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([][]interface{}(nil), r.calls...)
+}
+
+// MockClock is a Clock for tests which only moves when told to
+type MockClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	calls int
+}
+
+// NewMockClock creates a new MockClock showing now
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{
+		now: now,
+	}
+}
+
+// Now returns the current time of the MockClock
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+
+	return c.now
+}
+
+// Set moves the MockClock to a point in time
+func (c *MockClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance moves the MockClock forward by d
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Calls returns the number of times Now was called
+func (c *MockClock) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.calls
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MongoInstanceDocument is the document of an instance in the instances collection, Events counts every event
+// ever saved for it, including the ones already evicted from the capped events collection
+type MongoInstanceDocument struct {
+	ID        string    `bson:"_id" json:"id"`
+	State     State     `bson:"state" json:"state"`
+	Version   string    `bson:"version" json:"version"`
+	Events    int       `bson:"events" json:"events"`
+	Metadata  Metadata  `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// MongoEventDocument is the document of a TransitionEvent in the events collection, Origin names the store which
+// saved it so that change streams can tell the events of other replicas apart
+type MongoEventDocument struct {
+	InstanceID string          `bson:"instanceId" json:"instanceId"`
+	Seq        int             `bson:"seq" json:"seq"`
+	Origin     string          `bson:"origin" json:"origin"`
+	Event      TransitionEvent `bson:"event" json:"event"`
+}
+
+// MongoDatabase is a MongoDB database with an instances collection and a capped events collection indexed on
+// instanceId and seq, adapters wrap the driver
+// FindInstance returns InstanceNotFound for missing documents, SaveInstances upserts the instance documents and
+// inserts the event documents in a single transaction, WatchEvents follows a change stream of inserted events until
+// ctx is done, then closes the channel
+type MongoDatabase interface {
+	FindInstance(ctx context.Context, id string) (MongoInstanceDocument, error)
+	FindEvents(ctx context.Context, id string) ([]MongoEventDocument, error)
+	SaveInstances(ctx context.Context, instances []MongoInstanceDocument, events []MongoEventDocument) error
+	DeleteInstance(ctx context.Context, id string) error
+	InstanceIDs(ctx context.Context) ([]string, error)
+	WatchEvents(ctx context.Context) <-chan MongoEventDocument
+}
+
+// MemoryMongoDatabase is a MongoDatabase keeping documents in memory, it does not survive restarts on its own
+// Like a capped collection, it keeps the latest capacity events only
+type MemoryMongoDatabase struct {
+	mu        sync.Mutex
+	capacity  int
+	instances map[string]MongoInstanceDocument
+	events    []MongoEventDocument
+	watchers  map[chan MongoEventDocument]bool
+}
+
+// NewMemoryMongoDatabase creates a new MemoryMongoDatabase keeping capacity events
+func NewMemoryMongoDatabase(capacity int) *MemoryMongoDatabase {
+	return &MemoryMongoDatabase{
+		capacity:  capacity,
+		instances: map[string]MongoInstanceDocument{},
+		watchers:  map[chan MongoEventDocument]bool{},
+	}
+}
+
+// FindInstance returns the document of an instance
+func (db *MemoryMongoDatabase) FindInstance(_ context.Context, id string) (MongoInstanceDocument, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	document, ok := db.instances[id]
+	if !ok {
+		return MongoInstanceDocument{}, fmt.Errorf("instance: %v, %w", id, InstanceNotFound)
+	}
+
+	return document, nil
+}
+
+// FindEvents returns the retained events of an instance in order of seq
+func (db *MemoryMongoDatabase) FindEvents(_ context.Context, id string) ([]MongoEventDocument, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var events []MongoEventDocument
+	for _, event := range db.events {
+		if event.InstanceID == id {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq < events[j].Seq
+	})
+
+	return events, nil
+}
+
+// SaveInstances upserts instances and inserts events
+func (db *MemoryMongoDatabase) SaveInstances(_ context.Context, instances []MongoInstanceDocument, events []MongoEventDocument) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, instance := range instances {
+		db.instances[instance.ID] = instance
+	}
+
+	db.events = append(db.events, events...)
+	if len(db.events) > db.capacity {
+		db.events = append([]MongoEventDocument(nil), db.events[len(db.events)-db.capacity:]...)
+	}
+
+	for _, event := range events {
+		for watcher := range db.watchers {
+			select {
+			case watcher <- event:
+			default:
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteInstance removes the document of an instance, its events are left to be evicted
+func (db *MemoryMongoDatabase) DeleteInstance(_ context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.instances, id)
+
+	return nil
+}
+
+// InstanceIDs returns the IDs of the instances in alphabetical order
+func (db *MemoryMongoDatabase) InstanceIDs(_ context.Context) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ids := make([]string, 0, len(db.instances))
+	for id := range db.instances {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// WatchEvents sends the inserted events until ctx is done, watchers which do not keep up miss events
+func (db *MemoryMongoDatabase) WatchEvents(ctx context.Context) <-chan MongoEventDocument {
+	events := make(chan MongoEventDocument, 64)
+
+	db.mu.Lock()
+	db.watchers[events] = true
+	db.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		db.mu.Lock()
+		delete(db.watchers, events)
+		db.mu.Unlock()
+
+		close(events)
+	}()
+
+	return events
+}
+
+// MongoInstanceStore is an InstanceStore keeping instances in a MongoDatabase
+// Histories are kept in a capped collection, so a loaded instance only has the events which were not evicted yet
+type MongoInstanceStore struct {
+	db     MongoDatabase
+	origin string
+	clock  Clock
+
+	mu sync.Mutex
+	// saved is the number of events of the history of an instance which are already saved
+	saved map[string]int
+	// seqs is the number of events ever saved for an instance
+	seqs map[string]int
+}
+
+// NewMongoInstanceStore creates a new MongoInstanceStore, origin names it in the events it saves, e.g. the hostname
+func NewMongoInstanceStore(db MongoDatabase, origin string, clock Clock) *MongoInstanceStore {
+	return &MongoInstanceStore{
+		db:     db,
+		origin: origin,
+		clock:  clock,
+		saved:  map[string]int{},
+		seqs:   map[string]int{},
+	}
+}
+
+// Load returns an instance with its retained events
+func (s *MongoInstanceStore) Load(id string) (StoredInstance, error) {
+	ctx := context.Background()
+
+	document, err := s.db.FindInstance(ctx, id)
+	if err != nil {
+		return StoredInstance{}, err
+	}
+
+	events, err := s.db.FindEvents(ctx, id)
+	if err != nil {
+		return StoredInstance{}, fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	instance := StoredInstance{ID: id, Version: document.Version, State: document.State, Metadata: document.Metadata}
+	for _, event := range events {
+		if event.Seq < document.Events {
+			instance.History = append(instance.History, event.Event)
+		}
+	}
+
+	s.mu.Lock()
+	s.saved[id] = len(instance.History)
+	s.seqs[id] = document.Events
+	s.mu.Unlock()
+
+	return instance, nil
+}
+
+// Save adds or replaces an instance
+func (s *MongoInstanceStore) Save(instance StoredInstance) error {
+	return s.SaveAll([]StoredInstance{instance})
+}
+
+// SaveAll adds or replaces instances, inserting the events added to their histories since they were loaded or saved
+func (s *MongoInstanceStore) SaveAll(instances []StoredInstance) error {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	saved := make(map[string]int, len(instances))
+	seqs := make(map[string]int, len(instances))
+	for _, instance := range instances {
+		saved[instance.ID] = s.saved[instance.ID]
+		seqs[instance.ID] = s.seqs[instance.ID]
+	}
+	s.mu.Unlock()
+
+	documents := make([]MongoInstanceDocument, 0, len(instances))
+	var events []MongoEventDocument
+	for _, instance := range instances {
+		// a history replaced by a shorter one, e.g. by Migrate, is saved again after the old events
+		first := saved[instance.ID]
+		if first > len(instance.History) {
+			first = 0
+		}
+
+		for _, event := range instance.History[first:] {
+			events = append(events, MongoEventDocument{InstanceID: instance.ID, Seq: seqs[instance.ID], Origin: s.origin, Event: event})
+			seqs[instance.ID]++
+		}
+
+		documents = append(documents, MongoInstanceDocument{ID: instance.ID, State: instance.State, Version: instance.Version, Events: seqs[instance.ID], Metadata: instance.Metadata, UpdatedAt: now})
+	}
+
+	err := s.db.SaveInstances(context.Background(), documents, events)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for _, instance := range instances {
+		s.saved[instance.ID] = len(instance.History)
+		s.seqs[instance.ID] = seqs[instance.ID]
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Delete removes an instance
+func (s *MongoInstanceStore) Delete(id string) error {
+	err := s.db.DeleteInstance(context.Background(), id)
+	if err != nil {
+		return fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	s.mu.Lock()
+	delete(s.saved, id)
+	delete(s.seqs, id)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// IDs returns the IDs of the instances in alphabetical order
+func (s *MongoInstanceStore) IDs() ([]string, error) {
+	return s.db.InstanceIDs(context.Background())
+}
+
+// WatchMongo follows the change stream of the events saved to store by other replicas until ctx is done, the
+// instances of the Manager are moved along with the allowed transitions and the events are sent to their watchers,
+// see Watch
+// Instances the Manager does not have are ignored, they are loaded on demand, events of an instance transitioned by
+// several replicas at once are not merged, the ones not saved yet by this replica are lost
+func (m *Manager) WatchMongo(ctx context.Context, store *MongoInstanceStore) {
+	for document := range store.db.WatchEvents(ctx) {
+		if document.Origin == store.origin {
+			continue
+		}
+
+		inst, err := m.instance(document.InstanceID)
+		if err != nil {
+			continue
+		}
+
+		event := document.Event
+		state := event.To
+		if event.Result != Allowed {
+			state = event.From
+		}
+
+		inst.mu.Lock()
+		_ = m.catchUp(document.InstanceID, inst, []TransitionEvent{event}, state)
+		store.caughtUp(document.InstanceID, len(inst.sm.history), document.Seq+1)
+		inst.mu.Unlock()
+	}
+}
+
+// caughtUp records that an instance got the events saved by another replica, so they are not saved again
+func (s *MongoInstanceStore) caughtUp(id string, saved, seqs int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saved[id] = saved
+	s.seqs[id] = max(s.seqs[id], seqs)
+}
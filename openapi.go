@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// OpenAPI generates the OpenAPI 3 document of the REST API served by NewHandler for a definition,
+// enumerating its states and events, so that clients can be generated for it
+func OpenAPI(definition *StateMachine, title string) ([]byte, error) {
+	states := []string{}
+	for _, state := range definition.States() {
+		states = append(states, string(state))
+	}
+
+	events := []string{}
+	seen := map[Event]bool{}
+	for t := range definition.events {
+		if !seen[t.event] {
+			seen[t.event] = true
+			events = append(events, string(t.event))
+		}
+	}
+	sort.Strings(events)
+
+	ref := func(name string) map[string]interface{} {
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	body := func(schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": ref(schema)},
+			},
+		}
+	}
+
+	response := func(description, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": ref(schema)},
+			},
+		}
+	}
+
+	errorResponses := func(responses map[string]interface{}, statuses ...int) map[string]interface{} {
+		descriptions := map[int]string{
+			202: "The transition is deferred to the next window of its calendar",
+			400: "Invalid request or unknown state",
+			404: "Instance not found",
+			409: "Instance already exists, the transition is not allowed, or another one is in progress",
+			429: "The transition is throttled",
+			503: "The manager is shut down",
+			504: "The guards did not finish in time",
+		}
+
+		for _, status := range statuses {
+			responses[fmt.Sprint(status)] = response(descriptions[status], "Error")
+		}
+
+		return responses
+	}
+
+	idParam := map[string]interface{}{
+		"name":     "id",
+		"in":       "path",
+		"required": true,
+		"schema":   map[string]interface{}{"type": "string"},
+	}
+
+	params := map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{},
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": "1.0.0",
+		},
+		"paths": map[string]interface{}{
+			"/instances": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "createInstance",
+					"requestBody": body("CreateRequest"),
+					"responses": errorResponses(map[string]interface{}{
+						"201": response("Instance created", "Instance"),
+					}, 400, 409),
+				},
+			},
+			"/instances/{id}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getInstance",
+					"parameters":  []interface{}{idParam},
+					"responses": errorResponses(map[string]interface{}{
+						"200": response("Instance", "Instance"),
+					}, 404),
+				},
+			},
+			"/instances/{id}/history": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getHistory",
+					"parameters":  []interface{}{idParam},
+					"responses": errorResponses(map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Recorded transitions",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{"type": "array", "items": ref("TransitionEvent")},
+								},
+							},
+						},
+					}, 404),
+				},
+			},
+			"/instances/{id}/transitions": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "transition",
+					"parameters":  []interface{}{idParam},
+					"requestBody": body("TransitionRequest"),
+					"responses": errorResponses(map[string]interface{}{
+						"200": response("Instance after the transition", "Instance"),
+					}, 202, 400, 404, 409, 429, 503, 504),
+				},
+			},
+			"/instances/{id}/events/{event}": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "fire",
+					"parameters": []interface{}{
+						idParam,
+						map[string]interface{}{
+							"name":     "event",
+							"in":       "path",
+							"required": true,
+							"schema":   ref("Event"),
+						},
+					},
+					"requestBody": body("EventRequest"),
+					"responses": errorResponses(map[string]interface{}{
+						"200": response("Instance after the transition", "Instance"),
+					}, 202, 400, 404, 409, 429, 503, 504),
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"State": map[string]interface{}{"type": "string", "enum": states},
+				"Event": map[string]interface{}{"type": "string", "enum": events},
+				"Instance": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"id", "state"},
+					"properties": map[string]interface{}{
+						"id":    map[string]interface{}{"type": "string"},
+						"state": ref("State"),
+					},
+				},
+				"CreateRequest": map[string]interface{}{
+					"type":       "object",
+					"required":   []string{"id"},
+					"properties": map[string]interface{}{"id": map[string]interface{}{"type": "string"}},
+				},
+				"TransitionRequest": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"to"},
+					"properties": map[string]interface{}{
+						"to":     ref("State"),
+						"params": params,
+					},
+				},
+				"EventRequest": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"params": params},
+				},
+				"TransitionEvent": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"from", "to", "at", "result"},
+					"properties": map[string]interface{}{
+						"from":   ref("State"),
+						"to":     ref("State"),
+						"params": params,
+						"at":     map[string]interface{}{"type": "string", "format": "date-time"},
+						"result": map[string]interface{}{"type": "string", "enum": []TransitionResult{Allowed, Rejected}},
+					},
+				},
+				"Error": map[string]interface{}{
+					"type":       "object",
+					"required":   []string{"error"},
+					"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
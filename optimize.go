@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RemovedRule is a rule which was dropped by Optimize
+type RemovedRule struct {
+	Rule   TransitionRule
+	Reason string
+}
+
+// OptimizationReport describes the changes made by Optimize
+type OptimizationReport struct {
+	UnreachableStates []State
+	RemovedRules      []RemovedRule
+	// MergedStates maps every merged state to the state it was merged into,
+	// it can be used to migrate instances persisted in a merged state
+	MergedStates map[State]State
+}
+
+// Optimize returns a copy of the StateMachine definition without the rules which can never fire:
+// rules leaving states which are unreachable from the current state and rules shadowed by earlier rules
+// of the same edge under its MatchStrategy
+// If mergeStates is true, reachable states with identical tags, descriptions and outgoing edges, which only have
+// unconditional rules, are merged into their alphabetically first representative
+// The copy starts in the current state and has no history
+func (sm *StateMachine) Optimize(mergeStates bool) (*StateMachine, OptimizationReport) {
+	report := OptimizationReport{MergedStates: map[State]State{}}
+
+	reachable := sm.reachable(sm.state)
+	for _, state := range sm.States() {
+		if !reachable[state] {
+			report.UnreachableStates = append(report.UnreachableStates, state)
+		}
+	}
+
+	all := sm.loadRules().rules
+
+	var rules []TransitionRule
+	for i, rule := range all {
+		reason := sm.deadRuleReason(all, i, reachable)
+		if reason != "" {
+			report.RemovedRules = append(report.RemovedRules, RemovedRule{Rule: rule, Reason: reason})
+
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if mergeStates {
+		report.MergedStates = sm.equivalentStates(rules, reachable)
+	}
+
+	return sm.rebuild(rules, &report), report
+}
+
+// reachable returns the states reachable from a state, including itself
+func (sm *StateMachine) reachable(from State) map[State]bool {
+	reachable := map[State]bool{from: true}
+	queue := []State{from}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, to := range sm.Targets(state) {
+			if !reachable[to] {
+				reachable[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	return reachable
+}
+
+// deadRuleReason explains why the i-th of the rules can never fire, it is empty if the rule may fire
+func (sm *StateMachine) deadRuleReason(rules []TransitionRule, i int, reachable map[State]bool) string {
+	rule := rules[i]
+	if !reachable[rule.From()] {
+		return fmt.Sprintf("source state %v is unreachable", rule.From())
+	}
+
+	strategy := sm.matchStrategy(rule.From(), rule.To())
+	for j, earlier := range rules[:i] {
+		if earlier.From() != rule.From() || earlier.To() != rule.To() {
+			continue
+		}
+
+		switch {
+		case sameRule(earlier, rule):
+			return fmt.Sprintf("duplicate of rule #%d", j)
+		case strategy == FirstMatch && !isPassThrough(earlier):
+			return fmt.Sprintf("shadowed by rule #%d, which decides every transition first", j)
+		case strategy == AnyPasses && !guarded([]TransitionRule{earlier}):
+			return fmt.Sprintf("shadowed by rule #%d, which always passes", j)
+		}
+	}
+
+	if strategy == AllMustPass && !guarded([]TransitionRule{rule}) {
+		for j, other := range rules {
+			if j != i && other.From() == rule.From() && other.To() == rule.To() && (j < i || guarded([]TransitionRule{other})) {
+				return "always passes, which makes it redundant under the all-must-pass strategy"
+			}
+		}
+	}
+
+	return ""
+}
+
+// isPassThrough is true if the rule is a PassThroughTransitionRule
+func isPassThrough(rule TransitionRule) bool {
+	_, ok := rule.(*PassThroughTransitionRule)
+
+	return ok
+}
+
+// equivalentStates finds the states which can be merged and maps them to their representative
+// Only reachable states whose incoming and outgoing rules are all SimpleTransitionRules are considered
+func (sm *StateMachine) equivalentStates(rules []TransitionRule, reachable map[State]bool) map[State]State {
+	simple := map[State]bool{}
+	targets := map[State][]string{}
+	for _, state := range sm.States() {
+		simple[state] = true
+	}
+
+	for _, rule := range rules {
+		_, ok := rule.(*SimpleTransitionRule)
+		if !ok {
+			simple[rule.From()] = false
+			simple[rule.To()] = false
+		}
+
+		targets[rule.From()] = append(targets[rule.From()], string(rule.To()))
+	}
+
+	representatives := map[string]State{}
+	merged := map[State]State{}
+	for _, state := range sm.States() {
+		if !simple[state] || !reachable[state] {
+			continue
+		}
+
+		key := fmt.Sprintf("%q|%q|%q", unique(targets[state]), sm.tags[state], sm.descriptions[state])
+
+		representative, ok := representatives[key]
+		if !ok {
+			representatives[key] = state
+
+			continue
+		}
+
+		merged[state] = representative
+	}
+
+	return merged
+}
+
+// unique returns the distinct strings of a list, sorted and joined
+func unique(values []string) string {
+	seen := map[string]bool{}
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+
+	sort.Strings(result)
+
+	return strings.Join(result, ",")
+}
+
+// rebuild creates a new StateMachine with the configuration of sm, the given rules and merged states
+// Rules into merged states are redirected to their representative, rules out of merged states are dropped
+func (sm *StateMachine) rebuild(rules []TransitionRule, report *OptimizationReport) *StateMachine {
+	mapped := func(state State) State {
+		representative, ok := report.MergedStates[state]
+		if ok {
+			return representative
+		}
+
+		return state
+	}
+
+	var states []State
+	for _, state := range sm.States() {
+		if mapped(state) == state {
+			states = append(states, state)
+		}
+	}
+
+	optimized := NewStateMachine(mapped(sm.state), states...)
+	optimized.strategy = sm.strategy
+	optimized.recordRejected = sm.recordRejected
+	optimized.clock = sm.clock
+	optimized.container = sm.container
+
+	for e, strategy := range sm.edgeStrategies {
+		optimized.edgeStrategies[edge{from: mapped(e.from), to: mapped(e.to)}] = strategy
+	}
+
+	for _, state := range states {
+		optimized.descriptions[state] = sm.descriptions[state]
+		optimized.tags[state] = sm.Tags(state)
+	}
+
+	var kept, redirected []TransitionRule
+	edges := map[edge]bool{}
+	for _, rule := range rules {
+		from, to := mapped(rule.From()), mapped(rule.To())
+
+		switch {
+		case from != rule.From():
+			report.RemovedRules = append(report.RemovedRules, RemovedRule{Rule: rule, Reason: fmt.Sprintf("source state %v was merged into %v", rule.From(), from)})
+		case to != rule.To():
+			redirected = append(redirected, rule)
+		default:
+			kept = append(kept, rule)
+			edges[edge{from: from, to: to}] = true
+		}
+	}
+
+	for _, rule := range redirected {
+		from, to := rule.From(), mapped(rule.To())
+		if edges[edge{from: from, to: to}] {
+			report.RemovedRules = append(report.RemovedRules, RemovedRule{Rule: rule, Reason: fmt.Sprintf("target state %v was merged into %v", rule.To(), to)})
+
+			continue
+		}
+
+		kept = append(kept, NewSimpleTransitionRule(from, to))
+		edges[edge{from: from, to: to}] = true
+	}
+
+	optimized.storeRules(kept)
+
+	return optimized
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Payload is a transition param which keeps its exact type when persisted, e.g. in a trace, an InstanceStore or a
+// QueueStore, so that guards evaluate the same value after it was restored
+// PayloadType names the type, see RegisterPayload
+type Payload interface {
+	PayloadType() string
+	MarshalPayload() ([]byte, error)
+	UnmarshalPayload(data []byte) error
+}
+
+// payloads maps the registered payload types to their factories
+var payloads = struct {
+	sync.RWMutex
+	factories map[string]func() Payload
+}{factories: map[string]func() Payload{}}
+
+// RegisterPayload registers a Payload type, so that params of the type are restored from JSON,
+// factory returns a new, empty value to unmarshal into
+func RegisterPayload(factory func() Payload) {
+	payloads.Lock()
+	defer payloads.Unlock()
+
+	payloads.factories[factory().PayloadType()] = factory
+}
+
+// payloadEnvelope is the JSON form of a Payload
+type payloadEnvelope struct {
+	Type string `json:"$payload"`
+	Data []byte `json:"data"`
+}
+
+// marshalParams replaces the Payloads among params by their envelopes
+func marshalParams(params []interface{}) ([]interface{}, error) {
+	var encoded []interface{}
+	for i, param := range params {
+		payload, ok := param.(Payload)
+		if !ok {
+			continue
+		}
+
+		data, err := payload.MarshalPayload()
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %w", i, err)
+		}
+
+		if encoded == nil {
+			encoded = append([]interface{}(nil), params...)
+		}
+
+		encoded[i] = payloadEnvelope{Type: payload.PayloadType(), Data: data}
+	}
+
+	if encoded == nil {
+		return params, nil
+	}
+
+	return encoded, nil
+}
+
+// unmarshalParams decodes JSON params, restoring the Payloads of the registered types, whole numbers are decoded as
+// int, other numbers as float64, see jsonValue
+func unmarshalParams(raw []json.RawMessage) ([]interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	params := make([]interface{}, len(raw))
+	for i, r := range raw {
+		decoder := json.NewDecoder(bytes.NewReader(r))
+		decoder.UseNumber()
+
+		var param interface{}
+		err := decoder.Decode(&param)
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %w", i, err)
+		}
+
+		params[i] = jsonValue(param)
+
+		object, ok := param.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if _, ok = object["$payload"]; !ok {
+			continue
+		}
+
+		var envelope payloadEnvelope
+		err = json.Unmarshal(r, &envelope)
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %w", i, err)
+		}
+
+		payloads.RLock()
+		factory, ok := payloads.factories[envelope.Type]
+		payloads.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("param %d: payload type %v is not registered", i, envelope.Type)
+		}
+
+		payload := factory()
+		err = payload.UnmarshalPayload(envelope.Data)
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %w", i, err)
+		}
+
+		params[i] = payload
+	}
+
+	return params, nil
+}
+
+// jsonValue converts the JSON numbers of a decoded value, including the ones nested in objects and arrays
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = jsonValue(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = jsonValue(nested)
+		}
+	default:
+		return jsonParam(value)
+	}
+
+	return value
+}
+
+// MarshalJSON implements json.Marshaler, encoding Payload params with their types
+func (e TransitionEvent) MarshalJSON() ([]byte, error) {
+	type event TransitionEvent
+
+	params, err := marshalParams(e.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Params = params
+
+	return json.Marshal(event(e))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring Payload params, see RegisterPayload
+func (e *TransitionEvent) UnmarshalJSON(data []byte) error {
+	type event TransitionEvent
+
+	var decoded struct {
+		event
+		Params []json.RawMessage `json:"params,omitempty"`
+	}
+
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	params, err := unmarshalParams(decoded.Params)
+	if err != nil {
+		return err
+	}
+
+	*e = TransitionEvent(decoded.event)
+	e.Params = params
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding Payload params with their types
+func (e QueuedEvent) MarshalJSON() ([]byte, error) {
+	type event QueuedEvent
+
+	params, err := marshalParams(e.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Params = params
+
+	return json.Marshal(event(e))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring Payload params, see RegisterPayload
+func (e *QueuedEvent) UnmarshalJSON(data []byte) error {
+	type event QueuedEvent
+
+	var decoded struct {
+		event
+		Params []json.RawMessage `json:"params,omitempty"`
+	}
+
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	params, err := unmarshalParams(decoded.Params)
+	if err != nil {
+		return err
+	}
+
+	*e = QueuedEvent(decoded.event)
+	e.Params = params
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	PlanStale         = fmt.Errorf("error: plan is stale")
+	InstancesStranded = fmt.Errorf("error: instances stranded")
+)
+
+// Edge is a pair of states connected by rules
+type Edge struct {
+	From State
+	To   State
+}
+
+// InstanceImpact describes how a definition change affects an instance
+type InstanceImpact struct {
+	ID    string
+	State State
+	// Stranded is true if the state of the instance does not exist in the new definition
+	Stranded bool
+	// Lost lists the states the instance could transition into, but could not anymore
+	Lost []State
+	// Guarded lists the states the instance could transition into unconditionally, but only with guards anymore
+	Guarded []State
+}
+
+// Plan describes the impact of replacing the definition of the instances of a Manager, see Manager.Plan
+type Plan struct {
+	AddedStates   []State
+	RemovedStates []State
+	AddedEdges    []Edge
+	RemovedEdges  []Edge
+	Instances     []InstanceImpact
+
+	definition func() *StateMachine
+}
+
+// Stranded returns the IDs of the instances in states the new definition does not have
+func (p Plan) Stranded() []string {
+	var ids []string
+	for _, impact := range p.Instances {
+		if impact.Stranded {
+			ids = append(ids, impact.ID)
+		}
+	}
+
+	return ids
+}
+
+// String returns a human-readable description of the plan, one change per line
+func (p Plan) String() string {
+	sb := strings.Builder{}
+	for _, state := range p.AddedStates {
+		_, _ = fmt.Fprintf(&sb, "+ state %v\n", state)
+	}
+	for _, state := range p.RemovedStates {
+		_, _ = fmt.Fprintf(&sb, "- state %v\n", state)
+	}
+	for _, e := range p.AddedEdges {
+		_, _ = fmt.Fprintf(&sb, "+ edge %v -> %v\n", e.From, e.To)
+	}
+	for _, e := range p.RemovedEdges {
+		_, _ = fmt.Fprintf(&sb, "- edge %v -> %v\n", e.From, e.To)
+	}
+	for _, impact := range p.Instances {
+		switch {
+		case impact.Stranded:
+			_, _ = fmt.Fprintf(&sb, "! instance %v: state %v removed\n", impact.ID, impact.State)
+		default:
+			_, _ = fmt.Fprintf(&sb, "~ instance %v in %v: lost %v, guarded %v\n", impact.ID, impact.State, impact.Lost, impact.Guarded)
+		}
+	}
+	_, _ = fmt.Fprintf(&sb, "%d instances affected, %d stranded\n", len(p.Instances), len(p.Stranded()))
+
+	return sb.String()
+}
+
+// Plan reports the impact of replacing the definition of every instance by the one created by definition,
+// without changing anything, see Apply
+func (m *Manager) Plan(definition func() *StateMachine) Plan {
+	next := definition()
+	nextEdges := edgeSet(next)
+
+	added := map[State]bool{}
+	removed := map[State]bool{}
+	addedEdges := map[Edge]bool{}
+	removedEdges := map[Edge]bool{}
+
+	plan := Plan{definition: definition}
+	m.each(func(id string, sm *StateMachine) {
+		for _, state := range sm.States() {
+			if _, ok := next.states[state]; !ok {
+				removed[state] = true
+			}
+		}
+		for _, state := range next.States() {
+			if _, ok := sm.states[state]; !ok {
+				added[state] = true
+			}
+		}
+
+		edges := edgeSet(sm)
+		for e := range edges {
+			if !nextEdges[e] {
+				removedEdges[e] = true
+			}
+		}
+		for e := range nextEdges {
+			if !edges[e] {
+				addedEdges[e] = true
+			}
+		}
+
+		impact := planInstance(id, sm, next)
+		if impact.Stranded || len(impact.Lost) > 0 || len(impact.Guarded) > 0 {
+			plan.Instances = append(plan.Instances, impact)
+		}
+	})
+
+	plan.AddedStates = sortedStateSet(added)
+	plan.RemovedStates = sortedStateSet(removed)
+	plan.AddedEdges = sortedEdgeSet(addedEdges)
+	plan.RemovedEdges = sortedEdgeSet(removedEdges)
+
+	return plan
+}
+
+// Apply replaces the definition of every instance by the one the plan was made for, keeping the state and the
+// history of the instances
+// It fails without changing anything if the plan strands instances or if the instances changed since planning,
+// transitions done while applying are not detected, so plans should be applied while the instances are idle
+func (m *Manager) Apply(plan Plan) error {
+	if plan.definition == nil {
+		return fmt.Errorf("plan has no definition, it must be made by Plan")
+	}
+
+	if len(plan.Stranded()) > 0 {
+		return fmt.Errorf("instances: %v, %w", plan.Stranded(), InstancesStranded)
+	}
+
+	current := m.Plan(plan.definition)
+	if !reflect.DeepEqual(current.Instances, plan.Instances) {
+		return PlanStale
+	}
+
+	m.mu.RLock()
+	instances := make(map[string]*instance, len(m.instances))
+	for id, inst := range m.instances {
+		instances[id] = inst
+	}
+	m.mu.RUnlock()
+
+	for _, inst := range instances {
+		inst.mu.Lock()
+		inst.redefine(plan.definition())
+		inst.mu.Unlock()
+	}
+
+	return nil
+}
+
+// redefine replaces the StateMachine of an instance by one of another definition, keeping its state, history and
+// metadata,
+// inst.mu must be held
+func (inst *instance) redefine(sm *StateMachine) {
+	sm.state = inst.sm.state
+	sm.history = inst.sm.history
+	sm.metadata = inst.sm.metadata
+	inst.sm = sm
+	inst.reject.Store(sm.concurrency == RejectConcurrent)
+}
+
+// planInstance describes how replacing the definition of an instance affects it
+func planInstance(id string, sm, next *StateMachine) InstanceImpact {
+	impact := InstanceImpact{ID: id, State: sm.State()}
+
+	if _, ok := next.states[sm.State()]; !ok {
+		impact.Stranded = true
+
+		return impact
+	}
+
+	for _, to := range sm.Targets(sm.State()) {
+		rules := next.edgeRules(sm.State(), to)
+		switch {
+		case len(rules) == 0:
+			impact.Lost = append(impact.Lost, to)
+		case guarded(rules) && !guarded(sm.edgeRules(sm.State(), to)):
+			impact.Guarded = append(impact.Guarded, to)
+		}
+	}
+
+	return impact
+}
+
+// edgeSet returns the edges of a StateMachine
+func edgeSet(sm *StateMachine) map[Edge]bool {
+	edges := map[Edge]bool{}
+	for _, from := range sm.States() {
+		for _, to := range sm.Targets(from) {
+			edges[Edge{From: from, To: to}] = true
+		}
+	}
+
+	return edges
+}
+
+// sortedStateSet returns the states of a set in alphabetical order
+func sortedStateSet(set map[State]bool) []State {
+	states := make([]State, 0, len(set))
+	for state := range set {
+		states = append(states, state)
+	}
+
+	sortStates(states)
+
+	return states
+}
+
+// sortedEdgeSet returns the edges of a set ordered by start state, then by end state
+func sortedEdgeSet(set map[Edge]bool) []Edge {
+	edges := make([]Edge, 0, len(set))
+	for e := range set {
+		edges = append(edges, e)
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+
+		return edges[i].To < edges[j].To
+	})
+
+	return edges
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ProductState returns the name of the state of a product machine combining a state of each component
+func ProductState(a, b State) State {
+	return State(fmt.Sprintf("(%v, %v)", a, b))
+}
+
+// ProductTransitionRule allows a transition of a product machine if both components allow their part of it
+type ProductTransitionRule struct {
+	from  State
+	to    State
+	a     *StateMachine
+	b     *StateMachine
+	fromA State
+	fromB State
+	toA   State
+	toB   State
+}
+
+// From retrieves the start state the transition rule applies to
+func (r *ProductTransitionRule) From() State {
+	return r.from
+}
+
+// To retrieves the end state the transition rule applies to
+func (r *ProductTransitionRule) To() State {
+	return r.to
+}
+
+// Valid is true if transitioning between two states is allowed
+// The params are passed to the guards of both components
+func (r *ProductTransitionRule) Valid(from, to State, params ...interface{}) bool {
+	if from != r.from || to != r.to {
+		return false
+	}
+
+	return componentAllows(r.a, r.fromA, r.toA, params...) && componentAllows(r.b, r.fromB, r.toB, params...)
+}
+
+// componentAllows is true if a component of a product machine allows transitioning between two of its states
+// Staying in a state is always allowed, just like transitioning a StateMachine into its current state
+func componentAllows(sm *StateMachine, from, to State, params ...interface{}) bool {
+	return from == to || sm.allowed(from, to, params...)
+}
+
+// Product builds the synchronized product of two StateMachines, e.g. to verify a controller against a model of
+// its environment
+// The states of the product are the pairs of component states named by ProductState, it starts in the pair of the
+// current states of the components. A transition between two pairs is allowed if both components allow their part
+// of it, a component staying in its state always allows its part
+// The components are only used for evaluating guards, they are never transitioned
+func Product(a, b *StateMachine) *StateMachine {
+	var states []State
+	for _, sa := range a.States() {
+		for _, sb := range b.States() {
+			states = append(states, ProductState(sa, sb))
+		}
+	}
+
+	product := NewStateMachine(ProductState(a.State(), b.State()), states...)
+
+	for _, fromA := range a.States() {
+		for _, fromB := range b.States() {
+			for _, toA := range append([]State{fromA}, a.Targets(fromA)...) {
+				for _, toB := range append([]State{fromB}, b.Targets(fromB)...) {
+					if fromA == toA && fromB == toB {
+						continue
+					}
+
+					_ = product.AddRule(&ProductTransitionRule{
+						from:  ProductState(fromA, fromB),
+						to:    ProductState(toA, toB),
+						a:     a,
+						b:     b,
+						fromA: fromA,
+						fromB: fromB,
+						toA:   toA,
+						toB:   toB,
+					})
+				}
+			}
+		}
+	}
+
+	return product
+}
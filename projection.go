@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Projection is a read model kept up to date by the transition events of the instances of a Manager,
+// e.g. a reporting table of current states or a search index
+// Events of an instance are projected in order, events of different instances may be projected concurrently
+type Projection interface {
+	Project(id string, event TransitionEvent) error
+	Reset() error
+}
+
+// AddProjection feeds the events recorded by transitions done through the Manager from now on to the projection,
+// see RebuildProjection for catching up with the events recorded earlier
+func (m *Manager) AddProjection(projection Projection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.projections = append(m.projections, projection)
+}
+
+// RebuildProjection resets the projection and replays the histories of every instance into it, ordered by time
+// Transitions done while rebuilding may be projected twice, so projections should be rebuilt while idle
+func (m *Manager) RebuildProjection(projection Projection) error {
+	err := projection.Reset()
+	if err != nil {
+		return fmt.Errorf("resetting projection: %w", err)
+	}
+
+	type recorded struct {
+		id    string
+		event TransitionEvent
+	}
+
+	var events []recorded
+	m.each(func(id string, sm *StateMachine) {
+		for _, event := range sm.history {
+			events = append(events, recorded{id: id, event: event})
+		}
+	})
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].event.At.Before(events[j].event.At)
+	})
+
+	for _, r := range events {
+		err = projection.Project(r.id, r.event)
+		if err != nil {
+			return fmt.Errorf("instance: %v, %w", r.id, err)
+		}
+	}
+
+	return nil
+}
+
+// project feeds newly recorded events of an instance to every projection, inst.mu must be held
+func (m *Manager) project(id string, events []TransitionEvent) error {
+	m.mu.RLock()
+	projections := m.projections
+	m.mu.RUnlock()
+
+	var errs []error
+	for _, projection := range projections {
+		for _, event := range events {
+			err := projection.Project(id, event)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("instance: %v, %w", id, err))
+
+				break
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CurrentStates is a Projection of the state each instance transitioned into last
+type CurrentStates struct {
+	mu     sync.RWMutex
+	states map[string]State
+}
+
+// NewCurrentStates creates a new CurrentStates projection
+func NewCurrentStates() *CurrentStates {
+	return &CurrentStates{
+		states: map[string]State{},
+	}
+}
+
+// Project records the end state of allowed transitions
+func (p *CurrentStates) Project(id string, event TransitionEvent) error {
+	if event.Result != Allowed {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.states[id] = event.To
+
+	return nil
+}
+
+// Reset forgets every state
+func (p *CurrentStates) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.states = map[string]State{}
+
+	return nil
+}
+
+// State returns the state the instance with the given ID transitioned into last,
+// it is false if the instance did not transition yet
+func (p *CurrentStates) State(id string) (State, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	state, ok := p.states[id]
+
+	return state, ok
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Names of the metrics written by WritePrometheus, every metric carries the name of the machine as label
+const (
+	// MetricInstances is a gauge of the number of instances per state
+	MetricInstances = "statemachine_instances"
+	// MetricTransitions is a counter of the allowed transitions per edge recorded in the histories of the instances
+	MetricTransitions = "statemachine_transitions_total"
+	// MetricDwell is a summary of the time instances spent in the states they left, in seconds
+	MetricDwell = "statemachine_dwell_seconds"
+	// MetricStateSeconds is a counter of the total time instances spent in each state, including their current stays
+	MetricStateSeconds = "statemachine_state_seconds_total"
+)
+
+// WritePrometheus writes the metrics of the Manager in the Prometheus text exposition format
+// machine labels the metrics, so the instances of several definitions can be told apart
+func (m *Manager) WritePrometheus(w io.Writer, machine string) error {
+	bw := bufio.NewWriter(w)
+
+	counts := m.Counts()
+	_, _ = fmt.Fprintf(bw, "# HELP %s Number of instances in each state.\n# TYPE %s gauge\n", MetricInstances, MetricInstances)
+	states := map[State]bool{}
+	for state := range counts {
+		states[state] = true
+	}
+	for _, state := range sortedStateSet(states) {
+		_, _ = fmt.Fprintf(bw, "%s{machine=%q,state=%q} %d\n", MetricInstances, machine, state, counts[state])
+	}
+
+	transitions := map[Edge]int{}
+	m.each(func(id string, sm *StateMachine) {
+		for _, event := range sm.history {
+			if event.Result == Allowed {
+				transitions[Edge{From: event.From, To: event.To}]++
+			}
+		}
+	})
+
+	_, _ = fmt.Fprintf(bw, "# HELP %s Number of allowed transitions between two states.\n# TYPE %s counter\n", MetricTransitions, MetricTransitions)
+	for _, e := range sortedEdgeSet(edgeKeys(transitions)) {
+		_, _ = fmt.Fprintf(bw, "%s{machine=%q,from=%q,to=%q} %d\n", MetricTransitions, machine, e.From, e.To, transitions[e])
+	}
+
+	dwell := m.DwellTimes()
+	_, _ = fmt.Fprintf(bw, "# HELP %s Time spent in a state before leaving it.\n# TYPE %s summary\n", MetricDwell, MetricDwell)
+	states = map[State]bool{}
+	for state := range dwell {
+		states[state] = true
+	}
+	for _, state := range sortedStateSet(states) {
+		stats := dwell[state]
+		for _, q := range []struct {
+			quantile string
+			value    time.Duration
+		}{{"0.5", stats.P50}, {"0.9", stats.P90}, {"0.99", stats.P99}} {
+			_, _ = fmt.Fprintf(bw, "%s{machine=%q,state=%q,quantile=%q} %g\n", MetricDwell, machine, state, q.quantile, q.value.Seconds())
+		}
+		_, _ = fmt.Fprintf(bw, "%s_count{machine=%q,state=%q} %d\n", MetricDwell, machine, state, stats.Count)
+	}
+
+	totals := m.StateTotals()
+	_, _ = fmt.Fprintf(bw, "# HELP %s Total time spent in a state.\n# TYPE %s counter\n", MetricStateSeconds, MetricStateSeconds)
+	states = map[State]bool{}
+	for state := range totals {
+		states[state] = true
+	}
+	for _, state := range sortedStateSet(states) {
+		_, _ = fmt.Fprintf(bw, "%s{machine=%q,state=%q} %g\n", MetricStateSeconds, machine, state, totals[state].Seconds())
+	}
+
+	return bw.Flush()
+}
+
+// PrometheusHandler serves the metrics of the Manager for Prometheus to scrape, see WritePrometheus
+func (m *Manager) PrometheusHandler(machine string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		err := m.WritePrometheus(w, machine)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// edgeKeys returns the set of edges of a map
+func edgeKeys(values map[Edge]int) map[Edge]bool {
+	edges := make(map[Edge]bool, len(values))
+	for e := range values {
+		edges[e] = true
+	}
+
+	return edges
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// wire types of the protocol buffers encoding
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoWriter encodes the fields of a protocol buffers message
+type protoWriter struct {
+	buf []byte
+}
+
+// varint writes a varint field, zero values are omitted like in proto3
+func (w *protoWriter) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|protoVarint))
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+// string writes a singular string field, empty strings are omitted like in proto3
+func (w *protoWriter) string(field int, s string) {
+	if s == "" {
+		return
+	}
+
+	w.bytes(field, []byte(s))
+}
+
+// bytes writes a length-delimited field, e.g. an element of a repeated field or an embedded message
+func (w *protoWriter) bytes(field int, b []byte) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|protoBytes))
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// protoValue is the value of a decoded field, fixed-size values are stored in varint
+type protoValue struct {
+	varint uint64
+	bytes  []byte
+}
+
+// protoFields decodes the fields of a protocol buffers message and calls fn with each of them in order
+func protoFields(data []byte, fn func(field int, value protoValue) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("decoding protobuf: invalid field key")
+		}
+		data = data[n:]
+
+		var value protoValue
+		switch key & 7 {
+		case protoVarint:
+			value.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("decoding protobuf: invalid varint")
+			}
+		case protoFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("decoding protobuf: truncated fixed64")
+			}
+			value.varint, n = binary.LittleEndian.Uint64(data), 8
+		case protoFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("decoding protobuf: truncated fixed32")
+			}
+			value.varint, n = uint64(binary.LittleEndian.Uint32(data)), 4
+		case protoBytes:
+			length, m := binary.Uvarint(data)
+			if m <= 0 || uint64(len(data)-m) < length {
+				return fmt.Errorf("decoding protobuf: truncated field")
+			}
+			value.bytes, n = data[m:m+int(length)], m+int(length)
+		default:
+			return fmt.Errorf("decoding protobuf: unsupported wire type %d", key&7)
+		}
+		data = data[n:]
+
+		err := fn(int(key>>3), value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarshalEventProto encodes a TransitionEvent as the TransitionEvent message of statemachine.proto
+// Params are encoded as JSON, so they must be JSON serializable
+func MarshalEventProto(event TransitionEvent) ([]byte, error) {
+	w := protoWriter{}
+	w.string(1, string(event.From))
+	w.string(2, string(event.To))
+
+	for _, param := range event.Params {
+		encoded, err := json.Marshal(param)
+		if err != nil {
+			return nil, fmt.Errorf("encoding param: %w", err)
+		}
+
+		w.bytes(3, encoded)
+	}
+
+	if !event.At.IsZero() {
+		w.varint(4, uint64(event.At.UnixNano()))
+	}
+
+	if event.Result == Rejected {
+		w.varint(5, 1)
+	}
+
+	if event.Event != "" {
+		w.string(6, string(event.Event))
+	}
+
+	if event.Requested != "" {
+		w.string(7, string(event.Requested))
+	}
+
+	return w.buf, nil
+}
+
+// UnmarshalEventProto decodes a TransitionEvent message
+// Whole numbers in params are decoded as int, other numbers as float64, like in traces
+func UnmarshalEventProto(data []byte) (TransitionEvent, error) {
+	event := TransitionEvent{Result: Allowed}
+	err := protoFields(data, func(field int, value protoValue) error {
+		switch field {
+		case 1:
+			event.From = State(value.bytes)
+		case 2:
+			event.To = State(value.bytes)
+		case 3:
+			decoder := json.NewDecoder(bytes.NewReader(value.bytes))
+			decoder.UseNumber()
+
+			var param interface{}
+			err := decoder.Decode(&param)
+			if err != nil {
+				return fmt.Errorf("decoding param: %w", err)
+			}
+
+			event.Params = append(event.Params, jsonParam(param))
+		case 4:
+			event.At = time.Unix(0, int64(value.varint))
+		case 5:
+			if value.varint == 1 {
+				event.Result = Rejected
+			}
+		case 6:
+			event.Event = Event(value.bytes)
+		case 7:
+			event.Requested = State(value.bytes)
+		}
+
+		return nil
+	})
+
+	return event, err
+}
+
+// MarshalDefinitionProto encodes the structure of a StateMachine as the Definition message of statemachine.proto,
+// starting from its current state
+// Guards and actions are code, so only whether an edge is guarded is encoded
+func MarshalDefinitionProto(sm *StateMachine) []byte {
+	w := protoWriter{}
+	w.string(1, string(sm.State()))
+
+	for _, state := range sm.States() {
+		s := protoWriter{}
+		s.string(1, string(state))
+		s.string(2, sm.Description(state))
+		for _, tag := range sm.Tags(state) {
+			s.bytes(3, []byte(tag))
+		}
+
+		w.bytes(2, s.buf)
+	}
+
+	for _, from := range sm.States() {
+		for _, to := range sm.Targets(from) {
+			e := protoWriter{}
+			e.string(1, string(from))
+			e.string(2, string(to))
+			if guarded(sm.edgeRules(from, to)) {
+				e.varint(3, 1)
+			}
+
+			w.bytes(3, e.buf)
+		}
+	}
+
+	triggers := make([]trigger, 0, len(sm.events))
+	for t := range sm.events {
+		triggers = append(triggers, t)
+	}
+
+	sort.Slice(triggers, func(i, j int) bool {
+		if triggers[i].event != triggers[j].event {
+			return triggers[i].event < triggers[j].event
+		}
+
+		return triggers[i].from < triggers[j].from
+	})
+
+	for _, t := range triggers {
+		e := protoWriter{}
+		e.string(1, string(t.event))
+		e.string(2, string(t.from))
+		e.string(3, string(sm.events[t]))
+
+		w.bytes(4, e.buf)
+	}
+
+	return w.buf
+}
+
+// UnmarshalDefinitionProto decodes a Definition message into a new StateMachine
+// Unguarded edges get a SimpleTransitionRule, the rules of guarded edges are created by rule,
+// decoding fails if rule is nil or returns nil for a guarded edge
+func UnmarshalDefinitionProto(data []byte, rule func(from, to State) TransitionRule) (*StateMachine, error) {
+	type stateDefinition struct {
+		name        State
+		description string
+		tags        []string
+	}
+
+	type edgeDefinition struct {
+		from    State
+		to      State
+		guarded bool
+	}
+
+	var initial State
+	var states []stateDefinition
+	var edges []edgeDefinition
+	var events [][3]string
+
+	err := protoFields(data, func(field int, value protoValue) error {
+		switch field {
+		case 1:
+			initial = State(value.bytes)
+		case 2:
+			s := stateDefinition{}
+			err := protoFields(value.bytes, func(field int, value protoValue) error {
+				switch field {
+				case 1:
+					s.name = State(value.bytes)
+				case 2:
+					s.description = string(value.bytes)
+				case 3:
+					s.tags = append(s.tags, string(value.bytes))
+				}
+
+				return nil
+			})
+			states = append(states, s)
+
+			return err
+		case 3:
+			e := edgeDefinition{}
+			err := protoFields(value.bytes, func(field int, value protoValue) error {
+				switch field {
+				case 1:
+					e.from = State(value.bytes)
+				case 2:
+					e.to = State(value.bytes)
+				case 3:
+					e.guarded = value.varint != 0
+				}
+
+				return nil
+			})
+			edges = append(edges, e)
+
+			return err
+		case 4:
+			var e [3]string
+			err := protoFields(value.bytes, func(field int, value protoValue) error {
+				if field >= 1 && field <= 3 {
+					e[field-1] = string(value.bytes)
+				}
+
+				return nil
+			})
+			events = append(events, e)
+
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]State, 0, len(states))
+	for _, s := range states {
+		names = append(names, s.name)
+	}
+
+	sm := NewStateMachine(initial, names...)
+	for _, s := range states {
+		if s.description != "" {
+			_ = sm.DescribeState(s.name, s.description)
+		}
+		if len(s.tags) > 0 {
+			_ = sm.TagState(s.name, s.tags...)
+		}
+	}
+
+	for _, e := range edges {
+		var r TransitionRule = NewSimpleTransitionRule(e.from, e.to)
+		if e.guarded {
+			if rule != nil {
+				r = rule(e.from, e.to)
+			}
+			if rule == nil || r == nil {
+				return nil, fmt.Errorf("edge: %v -> %v, no rule for guarded edge", e.from, e.to)
+			}
+		}
+
+		err = sm.AddRule(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range events {
+		err = sm.AddEvent(Event(e[0]), State(e[1]), State(e[2]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sm, nil
+}
+
+// MarshalInstanceProto encodes a StateMachine managed under an ID as the Instance message of statemachine.proto
+// Metadata values are encoded as JSON, so they must be JSON serializable
+func MarshalInstanceProto(id string, sm *StateMachine) ([]byte, error) {
+	w := protoWriter{}
+	w.string(1, id)
+	w.string(2, string(sm.State()))
+
+	for _, event := range sm.history {
+		encoded, err := MarshalEventProto(event)
+		if err != nil {
+			return nil, err
+		}
+
+		w.bytes(3, encoded)
+	}
+
+	keys := make([]string, 0, len(sm.metadata))
+	for key := range sm.metadata {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		encoded, err := json.Marshal(sm.metadata[key])
+		if err != nil {
+			return nil, fmt.Errorf("encoding metadata: %v, %w", key, err)
+		}
+
+		entry := protoWriter{}
+		entry.string(1, key)
+		entry.bytes(2, encoded)
+		w.bytes(4, entry.buf)
+	}
+
+	return w.buf, nil
+}
+
+// UnmarshalInstanceProto decodes an Instance message, restoring its state and history into a StateMachine
+// created by definition
+func UnmarshalInstanceProto(data []byte, definition func() *StateMachine) (string, *StateMachine, error) {
+	var id string
+	var state State
+	var history []TransitionEvent
+	var metadata Metadata
+
+	err := protoFields(data, func(field int, value protoValue) error {
+		switch field {
+		case 1:
+			id = string(value.bytes)
+		case 2:
+			state = State(value.bytes)
+		case 3:
+			event, err := UnmarshalEventProto(value.bytes)
+			if err != nil {
+				return err
+			}
+
+			history = append(history, event)
+		case 4:
+			key, value, err := unmarshalMetadataEntry(value.bytes)
+			if err != nil {
+				return err
+			}
+
+			if metadata == nil {
+				metadata = Metadata{}
+			}
+
+			metadata[key] = value
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	sm := definition()
+	_, ok := sm.states[state]
+	if !ok {
+		return "", nil, fmt.Errorf("instance: %v, state: %v, %w", id, state, StateNotFound)
+	}
+
+	sm.state = state
+	sm.history = history
+	sm.metadata = metadata
+
+	return id, sm, nil
+}
+
+// unmarshalMetadataEntry decodes an entry of the metadata map of an Instance message, whole numbers are decoded as
+// int, like in Metadata
+func unmarshalMetadataEntry(data []byte) (string, interface{}, error) {
+	var key string
+	var encoded []byte
+	err := protoFields(data, func(field int, value protoValue) error {
+		switch field {
+		case 1:
+			key = string(value.bytes)
+		case 2:
+			encoded = value.bytes
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return "", nil, fmt.Errorf("decoding metadata: %v, %w", key, err)
+	}
+
+	return key, jsonValue(value), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Query selects instances of a Manager, zero values match every instance
+type Query struct {
+	State State
+	Tag   string
+	// OlderThan matches instances which entered their current state before the given time
+	OlderThan time.Time
+	// Metadata matches instances having every given metadata value
+	Metadata Metadata
+}
+
+// BroadcastSummary describes the outcome of a Broadcast
+type BroadcastSummary struct {
+	Transitioned []string
+	Rejected     map[string]error
+}
+
+// TagInstance adds tags to the instance with the given ID, e.g. "vip"
+func (m *Manager) TagInstance(id string, tags ...string) error {
+	inst, err := m.instance(id)
+	if err != nil {
+		return err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tag := range tags {
+		if inst.hasTag(tag) {
+			continue
+		}
+
+		inst.tags = append(inst.tags, tag)
+
+		if m.byTag[tag] == nil {
+			m.byTag[tag] = map[string]bool{}
+		}
+		m.byTag[tag][id] = true
+	}
+
+	return nil
+}
+
+// InstanceTags returns the tags of the instance with the given ID
+func (m *Manager) InstanceTags(id string) ([]string, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return nil, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return append([]string(nil), inst.tags...), nil
+}
+
+// hasTag is true if the instance is tagged with tag, inst.mu must be held
+func (inst *instance) hasTag(tag string) bool {
+	for _, t := range inst.tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// entered returns when the instance entered its current state, inst.mu must be held
+// Instances which never transitioned entered their state when they were added to the Manager
+func (inst *instance) entered() time.Time {
+	return inst.sm.enteredSince(inst.added)
+}
+
+// matches is true if the instance is selected by the query, inst.mu must be held
+func (q Query) matches(inst *instance) bool {
+	switch {
+	case q.State != "" && inst.sm.State() != q.State:
+		return false
+	case q.Tag != "" && !inst.hasTag(q.Tag):
+		return false
+	case !q.OlderThan.IsZero() && !inst.entered().Before(q.OlderThan):
+		return false
+	case !q.matchesMetadata(inst):
+		return false
+	}
+
+	return true
+}
+
+// Find returns the IDs of the instances selected by the query in alphabetical order
+// Queries for a state or a tag only look at the instances in the state or tag index instead of scanning every instance
+func (m *Manager) Find(query Query) []string {
+	var found []string
+	for _, id := range m.candidates(query) {
+		inst, err := m.instance(id)
+		if err != nil {
+			continue
+		}
+
+		inst.mu.Lock()
+		if query.matches(inst) {
+			found = append(found, id)
+		}
+		inst.mu.Unlock()
+	}
+
+	return found
+}
+
+// candidates returns the IDs of the instances which may be selected by the query in alphabetical order,
+// narrowed down by the smallest matching index of the Manager
+func (m *Manager) candidates(query Query) []string {
+	if query.State == "" && query.Tag == "" {
+		return m.IDs()
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var index map[string]bool
+	switch {
+	case query.Tag == "":
+		index = m.byState[query.State]
+	case query.State == "" || len(m.byTag[query.Tag]) < len(m.byState[query.State]):
+		index = m.byTag[query.Tag]
+	default:
+		index = m.byState[query.State]
+	}
+
+	ids := make([]string, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Broadcast fires the event on every instance selected by the query, e.g. to expire every instance
+// pending for more than 30 days, and returns which instances transitioned and which ones rejected the event
+func (m *Manager) Broadcast(event Event, query Query, params ...interface{}) BroadcastSummary {
+	summary := BroadcastSummary{Rejected: map[string]error{}}
+
+	for _, id := range m.Find(query) {
+		err := m.Fire(id, event, params...)
+		if err != nil {
+			summary.Rejected[id] = err
+
+			continue
+		}
+
+		summary.Transitioned = append(summary.Transitioned, id)
+	}
+
+	return summary
+}
+
+// String returns a one line summary of the broadcast
+func (s BroadcastSummary) String() string {
+	return fmt.Sprintf("%d transitioned, %d rejected", len(s.Transitioned), len(s.Rejected))
+}
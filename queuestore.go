@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueuedEvent is an event queued in a Mailbox, persisted until it was processed
+type QueuedEvent struct {
+	Seq      uint64        `json:"seq"`
+	Event    Event         `json:"event"`
+	Priority Priority      `json:"priority"`
+	Params   []interface{} `json:"params,omitempty"`
+	Ready    time.Time     `json:"ready"`
+}
+
+// QueueStore persists the queued events of a Mailbox
+type QueueStore interface {
+	SaveEvent(event QueuedEvent) error
+	DeleteEvent(seq uint64) error
+	Events() ([]QueuedEvent, error)
+}
+
+// MemoryQueueStore is a QueueStore keeping events in memory, it does not survive restarts on its own
+type MemoryQueueStore struct {
+	mu     sync.Mutex
+	events map[uint64]QueuedEvent
+}
+
+// NewMemoryQueueStore creates a new MemoryQueueStore
+func NewMemoryQueueStore() *MemoryQueueStore {
+	return &MemoryQueueStore{
+		events: map[uint64]QueuedEvent{},
+	}
+}
+
+// SaveEvent adds or replaces an event
+func (s *MemoryQueueStore) SaveEvent(event QueuedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events[event.Seq] = event
+
+	return nil
+}
+
+// DeleteEvent removes an event, removing a missing event is not an error
+func (s *MemoryQueueStore) DeleteEvent(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, seq)
+
+	return nil
+}
+
+// Events returns every event in the order they were queued
+func (s *MemoryQueueStore) Events() ([]QueuedEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]QueuedEvent, 0, len(s.events))
+	for _, event := range s.events {
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq < events[j].Seq
+	})
+
+	return events, nil
+}
+
+// SetQueueStore makes the Mailbox durable: queued events are saved to store and deleted once they were processed,
+// and the events found in store are queued again, e.g. the ones a crashed process did not get to
+// An event is only deleted after firing it, so an event may be fired again if the process crashes in between
+// Restored events have no caller waiting for their result, it must be called before posting events
+func (mb *Mailbox) SetQueueStore(store QueueStore) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	events, err := store.Events()
+	if err != nil {
+		return fmt.Errorf("loading queued events: %w", err)
+	}
+
+	mb.store = store
+	mb.restore(events)
+
+	return nil
+}
+
+// restore queues events again, mb.mu must be held
+func (mb *Mailbox) restore(events []QueuedEvent) {
+	for _, event := range events {
+		if event.Seq > mb.seq {
+			mb.seq = event.Seq
+		}
+
+		mb.queues[event.Priority] = append(mb.queues[event.Priority], message{
+			event:    event.Event,
+			params:   event.Params,
+			results:  []chan error{make(chan error, 1)},
+			ready:    event.Ready,
+			seq:      event.Seq,
+			priority: event.Priority,
+		})
+	}
+
+	select {
+	case mb.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queued returns the queued events in the order they were queued
+func (mb *Mailbox) queued() []QueuedEvent {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	var events []QueuedEvent
+	for _, queue := range mb.queues {
+		for _, msg := range queue {
+			events = append(events, QueuedEvent{Seq: msg.seq, Event: msg.event, Priority: msg.priority, Params: msg.params, Ready: msg.ready})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq < events[j].Seq
+	})
+
+	return events
+}
+
+// persist saves a queued event to the QueueStore, if there is one, mb.mu must be held
+func (mb *Mailbox) persist(msg message) error {
+	if mb.store == nil {
+		return nil
+	}
+
+	return mb.store.SaveEvent(QueuedEvent{
+		Seq:      msg.seq,
+		Event:    msg.event,
+		Priority: msg.priority,
+		Params:   msg.params,
+		Ready:    msg.ready,
+	})
+}
+
+// forget deletes a processed or dropped event from the QueueStore, if there is one, mb.mu must be held
+func (mb *Mailbox) forget(msg message) error {
+	if mb.store == nil {
+		return nil
+	}
+
+	err := mb.store.DeleteEvent(msg.seq)
+	if err != nil {
+		return fmt.Errorf("event: %v, %w", msg.event, err)
+	}
+
+	return nil
+}
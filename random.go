@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedSource is a rand.Source which is safe for concurrent use
+type lockedSource struct {
+	mu     sync.Mutex
+	source rand.Source
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.source.Int63()
+}
+
+// Seed initializes the source to a deterministic state
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source.Seed(seed)
+}
+
+// newRand creates a rand.Rand drawing from source, safe for concurrent use
+// A nil source is seeded by the current time, so only injected sources make the results reproducible
+func newRand(source rand.Source) *rand.Rand {
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+
+	return rand.New(&lockedSource{source: source})
+}
+
+// ProbabilityGuard creates a condition for a ConditionalTransitionRule which is met with probability p,
+// e.g. for sampling instances into a manual review
+// The randomness is drawn from source, so tests and replays injecting a seeded source get the same results
+func ProbabilityGuard(p float64, source rand.Source) func(params ...interface{}) bool {
+	r := newRand(source)
+
+	return func(params ...interface{}) bool {
+		return r.Float64() < p
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// stateRename is the renaming of a state
+type stateRename struct {
+	old     State
+	renamed State
+}
+
+// renamedRule is a rule whose states were renamed, it translates the new name back for the rule it wraps
+type renamedRule struct {
+	TransitionRule
+	stateRename
+}
+
+// From retrieves the start state the transition rule applies to
+func (r *renamedRule) From() State {
+	return r.rename(r.TransitionRule.From())
+}
+
+// To retrieves the end state the transition rule applies to
+func (r *renamedRule) To() State {
+	return r.rename(r.TransitionRule.To())
+}
+
+// Valid is true if the wrapped rule allows transitioning between the states under their old names
+func (r *renamedRule) Valid(from, to State, params ...interface{}) bool {
+	return r.TransitionRule.Valid(r.restore(from), r.restore(to), params...)
+}
+
+// ValidIn passes the view of the StateMachine to the wrapped rule if it is a ViewRule, see Valid
+func (r *renamedRule) ValidIn(view MachineView, from, to State, params ...interface{}) bool {
+	viewRule, ok := r.TransitionRule.(ViewRule)
+	if !ok {
+		return r.Valid(from, to, params...)
+	}
+
+	return viewRule.ValidIn(view, r.restore(from), r.restore(to), params...)
+}
+
+// renamedInjectableRule is a renamed rule depending on services of a Container
+type renamedInjectableRule struct {
+	*renamedRule
+	injectable Injectable
+}
+
+// Dependencies returns the dependencies of the wrapped rule
+func (r *renamedInjectableRule) Dependencies() []string {
+	return r.injectable.Dependencies()
+}
+
+// Inject injects the services into the wrapped rule
+func (r *renamedInjectableRule) Inject(services map[string]interface{}) {
+	r.injectable.Inject(services)
+}
+
+// rename returns the new name of a state
+func (r stateRename) rename(state State) State {
+	if state == r.old {
+		return r.renamed
+	}
+
+	return state
+}
+
+// restore returns the old name of a state
+func (r stateRename) restore(state State) State {
+	if state == r.renamed {
+		return r.old
+	}
+
+	return state
+}
+
+// RenameState renames a state before finalization, rewriting the rules, events, actions, entry actions,
+// entry limits, throttling, calendars, match strategies, descriptions and tags referencing it
+// It returns the mapping of every state to its new name, which Migrate takes to move the persisted instances of the
+// previous definition version, as they can not be restored into a state which no longer exists
+func (sm *StateMachine) RenameState(old, renamed State) (map[State]State, error) {
+	if sm.final {
+		return nil, fmt.Errorf("states must be defined before finalization")
+	}
+
+	_, ok := sm.states[old]
+	if !ok {
+		return nil, fmt.Errorf("state: %v, %w", old, StateNotFound)
+	}
+
+	_, ok = sm.states[renamed]
+	if ok {
+		return nil, fmt.Errorf("state %v is already defined", renamed)
+	}
+
+	r := stateRename{old: old, renamed: renamed}
+	rename := r.rename
+
+	mapping := make(map[State]State, len(sm.states))
+	for state := range sm.states {
+		mapping[state] = rename(state)
+	}
+
+	sm.rulesMu.Lock()
+	current := sm.Rules()
+	rules := make([]TransitionRule, len(current))
+	for i, rule := range current {
+		rules[i] = renameRule(rule, r)
+	}
+	for name, rule := range sm.ruleNames {
+		for i := range current {
+			if sameRule(current[i], rule) {
+				sm.ruleNames[name] = rules[i]
+			}
+		}
+	}
+	sm.storeRules(rules)
+	sm.rulesMu.Unlock()
+
+	delete(sm.states, old)
+	sm.states[renamed] = renamed
+	sm.state = rename(sm.state)
+
+	events := make(map[trigger]State, len(sm.events))
+	for t, to := range sm.events {
+		events[trigger{event: t.event, from: rename(t.from)}] = rename(to)
+	}
+	sm.events = events
+
+	if sm.choices != nil {
+		choices := make(map[trigger][]Choice, len(sm.choices))
+		for t, c := range sm.choices {
+			renamedChoices := make([]Choice, len(c))
+			for i, choice := range c {
+				renamedChoices[i] = Choice{To: rename(choice.To), Guard: choice.Guard}
+			}
+
+			choices[trigger{event: t.event, from: rename(t.from)}] = renamedChoices
+		}
+		sm.choices = choices
+	}
+
+	if sm.fallbacks != nil {
+		fallbacks := make(map[trigger]State, len(sm.fallbacks))
+		for t, to := range sm.fallbacks {
+			fallbacks[trigger{event: t.event, from: rename(t.from)}] = rename(to)
+		}
+		sm.fallbacks = fallbacks
+	}
+
+	actions := make(map[edge][]Action, len(sm.actions))
+	for e, a := range sm.actions {
+		actions[edge{from: rename(e.from), to: rename(e.to)}] = a
+	}
+	sm.actions = actions
+
+	if entries, ok := sm.entries[old]; ok {
+		delete(sm.entries, old)
+		sm.entries[renamed] = entries
+	}
+
+	limits := make(map[State]entryLimit, len(sm.limits))
+	for state, limit := range sm.limits {
+		limits[rename(state)] = entryLimit{max: limit.max, overflow: rename(limit.overflow)}
+	}
+	sm.limits = limits
+
+	throttles := make(map[edge]time.Duration, len(sm.throttles))
+	for e, interval := range sm.throttles {
+		throttles[edge{from: rename(e.from), to: rename(e.to)}] = interval
+	}
+	sm.throttles = throttles
+
+	calendars := make(map[edge]Calendar, len(sm.calendars))
+	for e, calendar := range sm.calendars {
+		calendars[edge{from: rename(e.from), to: rename(e.to)}] = calendar
+	}
+	sm.calendars = calendars
+
+	strategies := make(map[edge]MatchStrategy, len(sm.edgeStrategies))
+	for e, strategy := range sm.edgeStrategies {
+		strategies[edge{from: rename(e.from), to: rename(e.to)}] = strategy
+	}
+	sm.edgeStrategies = strategies
+
+	if description, ok := sm.descriptions[old]; ok {
+		delete(sm.descriptions, old)
+		sm.descriptions[renamed] = description
+	}
+
+	if tags, ok := sm.tags[old]; ok {
+		delete(sm.tags, old)
+		sm.tags[renamed] = tags
+	}
+
+	return mapping, nil
+}
+
+// renameRule returns a rule like the given one with a state renamed, the rule itself is kept if it does not
+// reference the state
+func renameRule(rule TransitionRule, r stateRename) TransitionRule {
+	if rule.From() != r.old && rule.To() != r.old {
+		return rule
+	}
+
+	switch rule := rule.(type) {
+	case *SimpleTransitionRule:
+		return NewSimpleTransitionRule(r.rename(rule.from), r.rename(rule.to))
+	case *ConditionalTransitionRule:
+		return NewConditionalTransitionRule(r.rename(rule.from), r.rename(rule.to), rule.condition)
+	case *ViewTransitionRule:
+		return NewViewTransitionRule(r.rename(rule.from), r.rename(rule.to), rule.condition)
+	case *PassThroughTransitionRule:
+		return NewPassThroughTransitionRule(renameRule(rule.TransitionRule, r))
+	default:
+		renamed := &renamedRule{TransitionRule: rule, stateRename: r}
+		if injectable, ok := rule.(Injectable); ok {
+			return &renamedInjectableRule{renamedRule: renamed, injectable: injectable}
+		}
+
+		return renamed
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ruleSet is an immutable snapshot of the rules of a StateMachine, indexed by edge
+// It is never modified once stored, changing the rules builds a new ruleSet and swaps it in atomically,
+// so transitions evaluate either the old or the new rules as a whole without taking read locks
+type ruleSet struct {
+	rules  []TransitionRule
+	byEdge map[edge][]TransitionRule
+}
+
+// newRuleSet indexes rules, keeping them in the given order
+func newRuleSet(rules []TransitionRule) *ruleSet {
+	rs := &ruleSet{
+		rules:  rules,
+		byEdge: map[edge][]TransitionRule{},
+	}
+
+	for _, rule := range rules {
+		e := edge{from: rule.From(), to: rule.To()}
+		rs.byEdge[e] = append(rs.byEdge[e], rule)
+	}
+
+	return rs
+}
+
+// loadRules returns the current ruleSet of the StateMachine
+func (sm *StateMachine) loadRules() *ruleSet {
+	return sm.rules.Load()
+}
+
+// storeRules replaces the rules of the StateMachine, sm.rulesMu must be held by concurrent writers
+func (sm *StateMachine) storeRules(rules []TransitionRule) {
+	sm.rules.Store(newRuleSet(rules))
+	sm.coverage.register(sm)
+}
+
+// UpdateRules replaces the rules of the StateMachine by the ones returned by update, even after finalization,
+// e.g. to add or remove rules of a running service without recreating its instances
+// update receives a copy of the current rules, which it may modify and return
+// Transitions in progress keep evaluating the rules they started with, transitions started afterwards see the new
+// rules, concurrent updates are applied one after the other
+// The new rules are validated like by AddRule, nothing changes if any of them is invalid
+func (sm *StateMachine) UpdateRules(update func(rules []TransitionRule) []TransitionRule) error {
+	sm.rulesMu.Lock()
+	defer sm.rulesMu.Unlock()
+
+	current := sm.loadRules()
+	rules := update(append([]TransitionRule(nil), current.rules...))
+
+	var added []Injectable
+	for _, rule := range rules {
+		err := sm.validRule(rule)
+		if err != nil {
+			return err
+		}
+
+		injectable, ok := unwrap(rule).(Injectable)
+		if ok && !current.contains(rule) {
+			added = append(added, injectable)
+		}
+	}
+
+	for _, injectable := range added {
+		err := sm.container.inject(injectable)
+		if err != nil {
+			return err
+		}
+	}
+
+	sm.storeRules(rules)
+
+	return nil
+}
+
+// validRule checks that both states of a rule exist
+func (sm *StateMachine) validRule(rule TransitionRule) error {
+	_, ok := sm.states[rule.From()]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", rule.From(), StateNotFound)
+	}
+
+	_, ok = sm.states[rule.To()]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", rule.To(), StateNotFound)
+	}
+
+	return nil
+}
+
+// contains is true if the very same rule is part of the ruleSet
+func (rs *ruleSet) contains(rule TransitionRule) bool {
+	for _, r := range rs.byEdge[edge{from: rule.From(), to: rule.To()}] {
+		if sameRule(r, rule) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameRule is true if a and b are the very same rule, rules whose values are not comparable, e.g. structs with func
+// fields, are only the same as themselves if they are pointers
+func sameRule(a, b TransitionRule) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() || !va.Comparable() || !vb.Comparable() {
+		return false
+	}
+
+	return a == b
+}
+
+// AddNamedRule adds a rule like AddRule under a name, so that layered configuration can remove or replace it later
+// without holding on to it, see RemoveNamedRule and ReplaceNamedRule
+func (sm *StateMachine) AddNamedRule(name string, rule TransitionRule) error {
+	_, ok := sm.ruleNames[name]
+	if ok {
+		return fmt.Errorf("rule %v is already defined", name)
+	}
+
+	err := sm.AddRule(rule)
+	if err != nil {
+		return err
+	}
+
+	sm.ruleNames[name] = rule
+
+	return nil
+}
+
+// RemoveRule removes the very same rule added by AddRule or AddNamedRule before finalization
+func (sm *StateMachine) RemoveRule(rule TransitionRule) error {
+	return sm.ReplaceRule(rule, nil)
+}
+
+// RemoveNamedRule removes the rule added under a name before finalization
+func (sm *StateMachine) RemoveNamedRule(name string) error {
+	return sm.ReplaceNamedRule(name, nil)
+}
+
+// ReplaceNamedRule replaces the rule added under a name before finalization, the new rule keeps the name
+func (sm *StateMachine) ReplaceNamedRule(name string, rule TransitionRule) error {
+	old, ok := sm.ruleNames[name]
+	if !ok {
+		return fmt.Errorf("rule: %v, %w", name, RuleNotFound)
+	}
+
+	return sm.ReplaceRule(old, rule)
+}
+
+// ReplaceRule replaces the very same rule added by AddRule or AddNamedRule before finalization, the new rule takes
+// its place in the evaluation order, which matters for FirstMatch, and its name if it has one
+// A nil rule removes the old one
+// Rules are found by identity, rules whose values are not comparable, e.g. structs with func fields, are only found if
+// they were added as pointers
+func (sm *StateMachine) ReplaceRule(old, rule TransitionRule) error {
+	if sm.final {
+		return fmt.Errorf("rules must be defined before finalization")
+	}
+
+	if rule != nil {
+		err := sm.validRule(rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	sm.rulesMu.Lock()
+	defer sm.rulesMu.Unlock()
+
+	rules := sm.Rules()
+	i := -1
+	for j, r := range rules {
+		if sameRule(r, old) {
+			i = j
+
+			break
+		}
+	}
+
+	if i < 0 {
+		return fmt.Errorf("rule: %v -> %v, %w", old.From(), old.To(), RuleNotFound)
+	}
+
+	if rule == nil {
+		rules = append(rules[:i], rules[i+1:]...)
+	} else {
+		injectable, ok := unwrap(rule).(Injectable)
+		if ok {
+			err := sm.container.inject(injectable)
+			if err != nil {
+				return err
+			}
+		}
+
+		rules[i] = rule
+	}
+
+	for name, r := range sm.ruleNames {
+		if !sameRule(r, old) {
+			continue
+		}
+
+		if rule == nil {
+			delete(sm.ruleNames, name)
+		} else {
+			sm.ruleNames[name] = rule
+		}
+	}
+
+	sm.storeRules(rules)
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// scaffold holds everything needed to render the files of a new workflow
+type scaffold struct {
+	Import string
+	Name   string
+}
+
+// scaffoldFile is a file generated by Scaffold, the * of the pattern is replaced with the file name of the workflow
+type scaffoldFile struct {
+	pattern  string
+	template *template.Template
+}
+
+var scaffoldFiles = []scaffoldFile{
+	{"*.go", template.Must(template.New("definition").Parse(`package main
+
+import (
+	statemachine "{{ .Import }}"
+)
+
+// New{{ .Name }} creates a {{ .Name }} instance in its initial state
+// Adjust the states, rules and events to the workflow, guards and actions live in the hooks file
+func New{{ .Name }}() *statemachine.StateMachine {
+	sm := statemachine.NewStateMachine("created", "processing", "done", "canceled")
+
+	_ = sm.DescribeState("created", "The workflow was started")
+	_ = sm.DescribeState("processing", "The workflow is being worked on")
+	_ = sm.DescribeState("done", "The workflow finished")
+	_ = sm.DescribeState("canceled", "The workflow was abandoned")
+	_ = sm.TagState("done", "terminal")
+	_ = sm.TagState("canceled", "terminal")
+
+	_ = sm.AddRule(statemachine.NewConditionalTransitionRule("created", "processing", can{{ .Name }}Start))
+	_ = sm.AddRule(statemachine.NewSimpleTransitionRule("processing", "done"))
+	_ = sm.AddRule(statemachine.NewSimpleTransitionRule("created", "canceled"))
+	_ = sm.AddRule(statemachine.NewSimpleTransitionRule("processing", "canceled"))
+
+	_ = sm.AddEvent("start", "created", "processing")
+	_ = sm.AddEvent("finish", "processing", "done")
+	_ = sm.AddEvent("cancel", "created", "canceled")
+	_ = sm.AddEvent("cancel", "processing", "canceled")
+
+	_ = sm.AddAction("processing", "done", on{{ .Name }}Done)
+
+	return sm
+}
+`))},
+	{"*_hooks.go", template.Must(template.New("hooks").Parse(`package main
+
+import (
+	"context"
+
+	statemachine "{{ .Import }}"
+)
+
+// can{{ .Name }}Start is the guard of starting the workflow
+func can{{ .Name }}Start(params ...interface{}) bool {
+	return true
+}
+
+// on{{ .Name }}Done is the action run when the workflow finished
+func on{{ .Name }}Done(ctx context.Context, event statemachine.TransitionEvent) error {
+	return nil
+}
+`))},
+	{"*_service.go", template.Must(template.New("service").Parse(`package main
+
+import (
+	"net/http"
+
+	statemachine "{{ .Import }}"
+)
+
+// Serve{{ .Name }} serves the REST API of {{ .Name }} instances on addr, e.g. ":8080"
+// The OpenAPI document of the API is served at /openapi.json
+func Serve{{ .Name }}(addr string) error {
+	return http.ListenAndServe(addr, statemachine.NewHandler(statemachine.NewManager(), New{{ .Name }}))
+}
+`))},
+	{"*_test.go", template.Must(template.New("test").Parse(`package main
+
+import (
+	"errors"
+	"testing"
+
+	statemachine "{{ .Import }}"
+)
+
+func Test{{ .Name }}Finishes(t *testing.T) {
+	sm := New{{ .Name }}()
+
+	for _, event := range []statemachine.Event{"start", "finish"} {
+		err := sm.Fire(event)
+		if err != nil {
+			t.Fatalf("Fire(%v) error = %v", event, err)
+		}
+	}
+
+	if sm.State() != "done" {
+		t.Fatalf("State() = %v, want done", sm.State())
+	}
+}
+
+func Test{{ .Name }}CanNotFinishCanceled(t *testing.T) {
+	sm := New{{ .Name }}()
+
+	err := sm.Fire("cancel")
+	if err != nil {
+		t.Fatalf("Fire(cancel) error = %v", err)
+	}
+
+	err = sm.Fire("finish")
+	if !errors.Is(err, statemachine.EventNotHandled) {
+		t.Fatalf("Fire(finish) error = %v, want %v", err, statemachine.EventNotHandled)
+	}
+}
+`))},
+	{"main.go", template.Must(template.New("main").Parse(`package main
+
+import (
+	"flag"
+	"log"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to serve the REST API of {{ .Name }} instances on")
+	flag.Parse()
+
+	log.Fatal(Serve{{ .Name }}(*addr))
+}
+`))},
+}
+
+// Scaffold writes a new workflow into dir as a standalone package main, e.g. Scaffold("order-workflow",
+// "order-workflow", "github.com/acme/statemachine") generates a definition, guard and action stubs, a service main
+// serving the REST API and example tests, importing this package by the import path lib
+// Nothing is written if any of the files exists already
+func Scaffold(dir, name, lib string) error {
+	data := scaffold{
+		Import: lib,
+		Name:   identifier(name),
+	}
+
+	base := fileName(name)
+	sources := make(map[string][]byte, len(scaffoldFiles))
+	paths := make([]string, 0, len(scaffoldFiles))
+	for _, file := range scaffoldFiles {
+		buf := &bytes.Buffer{}
+		err := file.template.Execute(buf, data)
+		if err != nil {
+			return fmt.Errorf("rendering %v: %w", file.template.Name(), err)
+		}
+
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("formatting %v: %w", file.template.Name(), err)
+		}
+
+		path := filepath.Join(dir, strings.ReplaceAll(file.pattern, "*", base))
+		_, err = os.Lstat(path)
+		if err == nil {
+			return fmt.Errorf("creating %v: %w", path, os.ErrExist)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("creating %v: %w", path, err)
+		}
+
+		sources[path] = src
+		paths = append(paths, path)
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("creating %v: %w", dir, err)
+	}
+
+	for _, path := range paths {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return fmt.Errorf("creating %v: %w", path, err)
+		}
+
+		_, err = f.Write(sources[path])
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("writing %v: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// fileName converts a name into a Go file name without extension, e.g. "order-workflow" becomes "order_workflow"
+func fileName(name string) string {
+	sb := strings.Builder{}
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		} else if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "_") {
+			sb.WriteRune('_')
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "_")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// scenarioErrors maps the error names usable in scenarios to the errors of the package
+var scenarioErrors = map[string]error{
+	"TransitionNotAllowed": TransitionNotAllowed,
+	"StateNotFound":        StateNotFound,
+}
+
+// Scenario is a named sequence of transitions with their expected outcomes, e.g. the happy path of an order
+type Scenario struct {
+	Name  string         `json:"name"`
+	Steps []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep is a single transition attempt of a Scenario
+// Error is either the name of an error of the package (e.g. "TransitionNotAllowed")
+// or a part of the expected error message, an empty Error means the transition must succeed
+type ScenarioStep struct {
+	To     State         `json:"to"`
+	Params []interface{} `json:"params,omitempty"`
+	Expect State         `json:"expect"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// LoadScenarios reads a JSON array of scenarios
+// Whole numbers in params are decoded as int, other numbers as float64
+func LoadScenarios(r io.Reader) ([]Scenario, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var scenarios []Scenario
+	err := decoder.Decode(&scenarios)
+	if err != nil {
+		return nil, fmt.Errorf("decoding scenarios: %w", err)
+	}
+
+	for i := range scenarios {
+		for j := range scenarios[i].Steps {
+			for k, param := range scenarios[i].Steps[j].Params {
+				scenarios[i].Steps[j].Params[k] = jsonParam(param)
+			}
+		}
+	}
+
+	return scenarios, nil
+}
+
+// jsonParam converts json.Number params into int or float64
+func jsonParam(param interface{}) interface{} {
+	n, ok := param.(json.Number)
+	if !ok {
+		return param
+	}
+
+	i, err := n.Int64()
+	if err == nil {
+		return int(i)
+	}
+
+	f, err := n.Float64()
+	if err == nil {
+		return f
+	}
+
+	return param
+}
+
+// RunScenario executes the steps of a scenario on the StateMachine and returns an error describing
+// the first step which did not have the expected outcome
+func RunScenario(sm *StateMachine, scenario Scenario) error {
+	for i, step := range scenario.Steps {
+		err := sm.Transition(step.To, step.Params...)
+
+		if !scenarioErrorMatches(err, step.Error) {
+			return fmt.Errorf("scenario %q, step %d (-> %v): got error %v, want %q", scenario.Name, i, step.To, err, step.Error)
+		}
+
+		if step.Expect != "" && sm.State() != step.Expect {
+			return fmt.Errorf("scenario %q, step %d (-> %v): got state %v, want %v", scenario.Name, i, step.To, sm.State(), step.Expect)
+		}
+	}
+
+	return nil
+}
+
+// RunScenarios executes every scenario on a fresh StateMachine created by factory
+// and returns the failures keyed by scenario name
+func RunScenarios(factory func() *StateMachine, scenarios []Scenario) map[string]error {
+	failures := map[string]error{}
+	for _, scenario := range scenarios {
+		err := RunScenario(factory(), scenario)
+		if err != nil {
+			failures[scenario.Name] = err
+		}
+	}
+
+	return failures
+}
+
+// scenarioErrorMatches is true if err is the error described by want
+func scenarioErrorMatches(err error, want string) bool {
+	if want == "" || err == nil {
+		return want == "" && err == nil
+	}
+
+	target, ok := scenarioErrors[want]
+	if ok {
+		return errors.Is(err, target)
+	}
+
+	return strings.Contains(err.Error(), want)
+}
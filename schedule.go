@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// scheduledTimer is the timer kind of transitions scheduled for a later time
+const scheduledTimer = "scheduled"
+
+// ScheduleTransition schedules a transition of an instance into a state at a later time, e.g. auto-closing a ticket
+// after 7 days, and returns the ID of its timer
+// The transition is kept in the TimerStore of the Manager, so it survives restarts, and is attempted by
+// ProcessTimers on or after at from the state the instance is in when it is scheduled, transitions of instances which
+// left that state by then, e.g. of a ticket closed in the meantime, no longer allowed or of removed instances are
+// dropped
+func (m *Manager) ScheduleTransition(id string, at time.Time, to State, params ...interface{}) (string, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return "", err
+	}
+
+	inst.mu.Lock()
+	_, ok := inst.sm.states[to]
+	from := inst.sm.State()
+	inst.mu.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("instance: %v, state: %v, %w", id, to, StateNotFound)
+	}
+
+	timer := Timer{
+		ID:       fmt.Sprintf("%s#%s#%s#%d", id, scheduledTimer, to, at.UnixNano()),
+		Instance: id,
+		Kind:     scheduledTimer,
+		From:     from,
+		State:    to,
+		Due:      at,
+		Params:   params,
+	}
+
+	err = m.timerStore.SaveTimer(timer)
+	if err != nil {
+		return "", fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	return timer.ID, nil
+}
+
+// CancelScheduledTransition removes a scheduled transition by the ID of its timer, canceling a transition which
+// was already taken or canceled is not an error
+func (m *Manager) CancelScheduledTransition(timerID string) error {
+	err := m.timerStore.DeleteTimer(timerID)
+	if err != nil {
+		return fmt.Errorf("timer: %v, %w", timerID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ScriptEngine compiles guard and action scripts, it is implemented by adapters of scripting languages such as expr or
+// starlark
+type ScriptEngine interface {
+	Compile(source string) (Script, error)
+}
+
+// Script is a compiled guard or action script
+// A guard is evaluated with the variables "from", "to" and "params" describing the transition and the built-in timers
+// "timeInState" and "age" as time.Duration values, see MachineView.Timers
+// An action is evaluated with the variables "from", "to", "event" and "params" of the transition event
+type Script interface {
+	Eval(vars map[string]interface{}) (bool, error)
+}
+
+// ScriptTransitionRule allows the transition between two states only if its script evaluates to true
+// The script can be replaced at any time, which makes hot-editing business rules possible
+type ScriptTransitionRule struct {
+	from   State
+	to     State
+	mu     sync.RWMutex
+	script Script
+}
+
+// ScriptAction is an Action running a script, see Run
+// The script can be replaced at any time, like the script of a ScriptTransitionRule
+type ScriptAction struct {
+	from   State
+	to     State
+	mu     sync.RWMutex
+	script Script
+}
+
+// scriptRuleDefinition is a rule in a rules file or an action in an actions file
+type scriptRuleDefinition struct {
+	From   State  `json:"from"`
+	To     State  `json:"to"`
+	Guard  string `json:"guard,omitempty"`
+	Action string `json:"action,omitempty"`
+	Engine string `json:"engine,omitempty"`
+}
+
+// scriptEngines maps the registered ScriptEngines to their names
+var scriptEngines = struct {
+	sync.RWMutex
+	engines map[string]ScriptEngine
+}{engines: map[string]ScriptEngine{}}
+
+// RegisterScriptEngine registers a ScriptEngine by name, so that rules files can choose it with the "engine" key
+func RegisterScriptEngine(name string, engine ScriptEngine) {
+	scriptEngines.Lock()
+	defer scriptEngines.Unlock()
+
+	scriptEngines.engines[name] = engine
+}
+
+// registeredScriptEngine retrieves a ScriptEngine registered by RegisterScriptEngine
+func registeredScriptEngine(name string) (ScriptEngine, bool) {
+	scriptEngines.RLock()
+	defer scriptEngines.RUnlock()
+
+	engine, ok := scriptEngines.engines[name]
+
+	return engine, ok
+}
+
+// NewScriptTransitionRule creates a new ScriptTransitionRule
+func NewScriptTransitionRule(from, to State, script Script) *ScriptTransitionRule {
+	return &ScriptTransitionRule{
+		from:   from,
+		to:     to,
+		script: script,
+	}
+}
+
+// From retrieves the start state the transition rule applies to
+func (r *ScriptTransitionRule) From() State {
+	return r.from
+}
+
+// To retrieves the end state the transition rule applies to
+func (r *ScriptTransitionRule) To() State {
+	return r.to
+}
+
+// SetScript replaces the script of the rule
+func (r *ScriptTransitionRule) SetScript(script Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.script = script
+}
+
+// Valid is true if transitioning between two states is allowed, evaluated without a StateMachine the timers are zero
+// A script failing to evaluate denies the transition
+func (r *ScriptTransitionRule) Valid(from, to State, params ...interface{}) bool {
+	return r.ValidIn(MachineView{state: from}, from, to, params...)
+}
+
+// ValidIn is true if transitioning between two states of the viewed StateMachine is allowed
+func (r *ScriptTransitionRule) ValidIn(view MachineView, from, to State, params ...interface{}) bool {
+	if from != r.from || to != r.to {
+		return false
+	}
+
+	r.mu.RLock()
+	script := r.script
+	r.mu.RUnlock()
+
+	vars := map[string]interface{}{
+		"from":   from,
+		"to":     to,
+		"params": params,
+	}
+	for name, value := range view.Timers() {
+		vars[name] = value
+	}
+
+	valid, err := script.Eval(vars)
+
+	return err == nil && valid
+}
+
+// LoadScriptRules reads a rules file, a JSON array of objects with "from", "to" and "guard" keys,
+// and compiles the guards with the engine
+// A rule with an "engine" key is compiled with the ScriptEngine registered by that name instead, see RegisterScriptEngine
+func LoadScriptRules(r io.Reader, engine ScriptEngine) ([]*ScriptTransitionRule, error) {
+	definitions, scripts, err := compileScripts(r, engine, guardSource)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]*ScriptTransitionRule, 0, len(definitions))
+	for i, definition := range definitions {
+		rules = append(rules, NewScriptTransitionRule(definition.From, definition.To, scripts[i]))
+	}
+
+	return rules, nil
+}
+
+// ReloadScriptRules reads a changed rules file and replaces the scripts of rules loaded by LoadScriptRules
+// The rules file must describe the same edges in the same order, as rules of a StateMachine are fixed after finalization
+// Either every script is replaced or none of them
+func ReloadScriptRules(rules []*ScriptTransitionRule, r io.Reader, engine ScriptEngine) error {
+	definitions, scripts, err := compileScripts(r, engine, guardSource)
+	if err != nil {
+		return err
+	}
+
+	edges := make([]edge, 0, len(rules))
+	for _, rule := range rules {
+		edges = append(edges, edge{from: rule.from, to: rule.to})
+	}
+
+	err = sameEdges(definitions, edges)
+	if err != nil {
+		return err
+	}
+
+	for i, rule := range rules {
+		rule.SetScript(scripts[i])
+	}
+
+	return nil
+}
+
+// NewScriptAction creates a new ScriptAction
+func NewScriptAction(from, to State, script Script) *ScriptAction {
+	return &ScriptAction{
+		from:   from,
+		to:     to,
+		script: script,
+	}
+}
+
+// From retrieves the start state of the transition the action runs after
+func (a *ScriptAction) From() State {
+	return a.from
+}
+
+// To retrieves the end state of the transition the action runs after
+func (a *ScriptAction) To() State {
+	return a.to
+}
+
+// SetScript replaces the script of the action
+func (a *ScriptAction) SetScript(script Script) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.script = script
+}
+
+// Run runs the script of the action, it is an Action, e.g. sm.AddAction(action.From(), action.To(), action.Run)
+// A script failing to evaluate or evaluating to false fails the action
+func (a *ScriptAction) Run(ctx context.Context, event TransitionEvent) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	script := a.script
+	a.mu.RUnlock()
+
+	ok, err := script.Eval(map[string]interface{}{
+		"from":   event.From,
+		"to":     event.To,
+		"event":  event.Event,
+		"params": event.Params,
+	})
+	if err != nil {
+		return fmt.Errorf("action script %v -> %v: %w", a.from, a.to, err)
+	}
+	if !ok {
+		return fmt.Errorf("action script %v -> %v returned false", a.from, a.to)
+	}
+
+	return nil
+}
+
+// LoadScriptActions reads an actions file, a JSON array of objects with "from", "to" and "action" keys,
+// and compiles the actions with the engine, or with the ScriptEngine registered by the name of an "engine" key
+func LoadScriptActions(r io.Reader, engine ScriptEngine) ([]*ScriptAction, error) {
+	definitions, scripts, err := compileScripts(r, engine, actionSource)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]*ScriptAction, 0, len(definitions))
+	for i, definition := range definitions {
+		actions = append(actions, NewScriptAction(definition.From, definition.To, scripts[i]))
+	}
+
+	return actions, nil
+}
+
+// ReloadScriptActions reads a changed actions file and replaces the scripts of actions loaded by LoadScriptActions
+// The actions file must describe the same edges in the same order, either every script is replaced or none of them
+func ReloadScriptActions(actions []*ScriptAction, r io.Reader, engine ScriptEngine) error {
+	definitions, scripts, err := compileScripts(r, engine, actionSource)
+	if err != nil {
+		return err
+	}
+
+	edges := make([]edge, 0, len(actions))
+	for _, action := range actions {
+		edges = append(edges, edge{from: action.from, to: action.to})
+	}
+
+	err = sameEdges(definitions, edges)
+	if err != nil {
+		return err
+	}
+
+	for i, action := range actions {
+		action.SetScript(scripts[i])
+	}
+
+	return nil
+}
+
+// guardSource retrieves the guard script of a rule
+func guardSource(definition scriptRuleDefinition) string {
+	return definition.Guard
+}
+
+// actionSource retrieves the script of an action
+func actionSource(definition scriptRuleDefinition) string {
+	return definition.Action
+}
+
+// sameEdges checks that a changed file describes the loaded edges in the same order
+func sameEdges(definitions []scriptRuleDefinition, edges []edge) error {
+	if len(definitions) != len(edges) {
+		return fmt.Errorf("file has %d entries, %d are loaded", len(definitions), len(edges))
+	}
+
+	for i, definition := range definitions {
+		if definition.From != edges[i].from || definition.To != edges[i].to {
+			return fmt.Errorf("entry %d: file has %v -> %v, loaded entry is %v -> %v", i, definition.From, definition.To, edges[i].from, edges[i].to)
+		}
+	}
+
+	return nil
+}
+
+// compileScripts reads a rules or actions file and compiles the scripts retrieved by source
+func compileScripts(r io.Reader, engine ScriptEngine, source func(scriptRuleDefinition) string) ([]scriptRuleDefinition, []Script, error) {
+	var definitions []scriptRuleDefinition
+	err := json.NewDecoder(r).Decode(&definitions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding file: %w", err)
+	}
+
+	scripts := make([]Script, 0, len(definitions))
+	for i, definition := range definitions {
+		compiler := engine
+		if definition.Engine != "" {
+			var ok bool
+			compiler, ok = registeredScriptEngine(definition.Engine)
+			if !ok {
+				return nil, nil, fmt.Errorf("entry %d (%v -> %v): engine %q is not registered", i, definition.From, definition.To, definition.Engine)
+			}
+		}
+
+		if compiler == nil {
+			return nil, nil, fmt.Errorf("entry %d (%v -> %v): no engine", i, definition.From, definition.To)
+		}
+
+		script, err := compiler.Compile(source(definition))
+		if err != nil {
+			return nil, nil, fmt.Errorf("entry %d (%v -> %v): %w", i, definition.From, definition.To, err)
+		}
+
+		scripts = append(scripts, script)
+	}
+
+	return definitions, scripts, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+// Divergence describes a transition attempt which the candidate definition of a shadow evaluation judged differently
+type Divergence struct {
+	From      State
+	To        State
+	Params    []interface{}
+	Primary   TransitionResult
+	Candidate TransitionResult
+}
+
+// shadow evaluates transitions against a candidate definition without applying them
+type shadow struct {
+	candidate *StateMachine
+	report    func(divergence Divergence)
+}
+
+// SetShadow makes the StateMachine additionally evaluate every transition attempt against the rules of a candidate
+// definition, reporting every attempt where the candidate disagrees, so that a refactored definition can be validated
+// against real traffic before the cutover
+// The candidate is never transitioned, but note that its guards are called, including any side effects they have
+// Passing a nil candidate turns the shadow evaluation off
+func (sm *StateMachine) SetShadow(candidate *StateMachine, report func(divergence Divergence)) {
+	if candidate == nil {
+		sm.shadow = nil
+
+		return
+	}
+
+	sm.shadow = &shadow{
+		candidate: candidate,
+		report:    report,
+	}
+}
+
+// compare evaluates a transition against the candidate and reports a divergence from the primary result
+func (s *shadow) compare(from, to State, allowed bool, params ...interface{}) {
+	if s == nil {
+		return
+	}
+
+	candidate := s.candidate.evaluateShadow(from, to, params...)
+	if candidate == allowed {
+		return
+	}
+
+	s.report(Divergence{
+		From:      from,
+		To:        to,
+		Params:    params,
+		Primary:   result(allowed),
+		Candidate: result(candidate),
+	})
+}
+
+// evaluateShadow is true if the rules of the StateMachine allow transitioning between two states,
+// regardless of its current state
+func (sm *StateMachine) evaluateShadow(from, to State, params ...interface{}) bool {
+	_, ok := sm.states[from]
+	if !ok {
+		return false
+	}
+
+	_, ok = sm.states[to]
+	if !ok {
+		return false
+	}
+
+	return sm.allowed(from, to, params...)
+}
+
+// result converts the outcome of evaluating the rules into a TransitionResult
+func result(allowed bool) TransitionResult {
+	if allowed {
+		return Allowed
+	}
+
+	return Rejected
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ManagerShutDown = fmt.Errorf("error: manager shut down")
+
+// Flusher is implemented by stores buffering writes, e.g. a TimerStore or an InstanceStore writing in batches
+type Flusher interface {
+	Flush() error
+}
+
+// ShutdownReport lists what Shutdown could not finish before its deadline
+type ShutdownReport struct {
+	// InFlight is the number of transitions still running
+	InFlight int
+	// Queues maps the names of the watched Mailboxes to the number of events left in them
+	Queues map[string]int
+	// Unflushed lists the IDs of the instances whose changes were not persisted
+	Unflushed []string
+}
+
+// String returns a one line summary of the report
+func (r ShutdownReport) String() string {
+	queues := make([]string, 0, len(r.Queues))
+	for name, depth := range r.Queues {
+		queues = append(queues, fmt.Sprintf("%s: %d", name, depth))
+	}
+
+	sort.Strings(queues)
+
+	return fmt.Sprintf("%d transitions in flight, queues: %v, unflushed instances: %v", r.InFlight, strings.Join(queues, ", "), strings.Join(r.Unflushed, ", "))
+}
+
+// SetInstanceStore sets the InstanceStore the instances changed by transitions are persisted in by Flush
+func (m *Manager) SetInstanceStore(store InstanceStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.instanceStore = store
+}
+
+// Flush persists every instance changed by transitions since it was last flushed into the InstanceStore at once,
+// and flushes the TimerStore if it is a Flusher
+// It returns the IDs of the instances it could not persist
+func (m *Manager) Flush() ([]string, error) {
+	m.mu.RLock()
+	store := m.instanceStore
+	m.mu.RUnlock()
+
+	var errs []error
+	if flusher, ok := m.timerStore.(Flusher); ok {
+		err := flusher.Flush()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("flushing timers: %w", err))
+		}
+	}
+
+	if store == nil {
+		return nil, errors.Join(errs...)
+	}
+
+	var dirty []*instance
+	var instances []StoredInstance
+	for _, id := range m.IDs() {
+		inst, err := m.instance(id)
+		if err != nil {
+			continue
+		}
+
+		inst.mu.Lock()
+		if inst.dirty {
+			dirty = append(dirty, inst)
+			instances = append(instances, inst.stored(id))
+			inst.dirty = false
+		}
+		inst.mu.Unlock()
+	}
+
+	if len(instances) == 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	err := store.SaveAll(instances)
+	if err == nil {
+		if flusher, ok := store.(Flusher); ok {
+			err = flusher.Flush()
+		}
+	}
+
+	if err != nil {
+		ids := make([]string, len(instances))
+		for i, inst := range dirty {
+			inst.mu.Lock()
+			inst.dirty = true
+			inst.mu.Unlock()
+
+			ids[i] = instances[i].ID
+		}
+
+		return ids, errors.Join(append(errs, fmt.Errorf("saving instances: %w", err))...)
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// Shutdown stops the Manager from accepting new transitions and instances, which fail with ManagerShutDown,
+// waits for the transitions in flight to finish and for the watched Mailboxes to drain, see WatchQueue,
+// then persists the changed instances and the pending timers, see Flush
+// Mailboxes keep processing their events until their own context is done, Shutdown only waits for them
+// If ctx is done first, the report lists what was left and the error of ctx is returned
+func (m *Manager) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	m.closed.Store(true)
+
+	m.mu.RLock()
+	queues := make(map[string]*Mailbox, len(m.queues))
+	for name, mb := range m.queues {
+		queues[name] = mb
+	}
+	m.mu.RUnlock()
+
+	report := ShutdownReport{Queues: map[string]int{}}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		report.InFlight = int(m.inFlight.Load())
+		clear(report.Queues)
+		for name, mb := range queues {
+			depth := mb.Len()
+			if depth > 0 {
+				report.Queues[name] = depth
+			}
+		}
+
+		if report.InFlight == 0 && len(report.Queues) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			ids, _ := m.Flush()
+			report.Unflushed = ids
+
+			return report, contextErr(ctx)
+		case <-ticker.C:
+		}
+	}
+
+	ids, err := m.Flush()
+	report.Unflushed = ids
+
+	return report, err
+}
+
+// enter registers a new transition in flight, it fails once the Manager is shut down
+func (m *Manager) enter() error {
+	m.inFlight.Add(1)
+	if m.closed.Load() {
+		m.inFlight.Add(-1)
+
+		return ManagerShutDown
+	}
+
+	return nil
+}
+
+// leave unregisters a transition in flight
+func (m *Manager) leave() {
+	m.inFlight.Add(-1)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	SignalLoop         = fmt.Errorf("error: signal loop detected")
+	SignalNotDelivered = fmt.Errorf("error: signal not delivered")
+)
+
+// SignalPolicy configures the delivery of signals sent between instances of a Manager
+type SignalPolicy struct {
+	// MaxDepth limits the number of instances a chain of signals may pass through
+	MaxDepth int
+	// Retries is the number of additional delivery attempts for a signal which left its target untouched
+	Retries int
+	// OnUndelivered is called for every signal which could not be delivered
+	OnUndelivered func(id string, event Event, err error)
+}
+
+// signal is an event sent to an instance by an action of another instance
+type signal struct {
+	chain  []string
+	id     string
+	event  Event
+	params []interface{}
+}
+
+// signalQueue holds the signals sent during a transition until they are delivered
+type signalQueue struct {
+	mu      sync.Mutex
+	signals []signal
+}
+
+// signalContext is stored in the context of transitions done by a Manager
+// chain lists the instances the current chain of signals passed through
+type signalContext struct {
+	chain []string
+	queue *signalQueue
+}
+
+// signalKey is the context key of the signalContext
+type signalKey struct{}
+
+// SetSignalPolicy sets the SignalPolicy of the Manager
+func (m *Manager) SetSignalPolicy(policy SignalPolicy) {
+	m.signals = policy
+}
+
+// Send sends an event to the instance with the given ID from an action of another instance
+// When called from an action of a transition done by the Manager, the signal is delivered after the transition
+// completed and the lock of the sender is released, so instances can signal each other without deadlocks
+// Signals returning to an instance which is already part of the chain are rejected with SignalLoop
+// Called outside of an action the event is fired right away
+func (m *Manager) Send(ctx context.Context, id string, event Event, params ...interface{}) error {
+	sc, ok := ctx.Value(signalKey{}).(*signalContext)
+	if !ok {
+		return m.FireContext(ctx, id, event, params...)
+	}
+
+	for _, visited := range sc.chain {
+		if visited == id {
+			return fmt.Errorf("signal: %v -> %v, %w", strings.Join(sc.chain, " -> "), id, SignalLoop)
+		}
+	}
+
+	if m.signals.MaxDepth > 0 && len(sc.chain) >= m.signals.MaxDepth {
+		return fmt.Errorf("signal: %v -> %v, maximum depth of %d reached, %w", strings.Join(sc.chain, " -> "), id, m.signals.MaxDepth, SignalLoop)
+	}
+
+	sc.queue.mu.Lock()
+	defer sc.queue.mu.Unlock()
+
+	sc.queue.signals = append(sc.queue.signals, signal{chain: sc.chain, id: id, event: event, params: params})
+
+	return nil
+}
+
+// SignalAction creates an action which sends the event to the instances with the given IDs,
+// passing along the params of the transition
+func (m *Manager) SignalAction(event Event, ids ...string) Action {
+	return func(ctx context.Context, transition TransitionEvent) error {
+		var errs []error
+		for _, id := range ids {
+			errs = append(errs, m.Send(ctx, id, event, transition.Params...))
+		}
+
+		return errors.Join(errs...)
+	}
+}
+
+// dispatch calls fn with the instance of the given ID and a context carrying the chain of signals,
+// the outermost dispatch delivers the signals sent by the actions and by completed child groups afterwards
+// Failed deliveries are returned wrapped in SignalNotDelivered
+func (m *Manager) dispatch(ctx context.Context, id string, fn func(ctx context.Context, sm *StateMachine) error) error {
+	sc, nested := ctx.Value(signalKey{}).(*signalContext)
+	if nested {
+		chain := append(append([]string(nil), sc.chain...), id)
+
+		return m.dispatchIn(context.WithValue(ctx, signalKey{}, &signalContext{chain: chain, queue: sc.queue}), id, fn)
+	}
+
+	err := m.enter()
+	if err != nil {
+		return fmt.Errorf("instance: %v, %w", id, err)
+	}
+	defer m.leave()
+
+	queue := &signalQueue{}
+	err = m.dispatchIn(context.WithValue(ctx, signalKey{}, &signalContext{chain: []string{id}, queue: queue}), id, fn)
+
+	return errors.Join(err, m.deliver(ctx, queue))
+}
+
+// dispatchIn calls fn with the instance of the given ID within the context of the signal chain
+func (m *Manager) dispatchIn(ctx context.Context, id string, fn func(ctx context.Context, sm *StateMachine) error) error {
+	release, err := m.claim(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = m.with(id, func(sm *StateMachine) error {
+		return fn(ctx, sm)
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.childTransitioned(ctx, id)
+}
+
+// deliver fires the queued signals in the order they were sent, including the ones sent while delivering
+func (m *Manager) deliver(ctx context.Context, queue *signalQueue) error {
+	var errs []error
+	for {
+		queue.mu.Lock()
+		if len(queue.signals) == 0 {
+			queue.mu.Unlock()
+
+			return errors.Join(errs...)
+		}
+
+		s := queue.signals[0]
+		queue.signals[0] = signal{}
+		queue.signals = queue.signals[1:]
+		queue.mu.Unlock()
+
+		inner := context.WithValue(ctx, signalKey{}, &signalContext{chain: s.chain, queue: queue})
+
+		var err error
+		for attempt := 0; attempt <= m.signals.Retries; attempt++ {
+			err = m.dispatch(inner, s.id, func(ctx context.Context, sm *StateMachine) error {
+				return sm.FireContext(ctx, s.event, s.params...)
+			})
+			if err == nil || errors.Is(err, ActionFailed) {
+				break
+			}
+		}
+
+		if err != nil {
+			if m.signals.OnUndelivered != nil {
+				m.signals.OnUndelivered(s.id, s.event, err)
+			}
+
+			errs = append(errs, fmt.Errorf("signal: %v to %v, %w: %w", s.event, s.id, SignalNotDelivered, err))
+		}
+	}
+}
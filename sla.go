@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SLALevel is the severity of an SLA event
+type SLALevel string
+
+const (
+	SLAWarning SLALevel = "warning"
+	SLABreach  SLALevel = "breach"
+)
+
+// timer kinds of SLA deadlines
+const (
+	slaWarnTimer   = "sla-warn"
+	slaBreachTimer = "sla-breach"
+)
+
+// SLAEvent is emitted when an instance stays in a state longer than allowed by its SLA policy
+type SLAEvent struct {
+	Instance string
+	State    State
+	Level    SLALevel
+	Deadline time.Time
+	// Escalation is the error of the escalation transition of a breach, if any
+	Escalation error
+}
+
+// SLAPolicy limits how long instances may stay in a state
+// A zero WarnAfter or BreachAfter disables the given level, if Escalate is not empty, instances breaching the SLA
+// are transitioned into it
+type SLAPolicy struct {
+	WarnAfter   time.Duration
+	BreachAfter time.Duration
+	Escalate    State
+	Notify      func(event SLAEvent)
+}
+
+// SetSLA attaches an SLA policy to a state, replacing the previous policy of the state
+// The policy applies to instances entering the state after this call and to instances added later
+// Deadlines are kept in the TimerStore of the Manager and are checked by ProcessTimers
+func (m *Manager) SetSLA(state State, policy SLAPolicy) {
+	m.mu.Lock()
+	m.slas[state] = policy
+	m.mu.Unlock()
+
+	m.handleTimers(slaWarnTimer, m.slaExpired)
+	m.handleTimers(slaBreachTimer, m.slaExpired)
+}
+
+// slaTimerID returns the ID of an SLA timer of an instance in a state
+// The state is part of the ID, so escalating into a state with its own SLA does not overwrite the expiring timer
+func slaTimerID(id string, state State, kind string) string {
+	return fmt.Sprintf("%s#%s#%s", id, state, kind)
+}
+
+// enterSLA replaces the SLA timers of an instance which transitioned between two states at the given time
+// States without a policy have no timers, so they are skipped without touching the TimerStore
+func (m *Manager) enterSLA(id string, from, to State, entered time.Time) error {
+	m.mu.RLock()
+	_, timed := m.slas[from]
+	policy, ok := m.slas[to]
+	m.mu.RUnlock()
+
+	if timed {
+		err := m.stopSLA(id, from)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	return m.startSLA(id, to, policy, entered, time.Time{})
+}
+
+// resumeSLA schedules the SLA timers of an instance added to the Manager, unless they are already stored
+// Stored timers were persisted before a restart, they are kept so that their deadlines are not moved
+// Deadlines which already passed are not scheduled again, as they were handled before the restart
+func (m *Manager) resumeSLA(id string, state State, policy SLAPolicy, entered time.Time) error {
+	for _, kind := range []string{slaWarnTimer, slaBreachTimer} {
+		_, ok, err := m.timerStore.Timer(slaTimerID(id, state, kind))
+		if err != nil {
+			return fmt.Errorf("instance: %v, %w", id, err)
+		}
+
+		if ok {
+			return nil
+		}
+	}
+
+	return m.startSLA(id, state, policy, entered, m.clock.Now())
+}
+
+// startSLA schedules the SLA timers of an instance which entered a state at the given time,
+// deadlines not after notBefore are skipped
+func (m *Manager) startSLA(id string, state State, policy SLAPolicy, entered, notBefore time.Time) error {
+	if policy.WarnAfter > 0 && entered.Add(policy.WarnAfter).After(notBefore) {
+		err := m.saveSLATimer(id, slaWarnTimer, state, entered.Add(policy.WarnAfter))
+		if err != nil {
+			return err
+		}
+	}
+
+	if policy.BreachAfter > 0 && entered.Add(policy.BreachAfter).After(notBefore) {
+		return m.saveSLATimer(id, slaBreachTimer, state, entered.Add(policy.BreachAfter))
+	}
+
+	return nil
+}
+
+// saveSLATimer stores an SLA timer of an instance
+func (m *Manager) saveSLATimer(id, kind string, state State, due time.Time) error {
+	err := m.timerStore.SaveTimer(Timer{
+		ID:       slaTimerID(id, state, kind),
+		Instance: id,
+		Kind:     kind,
+		State:    state,
+		Due:      due,
+	})
+	if err != nil {
+		return fmt.Errorf("instance: %v, %w", id, err)
+	}
+
+	return nil
+}
+
+// stopSLA deletes the SLA timers of an instance in a state
+func (m *Manager) stopSLA(id string, state State) error {
+	var errs []error
+	for _, kind := range []string{slaWarnTimer, slaBreachTimer} {
+		err := m.timerStore.DeleteTimer(slaTimerID(id, state, kind))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("instance: %v, %w", id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// slaExpired emits the SLA event of an expired timer and escalates breaches
+// Timers of instances which already left the state are dropped, timers of instances not added yet, e.g. right after
+// a restart, are kept until the instance is added again
+func (m *Manager) slaExpired(ctx context.Context, timer Timer) error {
+	state, err := m.State(timer.Instance)
+	if err != nil {
+		return err
+	}
+
+	if state != timer.State {
+		return nil
+	}
+
+	m.mu.RLock()
+	policy, ok := m.slas[timer.State]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	event := SLAEvent{
+		Instance: timer.Instance,
+		State:    timer.State,
+		Level:    SLAWarning,
+		Deadline: timer.Due,
+	}
+
+	if timer.Kind == slaBreachTimer {
+		event.Level = SLABreach
+
+		if policy.Escalate != "" {
+			event.Escalation = m.TransitionContext(ctx, timer.Instance, policy.Escalate)
+		}
+	}
+
+	if policy.Notify != nil {
+		policy.Notify(event)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// smctlCommand is a subcommand of smctl, it receives the arguments following its name
+type smctlCommand func(args []string, stdout, stderr io.Writer) error
+
+// smctlCommands are the subcommands of smctl by name
+var smctlCommands = map[string]smctlCommand{
+	"bench": benchCommand,
+	"init":  initCommand,
+	"lint":  lintCommand,
+}
+
+// smctl runs the smctl command line tool, e.g. `smctl lint order.pb`, and returns its exit code:
+// 0 on success, 1 if the command failed and 2 if it was used incorrectly
+func smctl(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || smctlCommands[args[0]] == nil {
+		names := make([]string, 0, len(smctlCommands))
+		for name := range smctlCommands {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		_, _ = fmt.Fprintf(stderr, "usage: smctl <command> [arguments]\ncommands: %s\n", strings.Join(names, ", "))
+
+		return 2
+	}
+
+	err := smctlCommands[args[0]](args[1:], stdout, stderr)
+	if errors.Is(err, InvalidRequest) {
+		_, _ = fmt.Fprintf(stderr, "smctl %s: %v\n", args[0], err)
+
+		return 2
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "smctl %s: %v\n", args[0], err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// parseFlags parses the flags of a command, failing with InvalidRequest
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, InvalidRequest)
+	}
+
+	return nil
+}
+
+// readDefinition reads a Definition message of statemachine.proto from a file, e.g. written by MarshalDefinitionProto,
+// and returns a function creating StateMachines from it
+// Guards are code, so the rules of guarded edges stand in for them by always returning allow
+func readDefinition(path string, allow bool) (func() *StateMachine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	definition := func() (*StateMachine, error) {
+		return UnmarshalDefinitionProto(data, func(from, to State) TransitionRule {
+			return NewConditionalTransitionRule(from, to, func(params ...interface{}) bool {
+				return allow
+			})
+		})
+	}
+
+	_, err = definition()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	return func() *StateMachine {
+		sm, _ := definition()
+
+		return sm
+	}, nil
+}
+
+// lintCommand lints definition files, suitable for CI gates as it fails if any issue is found
+// e.g. `smctl lint -disable no-state-without-description -max-out-degree 5 order.pb`
+func lintCommand(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	disable := fs.String("disable", "", "comma-separated names of the rules to disable")
+	maxOutDegree := fs.Int("max-out-degree", 7, "maximum number of outgoing edges of a state")
+	terminalTag := fs.String("terminal-tag", "terminal", "tag terminal states must have")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no definition file given, %w", InvalidRequest)
+	}
+
+	linter := NewLinter(NoStateWithoutDescription(), NoUnconditionalCycle(), MaxOutDegree(*maxOutDegree),
+		TerminalStatesTagged(*terminalTag))
+	if *disable != "" {
+		linter.Disable(strings.Split(*disable, ",")...)
+	}
+
+	found := 0
+	for _, path := range fs.Args() {
+		definition, err := readDefinition(path, false)
+		if err != nil {
+			return err
+		}
+
+		for _, issue := range linter.Lint(definition()) {
+			_, _ = fmt.Fprintf(stdout, "%v: %v\n", path, issue)
+			found++
+		}
+	}
+
+	if found > 0 {
+		return fmt.Errorf("issues found: %d", found)
+	}
+
+	return nil
+}
+
+// initCommand generates a new workflow project, e.g. `smctl init -import github.com/acme/statemachine order-workflow`
+// writes a standalone package main into the directory order-workflow
+func initCommand(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", "", "directory to generate the project into, the name of the workflow by default")
+	lib := fs.String("import", "", "import path of the statemachine package")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("exactly one workflow name expected, %w", InvalidRequest)
+	}
+	if *lib == "" {
+		return fmt.Errorf("no import path given, %w", InvalidRequest)
+	}
+
+	name := fs.Arg(0)
+	if *dir == "" {
+		*dir = name
+	}
+
+	err = Scaffold(*dir, name, *lib)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(stdout, "generated %v in %v\n", name, *dir)
+
+	return nil
+}
+
+// benchCommand load tests a definition file, guarded edges are always allowed
+// e.g. `smctl bench -instances 1000 -workers 8 -rate 5000 -duration 30s order.pb`
+func benchCommand(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	config := BenchConfig{}
+	fs.IntVar(&config.Instances, "instances", 100, "number of instances")
+	fs.IntVar(&config.Workers, "workers", runtime.GOMAXPROCS(0), "number of goroutines driving transitions")
+	fs.Float64Var(&config.Rate, "rate", 0, "target transitions per second, 0 means as fast as possible")
+	fs.DurationVar(&config.Duration, "duration", 10*time.Second, "duration of the load test")
+	fs.Int64Var(&config.Seed, "seed", time.Now().UnixNano(), "seed of the random transitions")
+	fs.IntVar(&config.Hotspots, "hotspots", 5, "number of most contended instances to report")
+
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("exactly one definition file expected, %w", InvalidRequest)
+	}
+
+	definition, err := readDefinition(fs.Arg(0), true)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(stdout, Bench(definition, config))
+
+	return err
+}
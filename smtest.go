@@ -0,0 +1,183 @@
+//go:build smtest
+
+// The property-based testing helpers are only built with the smtest tag, e.g. `go test -tags smtest`, so that testing
+// and testing/quick are not linked into production binaries, a separate smtest package could not import package main
+
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// Property is an invariant checked by applying a sequence of transitions to a StateMachine
+type Property func(sm *StateMachine, sequence []State) bool
+
+// Sequence generates a sequence of at most steps states, each reachable from the previous one by a rule,
+// starting from the current state of the StateMachine
+// choose must return a number in [0, n), which makes it easy to plug in any source of randomness
+// Guards are ignored, so a sequence may contain transitions which are going to be rejected
+func Sequence(sm *StateMachine, steps int, choose func(n int) int) []State {
+	var sequence []State
+
+	state := sm.State()
+	for i := 0; i < steps; i++ {
+		targets := sm.Targets(state)
+		if len(targets) == 0 {
+			break
+		}
+
+		state = targets[choose(len(targets))]
+		sequence = append(sequence, state)
+	}
+
+	return sequence
+}
+
+// RandomSequence generates a sequence of at most steps states using r as the source of randomness
+func RandomSequence(sm *StateMachine, r *rand.Rand, steps int) []State {
+	return Sequence(sm, steps, r.Intn)
+}
+
+// QuickConfig returns a testing/quick configuration which generates random sequences
+// for StateMachines created by factory
+func QuickConfig(factory func() *StateMachine) *quick.Config {
+	return &quick.Config{
+		Values: func(values []reflect.Value, r *rand.Rand) {
+			sm := factory()
+			steps := r.Intn(len(sm.states) * 4)
+			values[0] = reflect.ValueOf(RandomSequence(sm, r, steps))
+		},
+	}
+}
+
+// QuickProperty adapts a Property so that it can be checked by quick.Check,
+// every check runs on a fresh StateMachine created by factory
+//
+//	err := quick.Check(QuickProperty(factory, NeverLeavesStateSet), QuickConfig(factory))
+func QuickProperty(factory func() *StateMachine, property Property) func([]State) bool {
+	return func(sequence []State) bool {
+		return property(factory(), sequence)
+	}
+}
+
+// NeverLeavesStateSet is true if the StateMachine stays in one of its states during the whole sequence
+func NeverLeavesStateSet(sm *StateMachine, sequence []State) bool {
+	for _, to := range sequence {
+		_ = sm.Transition(to)
+
+		_, ok := sm.states[sm.State()]
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// TerminalStatesAreAbsorbing is true if once the StateMachine reaches a state without outgoing rules,
+// every attempt to leave that state fails
+func TerminalStatesAreAbsorbing(sm *StateMachine, sequence []State) bool {
+	for _, to := range sequence {
+		_ = sm.Transition(to)
+
+		state := sm.State()
+		if len(sm.Targets(state)) > 0 {
+			continue
+		}
+
+		for _, other := range sm.States() {
+			if sm.Transition(other) == nil && sm.State() != state {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// AssertUnreachable fails the test if the to state can be reached from the from state by any sequence of
+// transitions, e.g. that Shipped can never go back to Draft, reporting the shortest such sequence
+// The search is exhaustive over the definition: passes stubs the guards, deciding for every rule whether it may
+// allow a transition, combined by the MatchStrategy of the edge, a nil passes lets every rule allow it
+func AssertUnreachable(t testing.TB, sm *StateMachine, from, to State, passes func(rule TransitionRule) bool) {
+	t.Helper()
+
+	path := ReachPath(sm, from, to, passes)
+	if path == nil {
+		return
+	}
+
+	names := make([]string, len(path))
+	for i, state := range path {
+		names[i] = string(state)
+	}
+
+	t.Errorf("%v is reachable from %v: %v", to, from, strings.Join(names, " -> "))
+}
+
+// ReachPath returns the shortest sequence of states leading from the from state to the to state, starting with
+// from, or nil if there is none, see AssertUnreachable for passes
+// If from and to are the same state, it looks for a cycle returning to it
+func ReachPath(sm *StateMachine, from, to State, passes func(rule TransitionRule) bool) []State {
+	if passes == nil {
+		passes = func(rule TransitionRule) bool {
+			return true
+		}
+	}
+
+	previous := map[State]State{}
+	visited := map[State]bool{from: true}
+	queue := []State{from}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, next := range sm.Targets(state) {
+			if !sm.stubbedAllowed(state, next, passes) {
+				continue
+			}
+
+			if next == to {
+				path := []State{state, to}
+				for path[0] != from {
+					path = append([]State{previous[path[0]]}, path...)
+				}
+
+				return path
+			}
+
+			if !visited[next] {
+				visited[next] = true
+				previous[next] = state
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return nil
+}
+
+// stubbedAllowed is true if the rules of an edge allow the transition according to its MatchStrategy,
+// when the validity of each rule is decided by passes
+func (sm *StateMachine) stubbedAllowed(from, to State, passes func(rule TransitionRule) bool) bool {
+	strategy := sm.matchStrategy(from, to)
+	for _, rule := range sm.edgeRules(from, to) {
+		valid := passes(rule)
+
+		switch {
+		case strategy == AllMustPass && !valid:
+			return false
+		case strategy == AllMustPass:
+		case valid:
+			return true
+		case strategy == FirstMatch && !isPassThrough(rule):
+			return false
+		}
+	}
+
+	return strategy == AllMustPass
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ObjectNotFound = fmt.Errorf("error: object not found")
+
+// ObjectStore is a bucket of an object storage service like S3 or GCS, adapters wrap the client of the service
+// Get returns ObjectNotFound for missing keys, List returns the keys starting with prefix in lexical order
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// MemoryObjectStore is an ObjectStore keeping objects in memory, it does not survive restarts on its own
+type MemoryObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewMemoryObjectStore creates a new MemoryObjectStore
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{
+		objects: map[string][]byte{},
+	}
+}
+
+// Put adds or replaces an object
+func (s *MemoryObjectStore) Put(_ context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = append([]byte(nil), data...)
+
+	return nil
+}
+
+// Get returns an object
+func (s *MemoryObjectStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("key: %v, %w", key, ObjectNotFound)
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+// List returns the keys starting with prefix in lexical order
+func (s *MemoryObjectStore) List(_ context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// SnapshotStore archives instances as gzipped JSON objects in an ObjectStore
+// Keys are laid out so that lifecycle rules can target them by prefix, e.g. moving archives to cold storage and
+// expiring old backups:
+//
+//	<prefix>/archive/<version>/<yyyy>/<mm>/<dd>/<id>.json.gz
+//	<prefix>/backup/<yyyy-mm-ddThh-mm-ssZ>/<id>.json.gz
+type SnapshotStore struct {
+	objects ObjectStore
+	prefix  string
+	clock   Clock
+}
+
+// NewSnapshotStore creates a new SnapshotStore keeping snapshots under prefix
+func NewSnapshotStore(objects ObjectStore, prefix string, clock Clock) *SnapshotStore {
+	return &SnapshotStore{
+		objects: objects,
+		prefix:  strings.Trim(prefix, "/"),
+		clock:   clock,
+	}
+}
+
+// Archive saves a snapshot of an instance, usually one in a terminal state, and returns its key
+func (s *SnapshotStore) Archive(ctx context.Context, instance StoredInstance) (string, error) {
+	version := instance.Version
+	if version == "" {
+		version = "unversioned"
+	}
+
+	now := s.clock.Now().UTC()
+	key := path.Join(s.prefix, "archive", version, now.Format("2006/01/02"), instance.ID+".json.gz")
+
+	return key, s.put(ctx, key, instance)
+}
+
+// Backup saves a snapshot of every instance of a Manager under a common prefix and returns it, see Backups
+func (s *SnapshotStore) Backup(ctx context.Context, m *Manager) (string, error) {
+	prefix := path.Join(s.prefix, "backup", s.clock.Now().UTC().Format("2006-01-02T15-04-05Z"))
+
+	for _, id := range m.IDs() {
+		instance, err := m.stored(id)
+		if err != nil {
+			continue
+		}
+
+		err = s.put(ctx, path.Join(prefix, id+".json.gz"), instance)
+		if err != nil {
+			return prefix, err
+		}
+	}
+
+	return prefix, nil
+}
+
+// Backups returns the prefixes of the backups, the oldest first
+func (s *SnapshotStore) Backups(ctx context.Context) ([]string, error) {
+	keys, err := s.objects.List(ctx, path.Join(s.prefix, "backup")+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixes []string
+	for _, key := range keys {
+		prefix := path.Dir(key)
+		if len(prefixes) == 0 || prefixes[len(prefixes)-1] != prefix {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// Load returns the instance saved under a key
+func (s *SnapshotStore) Load(ctx context.Context, key string) (StoredInstance, error) {
+	data, err := s.objects.Get(ctx, key)
+	if err != nil {
+		return StoredInstance{}, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return StoredInstance{}, fmt.Errorf("key: %v, %w", key, err)
+	}
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return StoredInstance{}, fmt.Errorf("key: %v, %w", key, err)
+	}
+
+	var instance StoredInstance
+	err = json.Unmarshal(raw, &instance)
+	if err != nil {
+		return StoredInstance{}, fmt.Errorf("key: %v, %w", key, err)
+	}
+
+	return instance, nil
+}
+
+// Restore loads every instance of a backup into store, see Backups
+func (s *SnapshotStore) Restore(ctx context.Context, backup string, store InstanceStore) error {
+	keys, err := s.objects.List(ctx, strings.TrimSuffix(backup, "/")+"/")
+	if err != nil {
+		return err
+	}
+
+	instances := make([]StoredInstance, 0, len(keys))
+	for _, key := range keys {
+		instance, err := s.Load(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return store.SaveAll(instances)
+}
+
+// put saves an instance as gzipped JSON
+func (s *SnapshotStore) put(ctx context.Context, key string, instance StoredInstance) error {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	err := json.NewEncoder(w).Encode(instance)
+	if err != nil {
+		return fmt.Errorf("instance: %v, %w", instance.ID, err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("instance: %v, %w", instance.ID, err)
+	}
+
+	return s.objects.Put(ctx, key, buf.Bytes())
+}
+
+// ArchiveTerminal archives the instances in states without outgoing edges into store and removes them,
+// it returns the keys of the archived instances
+func (m *Manager) ArchiveTerminal(ctx context.Context, store *SnapshotStore) ([]string, error) {
+	var keys []string
+	for _, id := range m.IDs() {
+		instance, err := m.stored(id)
+		if err != nil {
+			continue
+		}
+
+		inst, err := m.instance(id)
+		if err != nil || len(inst.sm.Targets(instance.State)) > 0 {
+			continue
+		}
+
+		key, err := store.Archive(ctx, instance)
+		if err != nil {
+			return keys, err
+		}
+
+		keys = append(keys, key)
+
+		err = m.Remove(id)
+		if err != nil {
+			return keys, err
+		}
+	}
+
+	return keys, nil
+}
+
+// stored returns the persisted form of an instance
+func (m *Manager) stored(id string) (StoredInstance, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return StoredInstance{}, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return inst.stored(id), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// childGroup is a set of child instances spawned by a transition of a parent instance
+type childGroup struct {
+	parent   string
+	children []string
+	done     Event
+	signaled bool
+}
+
+// InstanceIDFrom returns the ID of the instance a transition done by a Manager is running on,
+// it is false if ctx does not belong to such a transition
+func InstanceIDFrom(ctx context.Context) (string, bool) {
+	sc, ok := ctx.Value(signalKey{}).(*signalContext)
+	if !ok || len(sc.chain) == 0 {
+		return "", false
+	}
+
+	return sc.chain[len(sc.chain)-1], true
+}
+
+// SpawnAction creates an action which spawns count child instances created by definition
+// The children are named after the parent, e.g. "order-1/1", "order-1/2", and once all of them transitioned into
+// a terminal state, a state without outgoing rules, the done event is sent to the parent
+// The action only works for transitions done by the Manager, if a child can not be added, the children spawned
+// before it are removed
+func (m *Manager) SpawnAction(definition func() *StateMachine, count int, done Event) Action {
+	return func(ctx context.Context, event TransitionEvent) error {
+		parent, ok := InstanceIDFrom(ctx)
+		if !ok {
+			return fmt.Errorf("children can only be spawned by transitions done by a manager")
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		group := &childGroup{parent: parent, done: done}
+		for i := 0; i < count; i++ {
+			m.spawned[parent]++
+
+			id := fmt.Sprintf("%s/%d", parent, m.spawned[parent])
+			_, exists := m.instances[id]
+
+			err := m.add(id, definition(), "")
+			if err != nil {
+				if !exists {
+					group.children = append(group.children, id)
+				}
+
+				return errors.Join(err, m.despawn(group))
+			}
+
+			m.groups[id] = group
+			group.children = append(group.children, id)
+		}
+
+		return nil
+	}
+}
+
+// despawn removes the children of a group whose spawning failed, m.mu must be held
+func (m *Manager) despawn(group *childGroup) error {
+	var errs []error
+	for _, id := range group.children {
+		_, ok := m.instances[id]
+		if !ok {
+			continue
+		}
+
+		err := m.remove(id)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Children returns the IDs of the children spawned by the instance with the given ID
+func (m *Manager) Children(parent string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var children []string
+	for _, id := range m.sortedGroupIDs() {
+		if m.groups[id].parent == parent {
+			children = append(children, id)
+		}
+	}
+
+	return children
+}
+
+// Parent returns the ID of the instance which spawned the instance with the given ID
+func (m *Manager) Parent(id string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	group, ok := m.groups[id]
+	if !ok {
+		return "", false
+	}
+
+	return group.parent, true
+}
+
+// sortedGroupIDs returns the IDs of all child instances in alphabetical order, m.mu must be held
+func (m *Manager) sortedGroupIDs() []string {
+	ids := make([]string, 0, len(m.groups))
+	for id := range m.groups {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// childTransitioned sends the done event of a group to the parent once every child of the group is terminal
+func (m *Manager) childTransitioned(ctx context.Context, id string) error {
+	m.mu.RLock()
+	group, ok := m.groups[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	for _, child := range group.children {
+		if !m.terminal(child) {
+			return nil
+		}
+	}
+
+	m.mu.Lock()
+	signaled := group.signaled
+	group.signaled = true
+	m.mu.Unlock()
+
+	if signaled {
+		return nil
+	}
+
+	return m.Send(ctx, group.parent, group.done)
+}
+
+// terminal is true if the instance with the given ID is in a state without outgoing rules
+func (m *Manager) terminal(id string) bool {
+	terminal := false
+	_ = m.with(id, func(sm *StateMachine) error {
+		terminal = len(sm.Targets(sm.State())) == 0
+
+		return nil
+	})
+
+	return terminal
+}
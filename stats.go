@@ -0,0 +1,157 @@
+package main
+
+import (
+	"expvar"
+	"sort"
+	"time"
+)
+
+// DwellStats describes how long instances stayed in a state before leaving it
+type DwellStats struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// EdgeThroughput describes how many transitions took place between two states in a time window
+type EdgeThroughput struct {
+	From      State
+	To        State
+	Count     int
+	PerSecond float64
+}
+
+// Counts returns the number of instances in each state
+func (m *Manager) Counts() map[State]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := map[State]int{}
+	for state, ids := range m.byState {
+		if len(ids) > 0 {
+			counts[state] = len(ids)
+		}
+	}
+
+	return counts
+}
+
+// DwellTimes returns statistics of the time instances spent in each state they have already left
+// The stay in the initial state starts when the instance was created, it is unknown and not included for instances
+// restored with a history recorded before that
+func (m *Manager) DwellTimes() map[State]DwellStats {
+	durations := map[State][]time.Duration{}
+	m.each(func(id string, sm *StateMachine) {
+		entered := sm.created
+		if len(sm.history) > 0 && sm.history[0].At.Before(entered) {
+			entered = time.Time{}
+		}
+
+		for _, event := range sm.history {
+			if event.Result != Allowed {
+				continue
+			}
+
+			if !entered.IsZero() {
+				durations[event.From] = append(durations[event.From], event.At.Sub(entered))
+			}
+
+			entered = event.At
+		}
+	})
+
+	stats := map[State]DwellStats{}
+	for state, ds := range durations {
+		stats[state] = dwellStats(ds)
+	}
+
+	return stats
+}
+
+// dwellStats calculates the statistics of a non-empty list of durations
+func dwellStats(durations []time.Duration) DwellStats {
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+
+	return DwellStats{
+		Count: len(durations),
+		Mean:  total / time.Duration(len(durations)),
+		P50:   percentile(durations, 0.5),
+		P90:   percentile(durations, 0.9),
+		P99:   percentile(durations, 0.99),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
+
+// Throughput returns the number and rate of transitions per edge within the window preceding the current time,
+// nothing for windows which are not positive
+func (m *Manager) Throughput(window time.Duration) []EdgeThroughput {
+	if window <= 0 {
+		return []EdgeThroughput{}
+	}
+
+	since := m.clock.Now().Add(-window)
+
+	counts := map[edge]int{}
+	m.each(func(id string, sm *StateMachine) {
+		for _, event := range sm.history {
+			if event.Result == Allowed && !event.At.Before(since) {
+				counts[edge{from: event.From, to: event.To}]++
+			}
+		}
+	})
+
+	throughput := make([]EdgeThroughput, 0, len(counts))
+	for e, count := range counts {
+		throughput = append(throughput, EdgeThroughput{
+			From:      e.from,
+			To:        e.to,
+			Count:     count,
+			PerSecond: float64(count) / window.Seconds(),
+		})
+	}
+
+	sort.Slice(throughput, func(i, j int) bool {
+		if throughput[i].From != throughput[j].From {
+			return throughput[i].From < throughput[j].From
+		}
+
+		return throughput[i].To < throughput[j].To
+	})
+
+	return throughput
+}
+
+// PublishMetrics exposes the instance counts, dwell times, the throughput within window and the number of unfinished
+// blue instances as an expvar variable
+// The name must be unique within the process, as expvar panics on duplicate names
+func (m *Manager) PublishMetrics(name string, window time.Duration) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"counts":        m.Counts(),
+			"dwellTimes":    m.DwellTimes(),
+			"throughput":    m.Throughput(window),
+			"blueRemaining": len(m.BlueRemaining()),
+		}
+	}))
+}
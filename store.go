@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// StoredInstance is the persisted form of an instance, the definition it belongs to is identified by Version
+type StoredInstance struct {
+	ID       string            `json:"id"`
+	Version  string            `json:"version"`
+	State    State             `json:"state"`
+	History  []TransitionEvent `json:"history,omitempty"`
+	Metadata Metadata          `json:"metadata,omitempty"`
+}
+
+// InstanceStore persists instances
+// Load returns InstanceNotFound for missing instances, SaveAll saves every instance or none of them
+type InstanceStore interface {
+	Load(id string) (StoredInstance, error)
+	Save(instance StoredInstance) error
+	SaveAll(instances []StoredInstance) error
+	Delete(id string) error
+	IDs() ([]string, error)
+}
+
+// MemoryInstanceStore is an InstanceStore keeping instances in memory, it does not survive restarts on its own
+type MemoryInstanceStore struct {
+	mu        sync.Mutex
+	instances map[string]StoredInstance
+}
+
+// NewMemoryInstanceStore creates a new MemoryInstanceStore
+func NewMemoryInstanceStore() *MemoryInstanceStore {
+	return &MemoryInstanceStore{
+		instances: map[string]StoredInstance{},
+	}
+}
+
+// Load returns the instance with the given ID
+func (s *MemoryInstanceStore) Load(id string) (StoredInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, ok := s.instances[id]
+	if !ok {
+		return StoredInstance{}, fmt.Errorf("instance: %v, %w", id, InstanceNotFound)
+	}
+
+	return instance, nil
+}
+
+// Save adds or replaces an instance
+func (s *MemoryInstanceStore) Save(instance StoredInstance) error {
+	return s.SaveAll([]StoredInstance{instance})
+}
+
+// SaveAll adds or replaces every instance at once
+func (s *MemoryInstanceStore) SaveAll(instances []StoredInstance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, instance := range instances {
+		instance.History = append([]TransitionEvent(nil), instance.History...)
+		instance.Metadata = instance.Metadata.copy()
+		s.instances[instance.ID] = instance
+	}
+
+	return nil
+}
+
+// Delete removes an instance, removing a missing instance is not an error
+func (s *MemoryInstanceStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.instances, id)
+
+	return nil
+}
+
+// IDs returns the IDs of every instance in alphabetical order
+func (s *MemoryInstanceStore) IDs() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.instances))
+	for id := range s.instances {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// testCase describes a single generated test case
+type testCase struct {
+	From    State
+	To      State
+	Allowed bool
+	Params  string
+}
+
+// testSuite holds everything needed to render a generated test file
+type testSuite struct {
+	Package     string
+	Name        string
+	Constructor string
+	Cases       []testCase
+	Stubs       []string
+}
+
+var testSuiteTemplate = template.Must(template.New("suite").Parse(`// Code generated by GenerateTests. The stubs at the bottom of the file are meant to be edited.
+
+package {{ .Package }}
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test{{ .Name }}Transitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    State
+		to      State
+		params  []interface{}
+		wantErr error
+	}{
+{{- range .Cases }}
+		{
+			name:    {{ printf "%q" (print .From " -> " .To) }},
+			from:    State({{ printf "%q" .From }}),
+			to:      State({{ printf "%q" .To }}),
+{{- if .Params }}
+			params:  {{ .Params }}(),
+{{- end }}
+{{- if .Allowed }}
+			wantErr: nil,
+{{- else }}
+			wantErr: TransitionNotAllowed,
+{{- end }}
+		},
+{{- end }}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := {{ .Constructor }}(tt.from)
+
+			err := sm.Transition(tt.to, tt.params...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transition() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+{{ range .Stubs }}
+// {{ . }} must return params which satisfy the guards of the transition
+func {{ . }}() []interface{} {
+	return nil
+}
+{{ end }}`))
+
+// GenerateTests writes a table-driven Go test file for the StateMachine to w
+// Every edge with a rule becomes an allowed case, every other pair of distinct states a rejected one
+// Guarded edges get a params stub which has to be filled in to satisfy the guards, stubs of states mapping to the
+// same identifier, e.g. "in progress" and "in-progress", are numbered
+// The tests create the StateMachine under test by calling constructor, a function of the package with the signature
+// func(initial State) *StateMachine
+func GenerateTests(w io.Writer, sm *StateMachine, pkg, name, constructor string) error {
+	if !token.IsIdentifier(constructor) {
+		return fmt.Errorf("constructor: %q is not an identifier, %w", constructor, InvalidRequest)
+	}
+
+	suite := testSuite{
+		Package:     pkg,
+		Name:        identifier(name),
+		Constructor: constructor,
+	}
+
+	stubs := map[string]bool{}
+
+	states := sm.States()
+	for _, from := range states {
+		for _, to := range states {
+			if from == to {
+				continue
+			}
+
+			c := testCase{From: from, To: to}
+
+			rules := sm.edgeRules(from, to)
+			if len(rules) > 0 {
+				c.Allowed = true
+			}
+
+			if guarded(rules) {
+				stub := "params" + identifier(string(from)) + "To" + identifier(string(to))
+				c.Params = stub
+				for n := 2; stubs[c.Params]; n++ {
+					c.Params = fmt.Sprintf("%s%d", stub, n)
+				}
+				stubs[c.Params] = true
+				suite.Stubs = append(suite.Stubs, c.Params)
+			}
+
+			suite.Cases = append(suite.Cases, c)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	err := testSuiteTemplate.Execute(buf, suite)
+	if err != nil {
+		return fmt.Errorf("rendering tests: %w", err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting tests: %w", err)
+	}
+
+	_, err = w.Write(src)
+
+	return err
+}
+
+// guarded is true if any of the rules may deny a transition between existing states
+func guarded(rules []TransitionRule) bool {
+	for _, rule := range rules {
+		if _, ok := unwrap(rule).(*SimpleTransitionRule); !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// identifier converts a name into an exported Go identifier, e.g. "in progress" becomes "InProgress"
+func identifier(name string) string {
+	sb := strings.Builder{}
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		sb.WriteRune(r)
+	}
+
+	if sb.Len() == 0 || unicode.IsDigit([]rune(sb.String())[0]) {
+		return "X" + sb.String()
+	}
+
+	return sb.String()
+}
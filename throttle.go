@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var TransitionThrottled = fmt.Errorf("error: transition throttled")
+
+// SetMinInterval throttles the transitions between two states, so that they are taken at most once per interval,
+// e.g. Retry -> Progress at most once per minute when progressing calls a flaky external system
+// Throttled transitions are rejected with TransitionThrottled before their rules are evaluated, the interval is
+// measured with the clock of the StateMachine from the last time the transition was taken according to the history,
+// 0 removes the throttling
+func (sm *StateMachine) SetMinInterval(from, to State, interval time.Duration) error {
+	if sm.final {
+		return fmt.Errorf("throttling must be defined before finalization")
+	}
+
+	_, ok := sm.states[from]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", from, StateNotFound)
+	}
+
+	_, ok = sm.states[to]
+	if !ok {
+		return fmt.Errorf("state: %v, %w", to, StateNotFound)
+	}
+
+	e := edge{from: from, to: to}
+	if interval <= 0 {
+		delete(sm.throttles, e)
+
+		return nil
+	}
+
+	if sm.throttles == nil {
+		sm.throttles = map[edge]time.Duration{}
+	}
+
+	sm.throttles[e] = interval
+
+	return nil
+}
+
+// throttled returns when a transition between two states may be taken again, false if it may be taken at now
+func (sm *StateMachine) throttled(from, to State, now time.Time) (time.Time, bool) {
+	interval, ok := sm.throttles[edge{from: from, to: to}]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	for i := len(sm.history) - 1; i >= 0; i-- {
+		event := sm.history[i]
+		if event.Result != Allowed || event.From != from || event.requested() != to {
+			continue
+		}
+
+		next := event.At.Add(interval)
+
+		return next, now.Before(next)
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timer is a deadline of an instance, persisted so that it survives restarts
+// From is the state the instance was in when a transition was deferred or scheduled, Event the event of a deferred Fire
+type Timer struct {
+	ID       string        `json:"id"`
+	Instance string        `json:"instance"`
+	Kind     string        `json:"kind"`
+	From     State         `json:"from,omitempty"`
+	State    State         `json:"state"`
+	Event    Event         `json:"event,omitempty"`
+	Due      time.Time     `json:"due"`
+	Params   []interface{} `json:"params,omitempty"`
+}
+
+// TimerStore persists the timers of a Manager
+type TimerStore interface {
+	SaveTimer(timer Timer) error
+	DeleteTimer(id string) error
+	Timer(id string) (Timer, bool, error)
+	Timers() ([]Timer, error)
+}
+
+// MemoryTimerStore is a TimerStore keeping timers in memory, it does not survive restarts on its own
+type MemoryTimerStore struct {
+	mu     sync.Mutex
+	timers map[string]Timer
+}
+
+// NewMemoryTimerStore creates a new MemoryTimerStore
+func NewMemoryTimerStore() *MemoryTimerStore {
+	return &MemoryTimerStore{
+		timers: map[string]Timer{},
+	}
+}
+
+// SaveTimer adds or replaces a timer
+func (s *MemoryTimerStore) SaveTimer(timer Timer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timers[timer.ID] = timer
+
+	return nil
+}
+
+// DeleteTimer removes a timer, removing a missing timer is not an error
+func (s *MemoryTimerStore) DeleteTimer(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.timers, id)
+
+	return nil
+}
+
+// Timer returns the timer with the given ID, it is false if there is no such timer
+func (s *MemoryTimerStore) Timer(id string) (Timer, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timer, ok := s.timers[id]
+
+	return timer, ok, nil
+}
+
+// Timers returns every timer ordered by due time
+func (s *MemoryTimerStore) Timers() ([]Timer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timers := make([]Timer, 0, len(s.timers))
+	for _, timer := range s.timers {
+		timers = append(timers, timer)
+	}
+
+	sortTimers(timers)
+
+	return timers, nil
+}
+
+// sortTimers orders timers by due time, then by ID
+func sortTimers(timers []Timer) {
+	sort.Slice(timers, func(i, j int) bool {
+		if !timers[i].Due.Equal(timers[j].Due) {
+			return timers[i].Due.Before(timers[j].Due)
+		}
+
+		return timers[i].ID < timers[j].ID
+	})
+}
+
+// SetTimerStore sets the TimerStore of the Manager, timers already in the store are kept,
+// which is how timers survive a restart
+func (m *Manager) SetTimerStore(store TimerStore) {
+	if wrapped, ok := m.timerStore.(*backendTimerStore); ok {
+		store = &backendTimerStore{TimerStore: store, backend: wrapped.backend}
+	}
+
+	m.timerStore = store
+}
+
+// handleTimers registers the function handling the timers of a kind
+func (m *Manager) handleTimers(kind string, handler func(ctx context.Context, timer Timer) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.timerHandlers[kind] = handler
+}
+
+// ProcessTimers handles every timer which is due according to the clock of the Manager
+// Handled timers are deleted, failing ones are kept and retried by the next call
+func (m *Manager) ProcessTimers(ctx context.Context) error {
+	timers, err := m.timerStore.Timers()
+	if err != nil {
+		return fmt.Errorf("loading timers: %w", err)
+	}
+
+	now := m.clock.Now()
+
+	var errs []error
+	for _, timer := range timers {
+		if timer.Due.After(now) {
+			continue
+		}
+
+		err := m.fireTimer(ctx, timer)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// fireTimer handles a timer by its kind and deletes it, failing timers and timers replaced by their handler, e.g. of
+// transitions deferred again, are kept
+func (m *Manager) fireTimer(ctx context.Context, timer Timer) error {
+	m.mu.RLock()
+	handler, ok := m.timerHandlers[timer.Kind]
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("timer: %v, no handler for kind %v", timer.ID, timer.Kind)
+	}
+
+	err := handler(ctx, timer)
+	if err != nil {
+		return fmt.Errorf("timer: %v, %w", timer.ID, err)
+	}
+
+	stored, ok, err := m.timerStore.Timer(timer.ID)
+	if err != nil {
+		return fmt.Errorf("timer: %v, %w", timer.ID, err)
+	}
+
+	if ok && !stored.Due.Equal(timer.Due) {
+		return nil
+	}
+
+	err = m.timerStore.DeleteTimer(timer.ID)
+	if err != nil {
+		return fmt.Errorf("timer: %v, %w", timer.ID, err)
+	}
+
+	return nil
+}
+
+// RunTimers calls ProcessTimers every interval until ctx is done, errors are passed to onError if it is not nil
+func (m *Manager) RunTimers(ctx context.Context, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := m.ProcessTimers(ctx)
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
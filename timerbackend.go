@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// TimerBackend delivers the timers of a Manager through an external scheduler, e.g. a delayed-message queue or a
+// database poller, so that timers of clustered deployments are not bound to the node which created them
+// The TimerStore stays the record of pending timers, timers delivered after they were deleted are ignored
+type TimerBackend interface {
+	// Schedule hands a timer over to the scheduler, rescheduling a timer with the same ID replaces it
+	Schedule(timer Timer) error
+	// Cancel withdraws a timer from the scheduler, canceling a missing timer is not an error
+	Cancel(id string) error
+	// Run delivers due timers to fire until ctx is done, timers fire failed on must be delivered again later
+	Run(ctx context.Context, fire func(ctx context.Context, timer Timer) error) error
+}
+
+// backendTimerStore is a TimerStore passing the saved and deleted timers on to a TimerBackend
+type backendTimerStore struct {
+	TimerStore
+	backend TimerBackend
+}
+
+// SaveTimer stores a timer, then schedules it
+func (s *backendTimerStore) SaveTimer(timer Timer) error {
+	err := s.TimerStore.SaveTimer(timer)
+	if err != nil {
+		return err
+	}
+
+	return s.backend.Schedule(timer)
+}
+
+// DeleteTimer deletes a timer, then cancels it
+func (s *backendTimerStore) DeleteTimer(id string) error {
+	err := s.TimerStore.DeleteTimer(id)
+	if err != nil {
+		return err
+	}
+
+	return s.backend.Cancel(id)
+}
+
+// Flush flushes the TimerStore if it is a Flusher
+func (s *backendTimerStore) Flush() error {
+	if flusher, ok := s.TimerStore.(Flusher); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// SetTimerBackend makes the Manager schedule its timers with backend besides storing them, the timers are then
+// fired by RunTimerBackend instead of ProcessTimers and RunTimers, nil goes back to polling the TimerStore
+// Timers stored before are not handed over, so the backend should be set before the Manager starts
+func (m *Manager) SetTimerBackend(backend TimerBackend) {
+	store := m.timerStore
+	if wrapped, ok := store.(*backendTimerStore); ok {
+		store = wrapped.TimerStore
+	}
+
+	if backend != nil {
+		store = &backendTimerStore{TimerStore: store, backend: backend}
+	}
+
+	m.timerStore = store
+}
+
+// RunTimerBackend fires the timers delivered by the TimerBackend until ctx is done
+func (m *Manager) RunTimerBackend(ctx context.Context) error {
+	wrapped, ok := m.timerStore.(*backendTimerStore)
+	if !ok {
+		return fmt.Errorf("no timer backend set")
+	}
+
+	err := wrapped.backend.Run(ctx, m.deliverTimer)
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("running timer backend: %w", err)
+	}
+
+	return nil
+}
+
+// deliverTimer fires a timer delivered by the TimerBackend unless it was deleted from the TimerStore in the meantime,
+// e.g. an SLA timer of an instance which left the state
+func (m *Manager) deliverTimer(ctx context.Context, timer Timer) error {
+	stored, ok, err := m.timerStore.Timer(timer.ID)
+	if err != nil {
+		return fmt.Errorf("timer: %v, %w", timer.ID, err)
+	}
+
+	if !ok || !stored.Due.Equal(timer.Due) {
+		return nil
+	}
+
+	return m.fireTimer(ctx, stored)
+}
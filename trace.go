@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RecordTo writes the history of the StateMachine to w as a trace: JSON Lines of TransitionEvents
+func (sm *StateMachine) RecordTo(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, event := range sm.history {
+		err := encoder.Encode(event)
+		if err != nil {
+			return fmt.Errorf("encoding trace: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ReadTrace reads a trace written by RecordTo
+// Whole numbers in params are decoded as int, other numbers as float64
+func ReadTrace(r io.Reader) ([]TransitionEvent, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var events []TransitionEvent
+	for {
+		var event TransitionEvent
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding trace, line %d: %w", len(events)+1, err)
+		}
+
+		for i, param := range event.Params {
+			event.Params[i] = jsonParam(param)
+		}
+
+		events = append(events, event)
+	}
+}
+
+// Replay applies a trace to a StateMachine created by definition
+// and fails at the first recorded transition whose result the definition does not reproduce,
+// which makes it possible to check a new definition version against production traces
+func Replay(r io.Reader, definition func() *StateMachine) error {
+	events, err := ReadTrace(r)
+	if err != nil {
+		return err
+	}
+
+	return NewDebugger(definition, events).Seek(len(events))
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+var (
+	EventNotRegistered = fmt.Errorf("error: event not registered")
+	NoUpcaster         = fmt.Errorf("error: no upcaster")
+)
+
+// TypedEvent is an Event carrying a payload of a known type, which is passed to the guards and actions as the only
+// param of the transition, see PayloadOf
+// The type can not be called Event[T], as Event names the events
+type TypedEvent[T any] struct {
+	Name    Event
+	Payload T
+}
+
+// NewTypedEvent creates a new TypedEvent
+func NewTypedEvent[T any](name Event, payload T) TypedEvent[T] {
+	return TypedEvent[T]{
+		Name:    name,
+		Payload: payload,
+	}
+}
+
+// Fire fires the event on a StateMachine with its payload
+func (e TypedEvent[T]) Fire(ctx context.Context, sm *StateMachine) error {
+	return sm.FireContext(ctx, e.Name, e.Payload)
+}
+
+// PayloadOf returns the payload of a TypedEvent from the params of a transition, e.g. in a guard or an action,
+// false if the params are not a single payload of the type
+func PayloadOf[T any](params ...interface{}) (T, bool) {
+	var payload T
+	if len(params) != 1 {
+		return payload, false
+	}
+
+	payload, ok := params[0].(T)
+
+	return payload, ok
+}
+
+// EncodedEvent is the stored form of a TypedEvent, Version is the schema version its payload was encoded with
+type EncodedEvent struct {
+	Name    Event           `json:"event"`
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Upcaster converts the payload of an event from a schema version to the next one, e.g. filling a field added
+// by the new version
+type Upcaster func(payload json.RawMessage) (json.RawMessage, error)
+
+// eventSchema is the current schema of an event with the upcasters of its previous versions
+type eventSchema struct {
+	version   int
+	decode    func(payload []byte, unmarshal func(data []byte, v interface{}) error) (interface{}, error)
+	upcasters map[int]Upcaster
+}
+
+// EventSchemas is a registry of the payload types of the events by their names, decoding stored events into their
+// TypedEvents and upcasting the ones encoded with previous schema versions
+type EventSchemas struct {
+	mu        sync.RWMutex
+	schemas   map[Event]*eventSchema
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+// NewEventSchemas creates a new EventSchemas encoding the payloads as JSON
+func NewEventSchemas() *EventSchemas {
+	return &EventSchemas{
+		schemas:   map[Event]*eventSchema{},
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	}
+}
+
+// SetCodec sets how the payloads are encoded, e.g. protojson for payloads which are proto messages
+// Upcasters receive the payloads in this encoding
+func (s *EventSchemas) SetCodec(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.marshal = marshal
+	s.unmarshal = unmarshal
+}
+
+// RegisterEventSchema registers T as the payload type of an event in its current schema version, the upcasters of
+// the event are kept
+func RegisterEventSchema[T any](s *EventSchemas, name Event, version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[name]
+	if !ok {
+		schema = &eventSchema{upcasters: map[int]Upcaster{}}
+		s.schemas[name] = schema
+	}
+
+	schema.version = version
+	schema.decode = func(payload []byte, unmarshal func(data []byte, v interface{}) error) (interface{}, error) {
+		var decoded T
+		err := unmarshal(payload, &decoded)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoded, nil
+	}
+}
+
+// AddUpcaster adds an upcaster converting the payloads of an event from a schema version to the next one
+func (s *EventSchemas) AddUpcaster(name Event, from int, upcast Upcaster) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[name]
+	if !ok {
+		return fmt.Errorf("event: %v, %w", name, EventNotRegistered)
+	}
+
+	schema.upcasters[from] = upcast
+
+	return nil
+}
+
+// Encode encodes the payload of an event in its current schema version
+func (s *EventSchemas) Encode(name Event, payload interface{}) (EncodedEvent, error) {
+	s.mu.RLock()
+	schema, ok := s.schemas[name]
+	marshal := s.marshal
+	s.mu.RUnlock()
+
+	if !ok {
+		return EncodedEvent{}, fmt.Errorf("event: %v, %w", name, EventNotRegistered)
+	}
+
+	data, err := marshal(payload)
+	if err != nil {
+		return EncodedEvent{}, fmt.Errorf("event: %v, %w", name, err)
+	}
+
+	return EncodedEvent{Name: name, Version: schema.version, Payload: data}, nil
+}
+
+// Decode decodes the payload of a stored event into its registered type, upcasting it version by version if it was
+// encoded with a previous schema version
+func (s *EventSchemas) Decode(encoded EncodedEvent) (interface{}, error) {
+	s.mu.RLock()
+	schema, ok := s.schemas[encoded.Name]
+	if !ok {
+		s.mu.RUnlock()
+
+		return nil, fmt.Errorf("event: %v, %w", encoded.Name, EventNotRegistered)
+	}
+
+	version, decode, unmarshal := schema.version, schema.decode, s.unmarshal
+	upcasters := make(map[int]Upcaster, len(schema.upcasters))
+	for from, upcast := range schema.upcasters {
+		upcasters[from] = upcast
+	}
+	s.mu.RUnlock()
+
+	if encoded.Version > version {
+		return nil, fmt.Errorf("event: %v, version %d is newer than %d, %w", encoded.Name, encoded.Version, version, InvalidRequest)
+	}
+
+	payload := encoded.Payload
+	for v := encoded.Version; v < version; v++ {
+		upcast, ok := upcasters[v]
+		if !ok {
+			return nil, fmt.Errorf("event: %v, version: %d, %w", encoded.Name, v, NoUpcaster)
+		}
+
+		var err error
+		payload, err = upcast(payload)
+		if err != nil {
+			return nil, fmt.Errorf("event: %v, version: %d, %w", encoded.Name, v, err)
+		}
+	}
+
+	decoded, err := decode(payload, unmarshal)
+	if err != nil {
+		return nil, fmt.Errorf("event: %v, %w", encoded.Name, err)
+	}
+
+	return decoded, nil
+}
+
+// Fire decodes a stored event and fires it on a StateMachine with its payload
+func (s *EventSchemas) Fire(ctx context.Context, sm *StateMachine, encoded EncodedEvent) error {
+	payload, err := s.Decode(encoded)
+	if err != nil {
+		return err
+	}
+
+	return sm.FireContext(ctx, encoded.Name, payload)
+}
+
+// DecodeEvent decodes a stored event into a TypedEvent, failing if T is not the registered type of the event
+func DecodeEvent[T any](s *EventSchemas, encoded EncodedEvent) (TypedEvent[T], error) {
+	payload, err := s.Decode(encoded)
+	if err != nil {
+		return TypedEvent[T]{}, err
+	}
+
+	typed, ok := payload.(T)
+	if !ok {
+		return TypedEvent[T]{}, fmt.Errorf("event: %v, payload is %T, %w", encoded.Name, payload, InvalidRequest)
+	}
+
+	return NewTypedEvent(encoded.Name, typed), nil
+}
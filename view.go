@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// View is a read-only snapshot of a StateMachine for code which should only observe a workflow, e.g. plugins or
+// templates, it keeps no reference to the StateMachine, so it can not be used to transition it
+type View struct {
+	state    State
+	entered  time.Time
+	targets  []State
+	events   []Event
+	history  []TransitionEvent
+	metadata Metadata
+}
+
+// View returns a read-only snapshot of the StateMachine in its current state
+func (sm *StateMachine) View() View {
+	var events []Event
+	for t := range sm.events {
+		if t.from == sm.state {
+			events = append(events, t.event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i] < events[j]
+	})
+
+	return View{
+		state:    sm.state,
+		entered:  sm.Entered(),
+		targets:  sm.Targets(sm.state),
+		events:   events,
+		history:  sm.History(),
+		metadata: sm.Metadata(),
+	}
+}
+
+// State returns the state of the StateMachine
+func (v View) State() State {
+	return v.state
+}
+
+// Entered returns when the state was entered, see StateMachine.Entered
+func (v View) Entered() time.Time {
+	return v.entered
+}
+
+// Targets returns the states which have at least one rule for transitioning from the state, the guards of the
+// rules may still deny the transitions
+func (v View) Targets() []State {
+	return append([]State(nil), v.targets...)
+}
+
+// Events returns the events handled in the state in alphabetical order
+func (v View) Events() []Event {
+	return append([]Event(nil), v.events...)
+}
+
+// History returns a copy of the history of the StateMachine
+func (v View) History() []TransitionEvent {
+	return append([]TransitionEvent(nil), v.history...)
+}
+
+// Metadata returns a copy of the metadata of the StateMachine
+func (v View) Metadata() Metadata {
+	return v.metadata.copy()
+}
+
+// View returns a read-only snapshot of the instance with the given ID
+func (m *Manager) View(id string) (View, error) {
+	inst, err := m.instance(id)
+	if err != nil {
+		return View{}, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	return inst.sm.View(), nil
+}
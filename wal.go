@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileJournal is a Journal appending entries to a file as JSON lines, each synced to disk before Append returns,
+// so that it can be used as a write-ahead log: the intent of a transition is on disk before it is applied
+// A line cut short by a crash while it was written is ignored, the transition it journaled was never applied
+type FileJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFileJournal opens the journal at path, creating it if it does not exist yet
+// An incomplete last line is cut off, so that new entries are not appended to it
+func OpenFileJournal(path string) (*FileJournal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("opening journal: %w", err)
+	}
+
+	if complete := bytes.LastIndexByte(data, '\n') + 1; complete < len(data) {
+		err = os.Truncate(path, int64(complete))
+		if err != nil {
+			return nil, fmt.Errorf("repairing journal: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening journal: %w", err)
+	}
+
+	return &FileJournal{file: file}, nil
+}
+
+// Append writes an entry to the end of the journal and syncs it to disk
+func (j *FileJournal) Append(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err = j.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return j.file.Sync()
+}
+
+// Entries reads every entry in the order they were appended
+func (j *FileJournal) Entries() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err := j.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []JournalEntry
+	r := bufio.NewReader(j.file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// an incomplete last line is a write cut short by a crash
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry JournalEntry
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("journal entry %d: %w", len(entries)+1, err)
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// Compact rewrites the journal keeping only the entries of the transitions which are not done yet,
+// the file is replaced atomically so a crash while compacting loses nothing
+func (j *FileJournal) Compact() error {
+	entries, err := j.Entries()
+	if err != nil {
+		return err
+	}
+
+	done := map[uint64]bool{}
+	for _, entry := range entries {
+		if entry.Done {
+			done[entry.Seq] = true
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	path := j.file.Name()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".journal-*")
+	if err != nil {
+		return fmt.Errorf("compacting journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		if done[entry.Seq] {
+			continue
+		}
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			_ = tmp.Close()
+
+			return err
+		}
+
+		_, _ = w.Write(append(line, '\n'))
+	}
+
+	err = errors.Join(w.Flush(), tmp.Sync(), tmp.Close())
+	if err != nil {
+		return fmt.Errorf("compacting journal: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("compacting journal: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopening journal: %w", err)
+	}
+
+	_ = j.file.Close()
+	j.file = file
+
+	return nil
+}
+
+// Close closes the journal file
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// Rollback undoes the pending transitions of the journal, the latest first, instead of completing them like Recover:
+// a StateMachine in the end state of a pending transition is moved back into its start state and the transition is
+// removed from its history, without running any action
+// Every rolled back transition is journaled as done with RolledBack set, a StateMachine in any other state than the
+// start or end state of a pending transition can not be rolled back
+func (sm *StateMachine) Rollback() error {
+	pending, err := sm.Pending()
+	if err != nil {
+		return err
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		event := pending[i].Event
+
+		switch sm.state {
+		case event.To:
+			sm.state = event.From
+			if n := len(sm.history); n > 0 && sm.history[n-1].From == event.From && sm.history[n-1].To == event.To && sm.history[n-1].At.Equal(event.At) {
+				sm.history = sm.history[:n-1]
+			}
+		case event.From:
+		default:
+			return fmt.Errorf("transition: %v -> %v, state: %v, %w", event.From, event.To, sm.state, TransitionNotAllowed)
+		}
+
+		err = sm.journal.Append(JournalEntry{Seq: pending[i].Seq, Event: event, Done: true, RolledBack: true})
+		if err != nil {
+			return fmt.Errorf("transition: %v -> %v, journaling: %w", event.From, event.To, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WasmRuntime instantiates WebAssembly modules in a sandbox, it is implemented by adapters of
+// github.com/tetratelabs/wazero, which keeps the dependency out of this package
+type WasmRuntime interface {
+	Instantiate(ctx context.Context, module []byte) (WasmModule, error)
+}
+
+// WasmModule is an instantiated WebAssembly module implementing the guard ABI
+// Call copies input into the memory of the module using its exported "alloc(size i32) i32" function and calls the
+// exported function with "(ptr i32, len i32) i32", returning its result
+type WasmModule interface {
+	Call(ctx context.Context, function string, input []byte) (uint32, error)
+	Close(ctx context.Context) error
+}
+
+// WasmEngine is a ScriptEngine running guards exported by WebAssembly modules, e.g. customer-supplied guard logic
+// A guard is referenced as "module" or "module:function", the function defaults to "guard"
+// It receives the variables of the guard script as JSON, durations in nanoseconds, and returns 1 to allow and 0 to
+// deny the transition, calls are serialized per module and cancelled after the timeout
+type WasmEngine struct {
+	runtime WasmRuntime
+	timeout time.Duration
+	mu      sync.RWMutex
+	modules map[string]*wasmModule
+}
+
+// wasmModule serializes the calls of a module, as an instance has a single linear memory
+type wasmModule struct {
+	mu     sync.Mutex
+	module WasmModule
+}
+
+// NewWasmEngine creates a new WasmEngine, a timeout of zero or less does not limit the guards
+func NewWasmEngine(runtime WasmRuntime, timeout time.Duration) *WasmEngine {
+	return &WasmEngine{
+		runtime: runtime,
+		timeout: timeout,
+		modules: map[string]*wasmModule{},
+	}
+}
+
+// Load instantiates a module by name, replacing and closing a module loaded before by the same name
+func (e *WasmEngine) Load(ctx context.Context, name string, module []byte) error {
+	instance, err := e.runtime.Instantiate(ctx, module)
+	if err != nil {
+		return fmt.Errorf("instantiating wasm module %q: %w", name, err)
+	}
+
+	e.mu.Lock()
+	previous := e.modules[name]
+	e.modules[name] = &wasmModule{module: instance}
+	e.mu.Unlock()
+
+	if previous == nil {
+		return nil
+	}
+
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+
+	return previous.module.Close(ctx)
+}
+
+// Close closes every loaded module
+func (e *WasmEngine) Close(ctx context.Context) error {
+	e.mu.Lock()
+	modules := e.modules
+	e.modules = map[string]*wasmModule{}
+	e.mu.Unlock()
+
+	var err error
+	for name, module := range modules {
+		module.mu.Lock()
+		closeErr := module.module.Close(ctx)
+		module.mu.Unlock()
+
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("closing wasm module %q: %w", name, closeErr)
+		}
+	}
+
+	return err
+}
+
+// Compile resolves a guard reference to a loaded module
+func (e *WasmEngine) Compile(source string) (Script, error) {
+	name, function, found := strings.Cut(source, ":")
+	if !found {
+		function = "guard"
+	}
+
+	_, err := e.module(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return wasmScript{engine: e, name: name, function: function}, nil
+}
+
+// module retrieves a loaded module
+func (e *WasmEngine) module(name string) (*wasmModule, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	module, ok := e.modules[name]
+	if !ok {
+		return nil, fmt.Errorf("wasm module %q is not loaded", name)
+	}
+
+	return module, nil
+}
+
+// wasmScript calls a guard exported by a module, the module is looked up by name on every call, so that guards use a
+// module loaded again
+type wasmScript struct {
+	engine   *WasmEngine
+	name     string
+	function string
+}
+
+// Eval encodes the variables and calls the guard, results other than 0 and 1 are an error
+func (s wasmScript) Eval(vars map[string]interface{}) (bool, error) {
+	input, err := json.Marshal(vars)
+	if err != nil {
+		return false, fmt.Errorf("encoding guard input: %w", err)
+	}
+
+	module, err := s.engine.module(s.name)
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	if s.engine.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.engine.timeout)
+		defer cancel()
+	}
+
+	module.mu.Lock()
+	result, err := module.module.Call(ctx, s.function, input)
+	module.mu.Unlock()
+
+	if err != nil {
+		return false, fmt.Errorf("calling wasm guard %q: %w", s.function, err)
+	}
+
+	switch result {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+
+	return false, fmt.Errorf("wasm guard %q returned %d", s.function, result)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+)
+
+// watcher is a subscription to the events of an instance
+type watcher struct {
+	events chan TransitionEvent
+	done   chan struct{}
+}
+
+// Watch returns a channel receiving the events recorded by transitions of the instance with the given ID as they
+// happen, e.g. to stream them to downstream services
+// The channel buffers up to buffer events, a watcher falling further behind is closed instead of slowing down
+// transitions, just like when ctx is done or the instance is removed, so a closed channel means watching again
+// A buffer below 1 is treated as 1
+func (m *Manager) Watch(ctx context.Context, id string, buffer int) (<-chan TransitionEvent, error) {
+	_, err := m.instance(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	w := &watcher{events: make(chan TransitionEvent, buffer), done: make(chan struct{})}
+
+	m.watchMu.Lock()
+	if m.watchers[id] == nil {
+		m.watchers[id] = map[*watcher]bool{}
+	}
+	m.watchers[id][w] = true
+	m.watchMu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+			return
+		}
+
+		m.watchMu.Lock()
+		defer m.watchMu.Unlock()
+
+		m.closeWatcher(id, w)
+	}()
+
+	return w.events, nil
+}
+
+// notify sends newly recorded events of an instance to its watchers, inst.mu must be held
+func (m *Manager) notify(id string, events []TransitionEvent) {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+
+	for w := range m.watchers[id] {
+		for _, event := range events {
+			select {
+			case w.events <- event:
+			default:
+				m.closeWatcher(id, w)
+			}
+
+			if !m.watchers[id][w] {
+				break
+			}
+		}
+	}
+}
+
+// unwatch closes every watcher of an instance
+func (m *Manager) unwatch(id string) {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+
+	for w := range m.watchers[id] {
+		m.closeWatcher(id, w)
+	}
+}
+
+// closeWatcher closes a watcher unless it is already closed, m.watchMu must be held
+func (m *Manager) closeWatcher(id string, w *watcher) {
+	if !m.watchers[id][w] {
+		return
+	}
+
+	delete(m.watchers[id], w)
+	if len(m.watchers[id]) == 0 {
+		delete(m.watchers, id)
+	}
+
+	close(w.events)
+	close(w.done)
+}